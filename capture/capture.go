@@ -0,0 +1,181 @@
+package capture
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+type (
+	// Direction tells which peer sent the frame
+	Direction string
+
+	// Side is the peer owning the recorded connection
+	Side string
+
+	// Record is the frame captured from the connection
+	// The recording file is a JSON object per line.
+	Record struct {
+		Time time.Time `json:"time"`
+		// Conn identifies the connection within the recording
+		Conn      uint64    `json:"conn"`
+		Direction Direction `json:"dir"`
+		// Frame is the packet content without the size header
+		Frame []byte `json:"frame"`
+	}
+
+	// Recorder writes the frames of the recorded connections
+	// A single recorder can be shared by concurrent connections.
+	Recorder struct {
+		// first for the 64-bit alignment of the atomic operations
+		lastConn uint64
+		mu       sync.Mutex
+		encoder  *json.Encoder
+		failed   bool
+	}
+
+	// recordingConn records the frames passing the connection
+	recordingConn struct {
+		net.Conn
+		reads  *frameAssembler
+		writes *frameAssembler
+	}
+
+	// frameAssembler splits the byte stream into frames
+	frameAssembler struct {
+		mu        sync.Mutex
+		recorder  *Recorder
+		conn      uint64
+		direction Direction
+		pending   []byte
+		// the stream isn't framed, stop recording
+		broken bool
+	}
+)
+
+const (
+	ClientToServer Direction = "c2s"
+	ServerToClient Direction = "s2c"
+
+	Client Side = "client"
+	Server Side = "server"
+)
+
+// NewRecorder returns the recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Conn returns the connection recording the frames it reads and writes
+// side tells whether the connection is the client or the server end.
+func (r *Recorder) Conn(conn net.Conn, side Side) net.Conn {
+	id := atomic.AddUint64(&r.lastConn, 1)
+	readDirection, writeDirection := ServerToClient, ClientToServer
+	if side == Server {
+		readDirection, writeDirection = ClientToServer, ServerToClient
+	}
+	return &recordingConn{
+		Conn:   conn,
+		reads:  &frameAssembler{recorder: r, conn: id, direction: readDirection},
+		writes: &frameAssembler{recorder: r, conn: id, direction: writeDirection},
+	}
+}
+
+// record writes the frame, the recording stops after the first write error
+func (r *Recorder) record(record *Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return
+	}
+	if err := r.encoder.Encode(record); err != nil {
+		log.Print("stop recording: ", err)
+		r.failed = true
+	}
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.reads.feed(p[:n])
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.writes.feed(p[:n])
+	return n, err
+}
+
+// feed appends the stream bytes and records the complete frames
+func (a *frameAssembler) feed(data []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.broken || len(data) == 0 {
+		return
+	}
+
+	a.pending = append(a.pending, data...)
+	for len(a.pending) >= zkp.FrameHeaderSize {
+		size := binary.LittleEndian.Uint32(a.pending)
+		if size > zkp.DefaultMaxFrameSize {
+			a.broken = true
+			a.pending = nil
+			return
+		}
+		end := zkp.FrameHeaderSize + int(size)
+		if len(a.pending) < end {
+			// wait for the rest of the frame
+			return
+		}
+		frame := make([]byte, size)
+		copy(frame, a.pending[zkp.FrameHeaderSize:end])
+		a.recorder.record(&Record{
+			Time:      time.Now(),
+			Conn:      a.conn,
+			Direction: a.direction,
+			Frame:     frame,
+		})
+		a.pending = a.pending[end:]
+	}
+}
+
+// ReadRecording reads all records
+func ReadRecording(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		if err := decoder.Decode(&record); err != nil {
+			if err == io.EOF {
+				return records, nil
+			}
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+}
+
+// Connections groups the records by connection in the order of their first frame
+func Connections(records []*Record) [][]*Record {
+	var connections [][]*Record
+	index := make(map[uint64]int)
+	for _, record := range records {
+		i, ok := index[record.Conn]
+		if !ok {
+			i = len(connections)
+			index[record.Conn] = i
+			connections = append(connections, nil)
+		}
+		connections[i] = append(connections[i], record)
+	}
+	return connections
+}
@@ -0,0 +1,79 @@
+package capture_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/capture"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	var recording bytes.Buffer
+	recorder := capture.NewRecorder(&recording)
+
+	clientConn, serverConn := net.Pipe()
+	client := recorder.Conn(clientConn, capture.Client)
+	server := recorder.Conn(serverConn, capture.Server)
+
+	request := &zkp_pb.AuthRequest{User: "max"}
+	response := &zkp_pb.AuthResponse{Result: true}
+	go func() {
+		// partial writes are recorded as a single frame
+		var packet bytes.Buffer
+		zkp.SendMessage(&packet, request)
+		client.Write(packet.Bytes()[:3])
+		client.Write(packet.Bytes()[3:])
+		zkp.ReadMessage(client)
+		client.Close()
+	}()
+
+	msg, err := zkp.ReadMessage(server)
+	assert.NoError(err)
+	assert.True(proto.Equal(request, msg))
+	assert.NoError(zkp.SendMessage(server, response))
+	_, err = server.Read(make([]byte, 1))
+	assert.ErrorIs(err, io.EOF)
+
+	records, err := capture.ReadRecording(&recording)
+	assert.NoError(err)
+	// each frame is recorded by both ends
+	assert.Len(records, 4)
+	connections := capture.Connections(records)
+	assert.Len(connections, 2)
+	for _, connection := range connections {
+		assert.Len(connection, 2)
+		assert.Equal(capture.ClientToServer, connection[0].Direction)
+		assert.Equal(capture.ServerToClient, connection[1].Direction)
+		assert.False(connection[0].Time.IsZero())
+
+		msg, err := zkp.DefaultCodec.Decode(connection[0].Frame)
+		assert.NoError(err)
+		assert.True(proto.Equal(request, msg))
+		msg, err = zkp.DefaultCodec.Decode(connection[1].Frame)
+		assert.NoError(err)
+		assert.True(proto.Equal(response, msg))
+	}
+}
+
+func TestRecorder_NotFramed(t *testing.T) {
+	assert := assert.New(t)
+	var recording bytes.Buffer
+	recorder := capture.NewRecorder(&recording)
+
+	clientConn, serverConn := net.Pipe()
+	client := recorder.Conn(clientConn, capture.Client)
+	go func() {
+		client.Write([]byte("GET / HTTP/1.1\r\n"))
+		client.Close()
+	}()
+	_, err := io.ReadAll(serverConn)
+	assert.NoError(err)
+	assert.Zero(recording.Len())
+}
@@ -1,15 +1,22 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mindaugasrukas/zkp_example/capture"
 	"github.com/mindaugasrukas/zkp_example/client/model"
 	"github.com/mindaugasrukas/zkp_example/zkp"
 	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -24,30 +31,145 @@ type (
 		ProveAuthentication(challenge *big.Int) (answer *big.Int)
 	}
 
+	// Transport selects the protocol used to connect to the server
+	Transport string
+
 	Client struct {
 		serverAddr string
-		// Pluggable ZKP prover
-		prover Prover
+		// Timeout is the time allowed for each network operation, zero means no limit
+		Timeout time.Duration
+		// TLSConfig enables TLS if set
+		TLSConfig *tls.Config
+		// Transport used to connect to the server
+		Transport Transport
+		// Capabilities offered in the protocol negotiation
+		Capabilities zkp.Capabilities
+		// Recorder records the envelope protocol traffic if set
+		Recorder *capture.Recorder
+
+		// the connection shared by the exchanges, nil until the first one
+		mu  sync.Mutex
+		mux *zkp.Mux
 	}
 )
 
+const (
+	// TCPTransport is the length-prefixed envelope protocol over TCP
+	TCPTransport Transport = "tcp"
+	// GRPCTransport is the ZKPAuth gRPC service
+	GRPCTransport Transport = "grpc"
+	// WebSocketTransport is the envelope protocol over WebSocket
+	WebSocketTransport Transport = "websocket"
+)
+
+// UnixScheme prefixes the server unix domain socket path
+const UnixScheme = "unix://"
+
+// DefaultTimeout is the network operation timeout used by NewClient
+const DefaultTimeout = 10 * time.Second
+
 // NewClient returns a new client instance
 func NewClient(serverAddr string) *Client {
 	return &Client{
-		serverAddr: serverAddr,
+		serverAddr:   serverAddr,
+		Timeout:      DefaultTimeout,
+		Transport:    TCPTransport,
+		Capabilities: zkp.DefaultCapabilities,
 	}
 }
 
-// Register user to the server
-func (c *Client) Register(user string, password int) error {
-	// connect to server
-	conn, err := net.Dial("tcp", c.serverAddr)
+// withTimeout returns the context limited by the client timeout
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// dial connects to the server, recording the connection if the recorder is set
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	conn, err := c.dialConn(ctx)
+	if err != nil || c.Recorder == nil {
+		return conn, err
+	}
+	return c.Recorder.Conn(conn, capture.Client), nil
+}
+
+// dialConn connects to the server using the transport
+func (c *Client) dialConn(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if c.Transport == WebSocketTransport {
+		return c.dialWebSocket(ctx)
+	}
+	network, address := "tcp", c.serverAddr
+	if strings.HasPrefix(address, UnixScheme) {
+		network, address = "unix", strings.TrimPrefix(address, UnixScheme)
+	}
+	if c.TLSConfig != nil {
+		dialer := tls.Dialer{Config: c.TLSConfig}
+		return dialer.DialContext(ctx, network, address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// connect returns the connection shared by the exchanges
+// The connection is established on the first use and after it fails.
+func (c *Client) connect(ctx context.Context) (*zkp.Mux, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mux == nil || c.mux.Err() != nil {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		framer := zkp.NewFramer(conn, conn)
+		if err := c.hello(ctx, framer); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.mux = zkp.NewClientMux(framer, conn)
+	}
+	return c.mux, nil
+}
+
+// stream opens a new exchange on the connection shared by the exchanges
+func (c *Client) stream(ctx context.Context) (*zkp.Stream, error) {
+	mux, err := c.connect(ctx)
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return err
+		return nil, err
+	}
+	return mux.Open()
+}
+
+// Close closes the connection to the server, the exchanges in progress fail
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mux == nil {
+		return nil
 	}
-	defer conn.Close()
+	err := c.mux.Close()
+	c.mux = nil
+	return err
+}
+
+// send writes the message to the server within the client timeout
+func (c *Client) send(ctx context.Context, conn zkp.MessageConn, message proto.Message) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return conn.SendMessageContext(ctx, message)
+}
+
+// Register user to the server
+func (c *Client) Register(user string, password int) error {
+	return c.RegisterContext(context.Background(), user, password)
+}
 
+// RegisterContext registers user to the server
+// Cancelling the context aborts the registration.
+func (c *Client) RegisterContext(ctx context.Context, user string, password int) error {
 	prover := zkp.NewProver(int64(password))
 	commits, err := prover.CreateRegisterCommits()
 	if err != nil {
@@ -67,40 +189,53 @@ func (c *Client) Register(user string, password int) error {
 		},
 	}
 
+	if c.Transport == GRPCTransport {
+		return c.registerGRPC(ctx, request)
+	}
+
+	// open the exchange on the server connection
+	stream, err := c.stream(ctx)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return err
+	}
+	defer stream.Close()
+
 	// send request
-	if err := zkp.SendMessage(conn, request); err != nil {
+	if err := c.send(ctx, stream, request); err != nil {
 		fmt.Printf("Error: %s\n", err)
 		return err
 	}
 
-	return c.ProcessResponse(conn)
+	_, err = c.ProcessResponse(ctx, stream, nil)
+	return err
 }
 
 // ProcessRegistrationResults ...
+// returns ServerError if the registration failed
 func (c *Client) ProcessRegistrationResults(registerResponse *zkp_pb.RegisterResponse) error {
-	if registerResponse.Result {
-		fmt.Println("Registration successful")
-	} else {
-		fmt.Printf("Error: %s\n", registerResponse.Error)
+	if !registerResponse.Result {
+		return newServerError(registerResponse.Code, registerResponse.RetryAfter, registerResponse.Detail)
 	}
+	fmt.Println("Registration successful")
 	return nil
 }
 
 // Login user against the server
-func (c *Client) Login(user string, password int) error {
-	// connect to server
-	conn, err := net.Dial("tcp", c.serverAddr)
-	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		return err
-	}
-	defer conn.Close()
+// returns the session of the logged in user.
+func (c *Client) Login(user string, password int) (*Session, error) {
+	return c.LoginContext(context.Background(), user, password)
+}
 
-	c.prover = zkp.NewProver(int64(password))
-	request, err := c.prover.CreateAuthenticationCommits()
+// LoginContext logs in user against the server
+// Cancelling the context aborts the login. The session lives on the connection until
+// it is closed or the user logs out.
+func (c *Client) LoginContext(ctx context.Context, user string, password int) (*Session, error) {
+	prover := zkp.NewProver(int64(password))
+	request, err := prover.CreateAuthenticationCommits()
 	if err != nil {
 		fmt.Printf("Error: %s\n", err)
-		return err
+		return nil, err
 	}
 
 	// construct login request
@@ -114,82 +249,96 @@ func (c *Client) Login(user string, password int) error {
 		},
 	}
 
+	if c.Transport == GRPCTransport {
+		// the gRPC service has no session requests
+		msg, err := c.loginGRPC(ctx, prover, authRequest)
+		if err != nil {
+			return nil, err
+		}
+		return c.newSession(user, nil, msg)
+	}
+
+	// the session is bound to the connection the login runs on
+	mux, err := c.connect(ctx)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return nil, err
+	}
+	stream, err := mux.Open()
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return nil, err
+	}
+	defer stream.Close()
+
 	// send request
-	if err := zkp.SendMessage(conn, authRequest); err != nil {
+	if err := c.send(ctx, stream, authRequest); err != nil {
 		fmt.Printf("Error: %s\n", err)
-		return err
+		return nil, err
 	}
 
-	return c.ProcessResponse(conn)
+	msg, err := c.ProcessResponse(ctx, stream, prover)
+	if err != nil {
+		return nil, err
+	}
+	return c.newSession(user, mux, msg)
 }
 
 // ProcessChallenge returns answer to the server
-func (c *Client) ProcessChallenge(conn net.Conn, challengeResponse *zkp_pb.ChallengeResponse) error {
+// prover holds the secret of the login in progress.
+func (c *Client) ProcessChallenge(ctx context.Context, conn zkp.MessageConn, prover Prover, challengeResponse *zkp_pb.ChallengeResponse) (proto.Message, error) {
+	if prover == nil {
+		return nil, WrongResponseError
+	}
 	// construct answer request
 	challenge := model.GetChallenge(challengeResponse)
 	log.Print("challenge = ", challenge)
-	answer := c.prover.ProveAuthentication(challenge)
+	answer := prover.ProveAuthentication(challenge)
 	log.Print("answer = ", answer)
 	answerRequest := &zkp_pb.AnswerRequest{
 		Answer: (answer).Bytes(),
 	}
 
 	// send request
-	if err := zkp.SendMessage(conn, answerRequest); err != nil {
+	if err := c.send(ctx, conn, answerRequest); err != nil {
 		fmt.Printf("Error: %s\n", err)
-		return err
+		return nil, err
 	}
 
-	return c.ProcessResponse(conn)
+	return c.ProcessResponse(ctx, conn, prover)
 }
 
 // ProcessAuthResults ...
+// returns ServerError if the authentication failed
 func (c *Client) ProcessAuthResults(authResponse *zkp_pb.AuthResponse) error {
-	if authResponse.Result {
-		fmt.Println("Login successful")
-		for {
-			// run infinite loop
-		}
-	} else {
-		if authResponse.Error == "" {
-			fmt.Println("Error: wrong user name or password")
-		} else {
-			fmt.Printf("Error: %s\n", authResponse.Error)
-		}
+	if !authResponse.Result {
+		return newServerError(authResponse.Code, authResponse.RetryAfter, authResponse.Detail)
 	}
-
+	fmt.Println("Login successful")
 	return nil
 }
 
 // ProcessResponse will wait and process server response
-// Very naive command processor
-func (c *Client) ProcessResponse(conn net.Conn) error {
-	msg, err := zkp.ReadMessage(conn)
+// Very naive command processor, prover is nil unless a login is in progress.
+// Returns the last response of the exchange.
+func (c *Client) ProcessResponse(ctx context.Context, conn zkp.MessageConn, prover Prover) (proto.Message, error) {
+	readCtx, cancel := c.withTimeout(ctx)
+	msg, err := conn.ReadMessageContext(readCtx)
+	cancel()
 	if err != nil {
 		fmt.Printf("Error: %s\n", err)
-		return err
+		return nil, err
 	}
 
-	switch string(msg.ProtoReflect().Descriptor().Name()) {
-	case "RegisterResponse":
-		registerResponse, ok := msg.(*zkp_pb.RegisterResponse)
-		if !ok {
-			return WrongResponseError
-		}
-		return c.ProcessRegistrationResults(registerResponse)
-	case "ChallengeResponse":
-		challengeResponse, ok := msg.(*zkp_pb.ChallengeResponse)
-		if !ok {
-			return WrongResponseError
-		}
-		return c.ProcessChallenge(conn, challengeResponse)
-	case "AuthResponse":
-		authResponse, ok := msg.(*zkp_pb.AuthResponse)
-		if !ok {
-			return WrongResponseError
-		}
-		return c.ProcessAuthResults(authResponse)
+	// the frame oneof decides the message type
+	switch response := msg.(type) {
+	case *zkp_pb.RegisterResponse:
+		return response, c.ProcessRegistrationResults(response)
+	case *zkp_pb.ChallengeResponse:
+		return c.ProcessChallenge(ctx, conn, prover, response)
+	case *zkp_pb.AuthResponse:
+		return response, c.ProcessAuthResults(response)
 	}
 
-	return UnknownResponseError
+	return nil, UnknownResponseError
 }
@@ -1,3 +1,197 @@
 package app_test
 
-// todo: write tests
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/client/app"
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingListener counts the accepted connections
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+func TestClient_SharedConnection(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+	listener := &countingListener{Listener: l}
+	server := svr.NewServer()
+	// the failed logins aren't delayed
+	server.Lockout = svr.Lockout{}
+	go server.ServeContext(ctx, listener)
+
+	client := app.NewClient(l.Addr().String())
+	defer client.Close()
+	assert.NoError(client.RegisterContext(ctx, "max", 123))
+
+	// concurrent failing logins share the connection
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(password int) {
+			defer wg.Done()
+			_, err := client.LoginContext(ctx, "max", password)
+			assert.ErrorIs(err, app.AuthFailedError, fmt.Sprint("password ", password))
+		}(124 + i)
+	}
+	wg.Wait()
+	assert.Equal(int32(1), atomic.LoadInt32(&listener.accepted))
+
+	// a new connection after closing, the taken user name is concealed
+	client.Close()
+	assert.NoError(client.RegisterContext(ctx, "max", 123))
+	assert.Equal(int32(2), atomic.LoadInt32(&listener.accepted))
+}
+
+func TestClient_Session(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+	server := svr.NewServer()
+	server.HandleCommand("greet", func(ctx context.Context, user zkp.UUID, payload []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("%s, %s", payload, user)), nil
+	})
+	go server.ServeContext(ctx, l)
+
+	client := app.NewClient(l.Addr().String())
+	defer client.Close()
+	assert.NoError(client.RegisterContext(ctx, "max", 123))
+	session, err := client.LoginContext(ctx, "max", 123)
+	assert.NoError(err)
+	assert.Equal("max", session.User())
+
+	user, err := session.WhoAmI(ctx)
+	assert.NoError(err)
+	assert.Equal("max", user)
+	reply, err := session.Send(ctx, []byte("hello"))
+	assert.NoError(err)
+	assert.Equal([]byte("hello"), reply)
+	reply, err = session.Command(ctx, "greet", []byte("hello"))
+	assert.NoError(err)
+	assert.Equal([]byte("hello, max"), reply)
+	_, err = session.Command(ctx, "unknown", nil)
+	assert.ErrorIs(err, app.InvalidRequestError)
+
+	// the next login uses the new password
+	assert.NoError(session.ChangePassword(ctx, 456))
+	_, err = client.LoginContext(ctx, "max", 123)
+	assert.ErrorIs(err, app.AuthFailedError)
+
+	assert.NoError(session.Logout(ctx))
+	_, err = session.WhoAmI(ctx)
+	assert.ErrorIs(err, app.LoggedOutError)
+
+	// the connection is still usable
+	session, err = client.LoginContext(ctx, "max", 456)
+	assert.NoError(err)
+	user, err = session.WhoAmI(ctx)
+	assert.NoError(err)
+	assert.Equal("max", user)
+
+	// the session ends with the connection
+	client.Close()
+	_, err = session.WhoAmI(ctx)
+	assert.ErrorIs(err, zkp.MuxClosedError)
+}
+
+func TestClient_Token(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	server := svr.NewServer()
+	server.Tokens = token.NewSigner(key)
+	go server.ServeContext(ctx, l)
+
+	client := app.NewClient(l.Addr().String())
+	defer client.Close()
+	assert.NoError(client.RegisterContext(ctx, "max", 123))
+	session, err := client.LoginContext(ctx, "max", 123)
+	assert.NoError(err)
+
+	claims, err := token.Verify(session.Token(), server.Tokens.PublicKey())
+	assert.NoError(err)
+	assert.Equal("max", claims.Subject)
+	assert.Equal(claims.ID, session.ID())
+	assert.Equal(claims.Expires(), session.Expires())
+}
+
+func TestClient_TokenLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(err)
+	server := svr.NewServer()
+	server.Tokens = token.NewSigner(key)
+	go server.ServeContext(ctx, l)
+
+	client := app.NewClient(l.Addr().String())
+	defer client.Close()
+	assert.NoError(client.RegisterContext(ctx, "max", 123))
+	session, err := client.LoginContext(ctx, "max", 123)
+	assert.NoError(err)
+
+	info, err := client.IntrospectContext(ctx, session.Token())
+	assert.NoError(err)
+	assert.True(info.Active)
+	assert.Equal("max", info.User)
+	assert.Equal(session.ID(), info.SessionID)
+
+	// the old refresh token is rejected after the refresh
+	old := session.Tokens()
+	assert.NoError(session.Refresh(ctx))
+	assert.Equal(old.SessionID, session.ID())
+	assert.NotEqual(old.RefreshToken, session.Tokens().RefreshToken)
+	_, err = client.RefreshContext(ctx, old.RefreshToken)
+	assert.ErrorIs(err, app.NotAuthenticatedError)
+
+	sessions, err := session.Sessions(ctx)
+	assert.NoError(err)
+	if assert.Len(sessions, 1) {
+		assert.Equal(session.ID(), sessions[0].ID)
+		assert.True(sessions[0].Current)
+	}
+
+	// the other client revokes the session with its token
+	other := app.NewClient(l.Addr().String())
+	defer other.Close()
+	revoked, err := other.RevokeContext(ctx, session.Token(), "", false)
+	assert.NoError(err)
+	assert.Equal(1, revoked)
+	info, err = client.IntrospectContext(ctx, session.Token())
+	assert.NoError(err)
+	assert.False(info.Active)
+	_, err = session.WhoAmI(ctx)
+	assert.ErrorIs(err, app.NotAuthenticatedError)
+}
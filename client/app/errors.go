@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+// Errors reported by the server, use errors.Is to check the ServerError code
+var (
+	InvalidRequestError     = errors.New("invalid request")
+	UserExistsError         = errors.New("user already exists")
+	AuthFailedError         = errors.New("wrong user name or password")
+	RateLimitedError        = errors.New("too many requests")
+	UnsupportedVersionError = errors.New("unsupported protocol version")
+	TimeoutError            = errors.New("server timeout")
+	InternalError           = errors.New("internal server error")
+	NotAuthenticatedError   = errors.New("login required")
+	PermissionDeniedError   = errors.New("permission denied")
+	UnknownServerError      = errors.New("unknown server error")
+)
+
+type (
+	// ServerError is the failure reported by the server
+	ServerError struct {
+		Code zkp_pb.ErrorCode
+		// RetryAfter is the time to wait before retrying, zero if not set
+		RetryAfter time.Duration
+		// Detail describes what was wrong with the request
+		Detail string
+	}
+)
+
+// codeErrors maps the error codes to the errors
+var codeErrors = map[zkp_pb.ErrorCode]error{
+	zkp_pb.ErrorCode_INVALID_REQUEST:     InvalidRequestError,
+	zkp_pb.ErrorCode_USER_EXISTS:         UserExistsError,
+	zkp_pb.ErrorCode_AUTH_FAILED:         AuthFailedError,
+	zkp_pb.ErrorCode_RATE_LIMITED:        RateLimitedError,
+	zkp_pb.ErrorCode_UNSUPPORTED_VERSION: UnsupportedVersionError,
+	zkp_pb.ErrorCode_TIMEOUT:             TimeoutError,
+	zkp_pb.ErrorCode_INTERNAL:            InternalError,
+	zkp_pb.ErrorCode_UNAUTHENTICATED:     NotAuthenticatedError,
+	zkp_pb.ErrorCode_PERMISSION_DENIED:   PermissionDeniedError,
+}
+
+// newServerError returns the error for the failed response
+func newServerError(code zkp_pb.ErrorCode, retryAfter uint32, detail string) *ServerError {
+	return &ServerError{
+		Code:       code,
+		RetryAfter: time.Duration(retryAfter) * time.Second,
+		Detail:     detail,
+	}
+}
+
+func (e *ServerError) Error() string {
+	message := e.Unwrap().Error()
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	return message
+}
+
+// Unwrap returns the error matching the code
+func (e *ServerError) Unwrap() error {
+	if err, ok := codeErrors[e.Code]; ok {
+		return err
+	}
+	return UnknownServerError
+}
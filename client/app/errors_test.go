@@ -0,0 +1,68 @@
+package app_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/client/app"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerError(t *testing.T) {
+	tests := map[string]struct {
+		err      *app.ServerError
+		expected error
+		message  string
+	}{
+		"user exists": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode_USER_EXISTS},
+			expected: app.UserExistsError,
+			message:  "user already exists",
+		},
+		"auth failed": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode_AUTH_FAILED},
+			expected: app.AuthFailedError,
+			message:  "wrong user name or password",
+		},
+		"invalid request with detail": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode_INVALID_REQUEST, Detail: "missing commits"},
+			expected: app.InvalidRequestError,
+			message:  "invalid request: missing commits",
+		},
+		"rate limited": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode_RATE_LIMITED, RetryAfter: time.Second},
+			expected: app.RateLimitedError,
+			message:  "too many requests",
+		},
+		"not authenticated": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode_UNAUTHENTICATED},
+			expected: app.NotAuthenticatedError,
+			message:  "login required",
+		},
+		"permission denied": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode_PERMISSION_DENIED},
+			expected: app.PermissionDeniedError,
+			message:  "permission denied",
+		},
+		"unknown code": {
+			err:      &app.ServerError{Code: zkp_pb.ErrorCode(100)},
+			expected: app.UnknownServerError,
+			message:  "unknown server error",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			var err error = test.err
+			assert.ErrorIs(err, test.expected)
+			assert.Equal(test.message, err.Error())
+
+			var serverError *app.ServerError
+			assert.True(errors.As(err, &serverError))
+			assert.Equal(test.err.Code, serverError.Code)
+		})
+	}
+}
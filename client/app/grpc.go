@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// dialGRPC connects to the ZKPAuth gRPC service
+func (c *Client) dialGRPC(ctx context.Context) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if c.TLSConfig != nil {
+		creds = credentials.NewTLS(c.TLSConfig)
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return grpc.DialContext(ctx, c.serverAddr, grpc.WithTransportCredentials(creds), grpc.WithBlock())
+}
+
+// registerGRPC sends the registration request to the gRPC service
+func (c *Client) registerGRPC(ctx context.Context, request *zkp_pb.RegisterRequest) error {
+	conn, err := c.dialGRPC(ctx)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return err
+	}
+	defer conn.Close()
+
+	callCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	response, err := zkp_pb.NewZKPAuthClient(conn).Register(callCtx, request)
+	if status.Code(err) == codes.InvalidArgument {
+		return newServerError(zkp_pb.ErrorCode_INVALID_REQUEST, 0, status.Convert(err).Message())
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return err
+	}
+
+	return c.ProcessRegistrationResults(response)
+}
+
+// loginGRPC runs the authentication over the gRPC stream
+func (c *Client) loginGRPC(ctx context.Context, prover Prover, authRequest *zkp_pb.AuthRequest) (proto.Message, error) {
+	conn, err := c.dialGRPC(ctx)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return nil, err
+	}
+	defer conn.Close()
+
+	// the stream lives until the login is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := zkp_pb.NewZKPAuthClient(conn).Authenticate(ctx)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return nil, err
+	}
+	streamConn := zkp.NewGRPCClientConn(stream)
+
+	// send request
+	if err := c.send(ctx, streamConn, authRequest); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return nil, err
+	}
+
+	return c.ProcessResponse(ctx, streamConn, prover)
+}
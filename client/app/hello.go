@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+// hello negotiates the protocol parameters with the server
+// returns ServerError if the server rejected the hello
+// and zkp.NegotiationError if the server chose parameters the client doesn't support
+func (c *Client) hello(ctx context.Context, framer *zkp.Framer) error {
+	framer.RequireHello = true
+	if err := c.send(ctx, framer, c.Capabilities.Hello()); err != nil {
+		return err
+	}
+
+	readCtx, cancel := c.withTimeout(ctx)
+	msg, err := framer.ReadMessageContext(readCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	response, ok := msg.(*zkp_pb.HelloResponse)
+	if !ok {
+		return WrongResponseError
+	}
+	if !response.Result {
+		return newServerError(response.Code, response.RetryAfter, response.Detail)
+	}
+	return c.Capabilities.Check(response)
+}
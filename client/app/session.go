@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	SessionUnsupportedError = errors.New("the transport doesn't support sessions")
+	LoggedOutError          = errors.New("logged out")
+)
+
+type (
+	// Session is the login of the user on the client connection
+	// The session requests share the connection with the other exchanges of the client.
+	// The session ends when the connection fails or is closed, or the user logs out.
+	// The next login of the client replaces the user logged in on the connection.
+	Session struct {
+		client *Client
+		user   string
+
+		mu sync.Mutex
+		// empty if the server doesn't issue tokens
+		tokens Tokens
+		// the connection the login ran on, nil if the transport has no sessions or after the logout
+		mux *zkp.Mux
+	}
+
+	// Tokens are the signed session token and the refresh token issued by the server
+	Tokens struct {
+		// Token is verified by the other services with token.Verify
+		Token string
+		// RefreshToken is exchanged for the new tokens by Refresh
+		RefreshToken string
+		SessionID    string
+		// Expires is the token expiration time
+		Expires time.Time
+	}
+)
+
+// newSession returns the session of the successful login
+// returns WrongResponseError if the login didn't end with AuthResponse
+func (c *Client) newSession(user string, mux *zkp.Mux, msg proto.Message) (*Session, error) {
+	authResponse, ok := msg.(*zkp_pb.AuthResponse)
+	if !ok {
+		return nil, WrongResponseError
+	}
+	return &Session{
+		client: c,
+		user:   user,
+		tokens: newTokens(authResponse.Token, authResponse.RefreshToken, authResponse.SessionId, authResponse.ExpiresAt),
+		mux:    mux,
+	}, nil
+}
+
+// newTokens returns the tokens of the response, expiresAt is the unix time
+func newTokens(token, refreshToken, sessionID string, expiresAt int64) Tokens {
+	tokens := Tokens{
+		Token:        token,
+		RefreshToken: refreshToken,
+		SessionID:    sessionID,
+	}
+	if expiresAt != 0 {
+		tokens.Expires = time.Unix(expiresAt, 0)
+	}
+	return tokens
+}
+
+// User returns the user logged in
+func (s *Session) User() string {
+	return s.user
+}
+
+// Tokens returns the session tokens, empty if the server doesn't issue tokens
+func (s *Session) Tokens() Tokens {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens
+}
+
+// Token returns the signed session token, empty if the server doesn't issue tokens
+// Other services verify it with token.Verify.
+func (s *Session) Token() string {
+	return s.Tokens().Token
+}
+
+// ID returns the session id set in the token
+func (s *Session) ID() string {
+	return s.Tokens().SessionID
+}
+
+// Expires returns the token expiration time, zero if the server doesn't issue tokens
+func (s *Session) Expires() time.Time {
+	return s.Tokens().Expires
+}
+
+// Refresh replaces the expiring session tokens
+func (s *Session) Refresh(ctx context.Context) error {
+	tokens, err := s.client.RefreshContext(ctx, s.Tokens().RefreshToken)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.tokens = *tokens
+	s.mu.Unlock()
+	return nil
+}
+
+// WhoAmI asks the server for the user logged in on the connection
+func (s *Session) WhoAmI(ctx context.Context) (string, error) {
+	msg, err := s.request(ctx, &zkp_pb.WhoAmIRequest{})
+	if err != nil {
+		return "", err
+	}
+	response, ok := msg.(*zkp_pb.WhoAmIResponse)
+	if !ok {
+		return "", UnknownResponseError
+	}
+	if !response.Result {
+		return "", newServerError(response.Code, 0, response.Detail)
+	}
+	return response.User, nil
+}
+
+// ChangePassword replaces the password of the user logged in
+// The session stays logged in, the next login uses the new password.
+func (s *Session) ChangePassword(ctx context.Context, password int) error {
+	prover := zkp.NewProver(int64(password))
+	commits, err := prover.CreateRegisterCommits()
+	if err != nil {
+		return err
+	}
+	log.Printf("y1=%v, y2=%v", commits.C1, commits.C2)
+
+	msg, err := s.request(ctx, &zkp_pb.ChangePasswordRequest{
+		Commits: []*zkp_pb.RegisterRequest_Commits{
+			{
+				Y1: commits.C1.Bytes(),
+				Y2: commits.C2.Bytes(),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	response, ok := msg.(*zkp_pb.ChangePasswordResponse)
+	if !ok {
+		return UnknownResponseError
+	}
+	if !response.Result {
+		return newServerError(response.Code, response.RetryAfter, response.Detail)
+	}
+	return nil
+}
+
+// Sessions lists the active sessions of the user logged in
+func (s *Session) Sessions(ctx context.Context) ([]SessionInfo, error) {
+	return sessionsResult(s.request(ctx, &zkp_pb.SessionsRequest{}))
+}
+
+// Send sends the application message returning the server reply
+func (s *Session) Send(ctx context.Context, payload []byte) ([]byte, error) {
+	return s.Command(ctx, "", payload)
+}
+
+// Command runs the application command registered by the server with HandleCommand, returning its reply
+// The empty command is the default application handler, see Send.
+func (s *Session) Command(ctx context.Context, command string, payload []byte) ([]byte, error) {
+	msg, err := s.request(ctx, &zkp_pb.AppRequest{Payload: payload, Command: command})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := msg.(*zkp_pb.AppResponse)
+	if !ok {
+		return nil, UnknownResponseError
+	}
+	if !response.Result {
+		return nil, newServerError(response.Code, response.RetryAfter, response.Detail)
+	}
+	return response.Payload, nil
+}
+
+// Unlock forgets the failed logins of the user locked out, the logged in user has to be the server admin
+func (s *Session) Unlock(ctx context.Context, user string) error {
+	_, err := s.Command(ctx, "unlock", []byte(user))
+	return err
+}
+
+// Logout ends the session, the connection stays open for the other exchanges
+// returns LoggedOutError if the session has already ended.
+func (s *Session) Logout(ctx context.Context) error {
+	msg, err := s.request(ctx, &zkp_pb.LogoutRequest{})
+	if err != nil {
+		return err
+	}
+	response, ok := msg.(*zkp_pb.LogoutResponse)
+	if !ok {
+		return UnknownResponseError
+	}
+	if !response.Result {
+		return newServerError(response.Code, 0, response.Detail)
+	}
+	s.mu.Lock()
+	s.mux = nil
+	s.mu.Unlock()
+	return nil
+}
+
+// request sends the session request on the connection of the login
+func (s *Session) request(ctx context.Context, request proto.Message) (proto.Message, error) {
+	s.mu.Lock()
+	mux := s.mux
+	s.mu.Unlock()
+	if s.client.Transport == GRPCTransport {
+		return nil, SessionUnsupportedError
+	}
+	if mux == nil {
+		return nil, LoggedOutError
+	}
+	return s.client.exchange(ctx, mux, request)
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// TokenInfo is the state of the session token reported by the server
+	TokenInfo struct {
+		// Active is false if the token is invalid, expired or revoked, the other fields are empty then
+		Active      bool
+		User        string
+		SessionID   string
+		IssuedAt    time.Time
+		ExpiresAt   time.Time
+		AuthMethods []string
+	}
+
+	// SessionInfo describes the active session of the user
+	SessionInfo struct {
+		ID       string
+		IssuedAt time.Time
+		// ExpiresAt ends the session, the token can't be refreshed after
+		ExpiresAt time.Time
+		// Current is the session of the request
+		Current bool
+	}
+)
+
+// IntrospectContext asks the server for the state of the session token
+func (c *Client) IntrospectContext(ctx context.Context, token string) (*TokenInfo, error) {
+	msg, err := c.request(ctx, &zkp_pb.IntrospectRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := msg.(*zkp_pb.IntrospectResponse)
+	if !ok {
+		return nil, UnknownResponseError
+	}
+	if !response.Result {
+		return nil, newServerError(response.Code, 0, response.Detail)
+	}
+	if !response.Active {
+		return &TokenInfo{}, nil
+	}
+	return &TokenInfo{
+		Active:      true,
+		User:        response.User,
+		SessionID:   response.SessionId,
+		IssuedAt:    time.Unix(response.IssuedAt, 0),
+		ExpiresAt:   time.Unix(response.ExpiresAt, 0),
+		AuthMethods: response.AuthMethods,
+	}, nil
+}
+
+// RefreshContext exchanges the refresh token for the new tokens of the session
+// The refresh token is rejected afterwards, use the returned one next time.
+func (c *Client) RefreshContext(ctx context.Context, refreshToken string) (*Tokens, error) {
+	msg, err := c.request(ctx, &zkp_pb.RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return nil, err
+	}
+	response, ok := msg.(*zkp_pb.RefreshResponse)
+	if !ok {
+		return nil, UnknownResponseError
+	}
+	if !response.Result {
+		return nil, newServerError(response.Code, response.RetryAfter, response.Detail)
+	}
+	tokens := newTokens(response.Token, response.RefreshToken, response.SessionId, response.ExpiresAt)
+	return &tokens, nil
+}
+
+// RevokeContext ends the sessions of the user authenticated by the token,
+// or by the login on the client connection if the token is empty
+// sessionID selects the session to revoke, the one of the token if empty. all revokes all sessions of the user.
+// Returns the number of the revoked sessions.
+func (c *Client) RevokeContext(ctx context.Context, token, sessionID string, all bool) (int, error) {
+	msg, err := c.request(ctx, &zkp_pb.RevokeRequest{Token: token, SessionId: sessionID, All: all})
+	if err != nil {
+		return 0, err
+	}
+	response, ok := msg.(*zkp_pb.RevokeResponse)
+	if !ok {
+		return 0, UnknownResponseError
+	}
+	if !response.Result {
+		return 0, newServerError(response.Code, 0, response.Detail)
+	}
+	return int(response.Revoked), nil
+}
+
+// SessionsContext lists the active sessions of the user authenticated by the token,
+// or by the login on the client connection if the token is empty
+func (c *Client) SessionsContext(ctx context.Context, token string) ([]SessionInfo, error) {
+	return sessionsResult(c.request(ctx, &zkp_pb.SessionsRequest{Token: token}))
+}
+
+// sessionsResult returns the sessions of the response
+func sessionsResult(msg proto.Message, err error) ([]SessionInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	response, ok := msg.(*zkp_pb.SessionsResponse)
+	if !ok {
+		return nil, UnknownResponseError
+	}
+	if !response.Result {
+		return nil, newServerError(response.Code, 0, response.Detail)
+	}
+	sessions := make([]SessionInfo, 0, len(response.Sessions))
+	for _, session := range response.Sessions {
+		sessions = append(sessions, SessionInfo{
+			ID:        session.Id,
+			IssuedAt:  time.Unix(session.IssuedAt, 0),
+			ExpiresAt: time.Unix(session.ExpiresAt, 0),
+			Current:   session.Current,
+		})
+	}
+	return sessions, nil
+}
+
+// request sends the request on the shared connection and waits for the response
+func (c *Client) request(ctx context.Context, request proto.Message) (proto.Message, error) {
+	if c.Transport == GRPCTransport {
+		return nil, SessionUnsupportedError
+	}
+	mux, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.exchange(ctx, mux, request)
+}
+
+// exchange sends the request on a new stream of the connection and waits for the response
+func (c *Client) exchange(ctx context.Context, mux *zkp.Mux, request proto.Message) (proto.Message, error) {
+	stream, err := mux.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if err := c.send(ctx, stream, request); err != nil {
+		return nil, err
+	}
+	readCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return stream.ReadMessageContext(readCtx)
+}
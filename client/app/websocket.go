@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// webSocketURL returns the WebSocket endpoint URL
+// The server address is either host:port or the full ws:// or wss:// URL.
+func (c *Client) webSocketURL() string {
+	if strings.HasPrefix(c.serverAddr, "ws://") || strings.HasPrefix(c.serverAddr, "wss://") {
+		return c.serverAddr
+	}
+	scheme := "ws://"
+	if c.TLSConfig != nil {
+		scheme = "wss://"
+	}
+	return scheme + c.serverAddr + "/ws"
+}
+
+// dialWebSocket connects to the server WebSocket endpoint
+func (c *Client) dialWebSocket(ctx context.Context) (net.Conn, error) {
+	dialer := websocket.Dialer{
+		TLSClientConfig: c.TLSConfig,
+	}
+	ws, _, err := dialer.DialContext(ctx, c.webSocketURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return zkp.NewWebSocketConn(ws), nil
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/mindaugasrukas/zkp_example/client/app"
 	"github.com/spf13/cobra"
@@ -12,8 +14,9 @@ import (
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login ",
+	Long: `Login and run the session commands read from the standard input
+until the end of the input, logout or interrupt.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		server := cmd.Flag("server").Value.String()
 		user := cmd.Flag("username").Value.String()
 		password, err := strconv.Atoi(cmd.Flag("password").Value.String())
 		if err != nil {
@@ -21,11 +24,29 @@ var loginCmd = &cobra.Command{
 			return
 		}
 
-		client := app.NewClient(server)
-		if err = client.Login(user, password); err != nil {
+		client, err := newClient(cmd)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		defer client.Close()
+		session, err := client.LoginContext(cmd.Context(), user, password)
+		if err != nil {
 			fmt.Printf("Error: %s\n", err)
 			return
 		}
+		if session.Token() != "" {
+			fmt.Printf("Session %s expires at %s\n", session.ID(), session.Expires().Format(time.RFC3339))
+			if printToken, _ := cmd.Flags().GetBool("print-token"); printToken {
+				fmt.Printf("Token: %s\n", session.Token())
+				fmt.Printf("Refresh token: %s\n", session.Tokens().RefreshToken)
+			}
+		}
+		if client.Transport == app.GRPCTransport {
+			// nothing more to do on the gRPC service
+			return
+		}
+		runSession(cmd.Context(), session, os.Stdin)
 	},
 }
 
@@ -41,5 +62,7 @@ func init() {
 	viper.BindPFlag("password", flags.Lookup("password"))
 	// todo: set required field and validate input
 
+	loginCmd.Flags().Bool("print-token", false, "print the signed session token and the refresh token")
+
 	rootCmd.AddCommand(loginCmd)
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke the session of the token",
+	Run: func(cmd *cobra.Command, args []string) {
+		token := cmd.Flag("token").Value.String()
+		if token == "" {
+			fmt.Println("Error: the token is required")
+			return
+		}
+		sessionID := cmd.Flag("session").Value.String()
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+
+		client, err := newClient(cmd)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		defer client.Close()
+		revoked, err := client.RevokeContext(cmd.Context(), token, sessionID, all)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		fmt.Printf("Revoked %d session(s)\n", revoked)
+	},
+}
+
+func init() {
+	viper.AutomaticEnv()
+
+	logoutCmd.Flags().String("token", viper.GetString("TOKEN"), "session token (env: TOKEN)")
+	logoutCmd.Flags().String("session", "", "id of the session to revoke, the session of the token if empty")
+	logoutCmd.Flags().Bool("all", false, "revoke all sessions of the user")
+
+	rootCmd.AddCommand(logoutCmd)
+}
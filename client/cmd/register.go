@@ -5,7 +5,6 @@ import (
 	"log"
 	"strconv"
 
-	"github.com/mindaugasrukas/zkp_example/client/app"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -14,7 +13,6 @@ var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register ",
 	Run: func(cmd *cobra.Command, args []string) {
-		server := cmd.Flag("server").Value.String()
 		user := cmd.Flag("username").Value.String()
 		password, err := strconv.Atoi(cmd.Flag("password").Value.String())
 		log.Print("password = ", password)
@@ -23,8 +21,13 @@ var registerCmd = &cobra.Command{
 			return
 		}
 
-		client := app.NewClient(server)
-		if err = client.Register(user, password); err != nil {
+		client, err := newClient(cmd)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		defer client.Close()
+		if err = client.RegisterContext(cmd.Context(), user, password); err != nil {
 			fmt.Printf("Error: %s\n", err)
 			return
 		}
@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/mindaugasrukas/zkp_example/capture"
+	"github.com/mindaugasrukas/zkp_example/client/app"
+	"github.com/mindaugasrukas/zkp_example/tlsutil"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -29,15 +36,84 @@ var (
 func init() {
 	viper.AutomaticEnv()
 	flags := rootCmd.PersistentFlags()
-	flags.StringP("server", "s", viper.GetString("SERVER"), "server URL (env: SERVER)")
+	flags.StringP("server", "s", viper.GetString("SERVER"), "server address host:port or unix:///path (env: SERVER)")
 	viper.BindPFlag("server", flags.Lookup("server"))
 	// todo: set required field and validate input
 	flags.BoolP("verbose", "v", false, "verbose mode")
 	viper.BindPFlag("verbose", flags.Lookup("verbose"))
+	flags.DurationP("timeout", "t", app.DefaultTimeout, "network operation timeout, 0 - no timeout")
+	viper.BindPFlag("timeout", flags.Lookup("timeout"))
+
+	flags.String("transport", string(app.TCPTransport), "server protocol: tcp, grpc or websocket")
+	viper.BindPFlag("transport", flags.Lookup("transport"))
+
+	flags.Bool("tls", false, "connect using TLS")
+	flags.String("tls-ca", "", "CA file to verify the server certificate, system roots if empty")
+	flags.String("tls-cert", "", "client certificate file for the mutual TLS")
+	flags.String("tls-key", "", "client private key file for the mutual TLS")
+	flags.String("tls-server-name", "", "server name to verify the certificate against")
+	flags.String("tls-pin", "", "hex SHA-256 fingerprint of the server public key")
+
+	flags.String("record", "", "record the protocol frames to the file")
+}
+
+// tlsConfig returns the client TLS configuration from the command flags, nil if TLS is disabled
+func tlsConfig(cmd *cobra.Command) (*tls.Config, error) {
+	flags := cmd.Flags()
+	options := tlsutil.ClientOptions{
+		CAFile:     flags.Lookup("tls-ca").Value.String(),
+		CertFile:   flags.Lookup("tls-cert").Value.String(),
+		KeyFile:    flags.Lookup("tls-key").Value.String(),
+		ServerName: flags.Lookup("tls-server-name").Value.String(),
+		Pin:        flags.Lookup("tls-pin").Value.String(),
+	}
+	enabled, err := flags.GetBool("tls")
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && options == (tlsutil.ClientOptions{}) {
+		return nil, nil
+	}
+	return tlsutil.ClientConfig(options)
+}
+
+// newClient returns a new client configured from the command flags
+func newClient(cmd *cobra.Command) (*app.Client, error) {
+	server := cmd.Flag("server").Value.String()
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, err
+	}
+	transport := app.Transport(cmd.Flag("transport").Value.String())
+	switch transport {
+	case app.TCPTransport, app.GRPCTransport, app.WebSocketTransport:
+	default:
+		return nil, fmt.Errorf("unknown transport %q", transport)
+	}
+	config, err := tlsConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	client := app.NewClient(server)
+	client.Timeout = timeout
+	client.TLSConfig = config
+	client.Transport = transport
+	if path := cmd.Flag("record").Value.String(); path != "" {
+		// the file is closed on exit
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		client.Recorder = capture.NewRecorder(f)
+	}
+	return client, nil
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// cancel the running command on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/client/app"
+)
+
+// sessionHelp lists the session commands
+const sessionHelp = `Commands:
+  whoami             show the user logged in
+  passwd <password>  change the password
+  send <message>     send the application message
+  sessions           list the active sessions
+  refresh            refresh the session token
+  unlock <user>      unlock the user locked out by the failed logins, admins only
+  stats              show the server connection metrics, admins only
+  logout             log out and exit
+  quit               exit`
+
+// runSession runs the session commands read from the input until the end of the input,
+// logout or cancelled context
+func runSession(ctx context.Context, session *app.Session, in io.Reader) {
+	fmt.Println(sessionHelp)
+
+	// read in the background so the interrupt isn't blocked by the input
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				return
+			}
+			line = l
+		case <-ctx.Done():
+			return
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch command {
+		case "":
+		case "whoami":
+			user, err := session.WhoAmI(ctx)
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Println(user)
+		case "passwd":
+			password, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			if err := session.ChangePassword(ctx, password); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Println("Password changed")
+		case "send":
+			reply, err := session.Send(ctx, []byte(arg))
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Println(string(reply))
+		case "sessions":
+			sessions, err := session.Sessions(ctx)
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			for _, s := range sessions {
+				current := ""
+				if s.Current {
+					current = " (current)"
+				}
+				fmt.Printf("%s expires %s%s\n", s.ID, s.ExpiresAt.Format(time.RFC3339), current)
+			}
+		case "refresh":
+			if err := session.Refresh(ctx); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Printf("Token refreshed, expires at %s\n", session.Expires().Format(time.RFC3339))
+		case "unlock":
+			if err := session.Unlock(ctx, strings.TrimSpace(arg)); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Println("User unlocked")
+		case "stats":
+			stats, err := session.Command(ctx, "stats", nil)
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Println(string(stats))
+		case "logout":
+			if err := session.Logout(ctx); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			fmt.Println("Logout successful")
+			return
+		case "quit", "exit":
+			return
+		default:
+			fmt.Printf("Error: unknown command %q\n", command)
+			fmt.Println(sessionHelp)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List the active sessions of the token user",
+	Run: func(cmd *cobra.Command, args []string) {
+		token := cmd.Flag("token").Value.String()
+		if token == "" {
+			fmt.Println("Error: the token is required")
+			return
+		}
+
+		client, err := newClient(cmd)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		defer client.Close()
+		sessions, err := client.SessionsContext(cmd.Context(), token)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		for _, session := range sessions {
+			current := ""
+			if session.Current {
+				current = " (current)"
+			}
+			fmt.Printf("%s issued %s expires %s%s\n", session.ID,
+				session.IssuedAt.Format(time.RFC3339), session.ExpiresAt.Format(time.RFC3339), current)
+		}
+	},
+}
+
+func init() {
+	viper.AutomaticEnv()
+
+	sessionsCmd.Flags().String("token", viper.GetString("TOKEN"), "session token (env: TOKEN)")
+
+	rootCmd.AddCommand(sessionsCmd)
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+type (
+	// Field is the message field
+	Field struct {
+		Name string
+		// Value is a scalar, Number, Fields or a list of them
+		Value interface{}
+	}
+
+	// Fields keeps the message fields in the declaration order
+	Fields []Field
+
+	// Number is the big integer in decimal and hex
+	Number struct {
+		Dec string `json:"dec"`
+		Hex string `json:"hex"`
+	}
+)
+
+// NewNumber returns the number representation of the big integer
+func NewNumber(n *big.Int) Number {
+	return Number{
+		Dec: n.Text(10),
+		Hex: "0x" + n.Text(16),
+	}
+}
+
+func (n Number) String() string {
+	return fmt.Sprintf("%s (%s)", n.Dec, n.Hex)
+}
+
+// MarshalJSON encodes the fields as JSON object keeping the field order
+func (f Fields) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(field.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// WriteText writes the human readable packets
+func WriteText(w io.Writer, source string, packets []*Packet) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d packet(s)\n", source, len(packets))
+	for i, packet := range packets {
+		fmt.Fprintf(&b, "#%d offset=%d size=%d", i, packet.Offset, packet.Size)
+		if packet.Stream != 0 {
+			fmt.Fprintf(&b, " stream=%d", packet.Stream)
+		}
+		if packet.Name != "" {
+			fmt.Fprintf(&b, " %s", packet.Name)
+		}
+		b.WriteByte('\n')
+		if packet.Error != "" {
+			fmt.Fprintf(&b, "  ERROR: %s\n", packet.Error)
+		}
+		writeFields(&b, packet.Message, "  ")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFields(b *strings.Builder, fields Fields, indent string) {
+	for _, field := range fields {
+		writeValue(b, field.Name, field.Value, indent)
+	}
+}
+
+func writeValue(b *strings.Builder, name string, value interface{}, indent string) {
+	switch v := value.(type) {
+	case Fields:
+		fmt.Fprintf(b, "%s%s:\n", indent, name)
+		writeFields(b, v, indent+"  ")
+	case []interface{}:
+		for i, item := range v {
+			writeValue(b, fmt.Sprintf("%s[%d]", name, i), item, indent)
+		}
+	case string:
+		fmt.Fprintf(b, "%s%s: %q\n", indent, name, v)
+	default:
+		fmt.Fprintf(b, "%s%s: %v\n", indent, name, v)
+	}
+}
+
+// WriteJSON writes the packets as a JSON object per line
+func WriteJSON(w io.Writer, source string, packets []*Packet) error {
+	encoder := json.NewEncoder(w)
+	for _, packet := range packets {
+		line := struct {
+			Source string `json:"source"`
+			*Packet
+		}{source, packet}
+		if err := encoder.Encode(&line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// maxHexLine limits the length of the hex dump line
+const maxHexLine = 1024 * 1024
+
+var (
+	// xxdOffset matches the offset column of xxd: "00000010: "
+	xxdOffset = regexp.MustCompile(`^[0-9a-fA-F]{8}:\s`)
+	// hexdumpOffset matches the offset column of hexdump -C: "00000010  "
+	hexdumpOffset = regexp.MustCompile(`^[0-9a-fA-F]{8}(\s\s|$)`)
+)
+
+// ParseHexDump decodes plain hex, xxd or hexdump -C output into bytes
+// Offset and ASCII columns are dropped, whitespace and "0x" prefixes are ignored.
+// Use od -An -tx1 to get plain hex from od.
+func ParseHexDump(r io.Reader) ([]byte, error) {
+	var digits strings.Builder
+	scanner := bufio.NewScanner(r)
+	// plain hex may be a single long line
+	scanner.Buffer(nil, maxHexLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		switch {
+		case xxdOffset.MatchString(text):
+			text = xxdOffset.ReplaceAllString(text, "")
+			// the ASCII column follows two spaces
+			if i := strings.Index(text, "  "); i >= 0 {
+				text = text[:i]
+			}
+		case hexdumpOffset.MatchString(text):
+			text = hexdumpOffset.ReplaceAllString(text, "")
+			// the ASCII column is enclosed in |
+			if i := strings.Index(text, "|"); i >= 0 {
+				text = text[:i]
+			}
+		}
+		for _, token := range strings.Fields(text) {
+			token = strings.TrimPrefix(strings.TrimPrefix(token, "0x"), "0X")
+			if _, err := hex.DecodeString(token); err != nil {
+				return nil, fmt.Errorf("line %d: invalid hex %q", line, token)
+			}
+			digits.WriteString(token)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(digits.String())
+}
@@ -0,0 +1,39 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/inspect/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHexDump(t *testing.T) {
+	expected := []byte{0x40, 0, 0, 0, 0x0a, 0x0d, 0x41, 0x6e, 0x73, 0x77, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73}
+	tests := map[string]string{
+		"plain":     "40000000 0a0d416e7377\n6572526571756573\n",
+		"spaced":    " 40 00 00 00 0a 0d 41 6e 73 77 65 72 52 65 71 75\n 65 73\n",
+		"0x prefix": "0x40 0x00 0x00 0x00 0x0a 0x0d 0x41 0x6e 0x73 0x77 0x65 0x72 0x52 0x65 0x71 0x75 0x65 0x73",
+		"xxd": "00000000: 4000 0000 0a0d 416e 7377 6572 5265 7175  @.....AnswerRequ\n" +
+			"00000010: 6573                                     es\n",
+		"hexdump -C": "00000000  40 00 00 00 0a 0d 41 6e  73 77 65 72 52 65 71 75  |@.....AnswerRequ|\n" +
+			"00000010  65 73                                             |es|\n" +
+			"00000012\n",
+	}
+
+	for name, dump := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			data, err := app.ParseHexDump(strings.NewReader(dump))
+			assert.NoError(err)
+			assert.Equal(expected, data)
+		})
+	}
+}
+
+func TestParseHexDump_Errors(t *testing.T) {
+	for _, dump := range []string{"4g", "400", "40 0"} {
+		_, err := app.ParseHexDump(strings.NewReader(dump))
+		assert.Error(t, err, dump)
+	}
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	TruncatedPacketError = errors.New("truncated packet")
+)
+
+type (
+	// Packet is the inspected packet of the stream
+	Packet struct {
+		// Offset of the packet header in the stream
+		Offset int `json:"offset"`
+		// Size of the packet content announced by the header
+		Size int `json:"size"`
+		// Stream the message belongs to, 0 is the connection stream
+		Stream uint32 `json:"stream,omitempty"`
+		// Name of the carried message
+		Name string `json:"name,omitempty"`
+		// Message fields in the declaration order
+		Message Fields `json:"message,omitempty"`
+		// Error describes the malformed packet
+		Error string `json:"error,omitempty"`
+	}
+)
+
+// Inspect decodes the length-prefixed frame stream, legacy envelopes included
+// The packets are read the same way as zkp.ReadMessage does.
+// A malformed frame is reported and the inspection continues with the next packet,
+// a framing error ends the inspection as the position of the next packet is unknown.
+func Inspect(data []byte, maxSize uint32) []*Packet {
+	framer := zkp.NewFramer(bytes.NewReader(data), nil)
+	framer.MaxFrameSize = maxSize
+
+	var packets []*Packet
+	offset := 0
+	for {
+		content, err := framer.ReadFrame()
+		if err == io.EOF {
+			return packets
+		}
+		packet := &Packet{Offset: offset}
+		packets = append(packets, packet)
+		if err != nil {
+			packet.Size, packet.Error = framingError(data[offset:], err)
+			return packets
+		}
+		packet.Size = len(content)
+		offset += zkp.FrameHeaderSize + len(content)
+
+		stream, msg, err := framer.Codec.DecodeStream(content)
+		packet.Stream = stream
+		if err != nil {
+			packet.Error = err.Error()
+			continue
+		}
+		packet.Name = zkp.MessageName(msg)
+		packet.Message = MessageFields(msg)
+	}
+}
+
+// framingError describes why the packet at the start of data can't be read
+func framingError(data []byte, err error) (size int, description string) {
+	if len(data) < zkp.FrameHeaderSize {
+		return 0, fmt.Sprintf("%v: %d of %d header bytes", TruncatedPacketError, len(data), zkp.FrameHeaderSize)
+	}
+	size = int(binary.LittleEndian.Uint32(data))
+	if err == io.ErrUnexpectedEOF {
+		available := len(data) - zkp.FrameHeaderSize
+		return size, fmt.Sprintf("%v: %d of %d content bytes", TruncatedPacketError, available, size)
+	}
+	return size, err.Error()
+}
+
+// MessageFields returns the populated message fields
+// Bytes fields carry big integers and are decoded as Number.
+func MessageFields(msg proto.Message) Fields {
+	var fields Fields
+	m := msg.ProtoReflect()
+	descriptors := m.Descriptor().Fields()
+	for i := 0; i < descriptors.Len(); i++ {
+		fd := descriptors.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		fields = append(fields, Field{
+			Name:  string(fd.Name()),
+			Value: fieldValue(fd, m.Get(fd)),
+		})
+	}
+	return fields
+}
+
+func fieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	if fd.IsList() {
+		list := v.List()
+		values := make([]interface{}, list.Len())
+		for i := range values {
+			values[i] = singularValue(fd, list.Get(i))
+		}
+		return values
+	}
+	return singularValue(fd, v)
+}
+
+func singularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return MessageFields(v.Message().Interface())
+	case protoreflect.BytesKind:
+		return NewNumber(new(big.Int).SetBytes(v.Bytes()))
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name())
+		}
+		return int32(v.Enum())
+	}
+	return v.Interface()
+}
@@ -0,0 +1,151 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/inspect/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestPacket(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(path.Join("../../zkp/testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestInspect(t *testing.T) {
+	assert := assert.New(t)
+	var stream []byte
+	stream = append(stream, readTestPacket(t, "register_request_packet.bin")...)
+	stream = append(stream, readTestPacket(t, "challenge_response_packet.bin")...)
+
+	packets := app.Inspect(stream, zkp.DefaultMaxFrameSize)
+	assert.Len(packets, 2)
+
+	assert.Equal(0, packets[0].Offset)
+	assert.Equal(78, packets[0].Size)
+	assert.Equal("RegisterRequest", packets[0].Name)
+	assert.Empty(packets[0].Error)
+	assert.Equal(app.Fields{
+		{Name: "user", Value: "max"},
+		{Name: "commits", Value: []interface{}{
+			app.Fields{
+				{Name: "y1", Value: app.Number{Dec: "16", Hex: "0x10"}},
+				{Name: "y2", Value: app.Number{Dec: "12", Hex: "0xc"}},
+			},
+		}},
+	}, packets[0].Message)
+
+	assert.Equal(82, packets[1].Offset)
+	assert.Equal("ChallengeResponse", packets[1].Name)
+}
+
+func TestInspect_Errors(t *testing.T) {
+	packet := readTestPacket(t, "auth_request_packet.bin")
+	garbage := []byte{3, 0, 0, 0, 0xff, 0xff, 0xff}
+
+	tests := map[string]struct {
+		stream   []byte
+		expected []string
+	}{
+		"truncated header": {
+			stream:   packet[:2],
+			expected: []string{"truncated packet: 2 of 4 header bytes"},
+		},
+		"truncated content": {
+			stream:   packet[:10],
+			expected: []string{"truncated packet: 6 of 70 content bytes"},
+		},
+		"truncated second packet": {
+			stream:   append(append([]byte{}, packet...), packet[:5]...),
+			expected: []string{"", "truncated packet: 1 of 70 content bytes"},
+		},
+		"malformed envelope continues": {
+			stream:   append(append([]byte{}, garbage...), packet...),
+			expected: []string{"proto", ""},
+		},
+		"too large": {
+			stream:   []byte{0, 0, 0, 1},
+			expected: []string{zkp.FrameTooLargeError.Error()},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			packets := app.Inspect(test.stream, zkp.DefaultMaxFrameSize)
+			assert.Len(packets, len(test.expected))
+			for i, expected := range test.expected {
+				if expected == "" {
+					assert.Empty(packets[i].Error)
+					assert.Equal("AuthRequest", packets[i].Name)
+				} else {
+					assert.Contains(packets[i].Error, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	assert := assert.New(t)
+	var stream bytes.Buffer
+	err := zkp.SendMessage(&stream, &zkp_pb.AuthResponse{Result: false, Code: zkp_pb.ErrorCode_AUTH_FAILED})
+	assert.NoError(err)
+
+	var out bytes.Buffer
+	err = app.WriteJSON(&out, "capture.bin", app.Inspect(stream.Bytes(), zkp.DefaultMaxFrameSize))
+	assert.NoError(err)
+	assert.Equal(`{"source":"capture.bin","offset":0,"size":7,"name":"AuthResponse","message":{"code":"AUTH_FAILED"}}`+"\n", out.String())
+
+	var decoded map[string]interface{}
+	assert.NoError(json.Unmarshal(out.Bytes(), &decoded))
+}
+
+func TestWriteText(t *testing.T) {
+	assert := assert.New(t)
+	packets := app.Inspect(readTestPacket(t, "auth_request_packet.bin")[:10], zkp.DefaultMaxFrameSize)
+
+	var out bytes.Buffer
+	err := app.WriteText(&out, "capture.bin", packets)
+	assert.NoError(err)
+	assert.Equal(strings.Join([]string{
+		"capture.bin: 1 packet(s)",
+		"#0 offset=0 size=70",
+		"  ERROR: truncated packet: 6 of 70 content bytes",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestInspect_Streams(t *testing.T) {
+	assert := assert.New(t)
+	var stream bytes.Buffer
+	framer := zkp.NewFramer(nil, &stream)
+	assert.NoError(framer.SendStreamMessage(3, &zkp_pb.ChallengeResponse{Challenge: []byte{1}}))
+	assert.NoError(framer.SendStreamMessage(3, nil))
+
+	packets := app.Inspect(stream.Bytes(), zkp.DefaultMaxFrameSize)
+	assert.Len(packets, 2)
+	assert.Equal(uint32(3), packets[0].Stream)
+	assert.Equal("ChallengeResponse", packets[0].Name)
+	assert.Equal(uint32(3), packets[1].Stream)
+	assert.Equal(zkp.StreamAbortedError.Error(), packets[1].Error)
+
+	var out bytes.Buffer
+	assert.NoError(app.WriteText(&out, "capture.bin", packets[1:]))
+	assert.Equal(strings.Join([]string{
+		"capture.bin: 1 packet(s)",
+		"#0 offset=14 size=6 stream=3",
+		"  ERROR: stream aborted by peer",
+		"",
+	}, "\n"), out.String())
+}
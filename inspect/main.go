@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mindaugasrukas/zkp_example/inspect/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+func main() {
+	hexInput := flag.Bool("hex", false, "inputs are hex dumps: plain hex, xxd or hexdump -C output")
+	jsonOutput := flag.Bool("json", false, "write a JSON object per packet")
+	maxSize := flag.Uint("max-size", zkp.DefaultMaxFrameSize, "largest accepted packet size")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file ...]\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Decodes captured packet streams, reads stdin if no file or - is given.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	sources := flag.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	// exit with an error if any packet is malformed
+	failed := false
+	for _, source := range sources {
+		data, err := readInput(source, *hexInput)
+		if err != nil {
+			log.Printf("%s: %v", source, err)
+			failed = true
+			continue
+		}
+
+		packets := app.Inspect(data, uint32(*maxSize))
+		write := app.WriteText
+		if *jsonOutput {
+			write = app.WriteJSON
+		}
+		if err := write(os.Stdout, source, packets); err != nil {
+			log.Fatal(err)
+		}
+		for _, packet := range packets {
+			if packet.Error != "" {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// readInput reads the file or stdin for "-"
+func readInput(source string, hexInput bool) ([]byte, error) {
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	if hexInput {
+		return app.ParseHexDump(r)
+	}
+	return io.ReadAll(r)
+}
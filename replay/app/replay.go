@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/capture"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// Replayer plays the client side of the recorded connections against a live server
+	//
+	// The server issues random challenges, so the recorded answer is valid only
+	// if the replayed connection receives the recorded challenge.
+	// Otherwise the following responses are compared by the message type only
+	// and the connection is replayed again up to Retries times.
+	// The session values issued by the login, e.g. the token, differ in every run and are compared by presence only.
+	Replayer struct {
+		// Dial connects to the server
+		Dial func(ctx context.Context) (net.Conn, error)
+		// Timeout limits each read and write, zero means no limit
+		Timeout time.Duration
+		// Retries is the number of replays of the connection receiving a different challenge
+		Retries int
+	}
+
+	// Result is the outcome of the replayed connection
+	Result struct {
+		// Conn is the connection id in the recording
+		Conn uint64
+		// Attempts is the number of replays
+		Attempts int
+		// ChallengeDiffers is set if the server never issued the recorded challenge
+		ChallengeDiffers bool
+		// Diffs between the recorded and the replayed responses
+		Diffs []*Diff
+	}
+
+	// Diff is the response not matching the recording
+	Diff struct {
+		// Frame is the index of the frame in the recorded connection
+		Frame    int
+		Expected string
+		Actual   string
+	}
+)
+
+// NewReplayer returns the replayer connecting to the TCP address or unix:///path socket
+func NewReplayer(address string) *Replayer {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix://") {
+		network, address = "unix", strings.TrimPrefix(address, "unix://")
+	}
+	return &Replayer{
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+// Replay replays the recorded connections one by one in the recorded order
+func (r *Replayer) Replay(ctx context.Context, records []*capture.Record) ([]*Result, error) {
+	var results []*Result
+	for _, connection := range capture.Connections(records) {
+		result := &Result{Conn: connection[0].Conn}
+		for result.Attempts <= r.Retries {
+			result.Attempts++
+			var err error
+			result.ChallengeDiffers, result.Diffs, err = r.replayConn(ctx, connection)
+			if err != nil {
+				return results, fmt.Errorf("conn %d: %w", result.Conn, err)
+			}
+			if !result.ChallengeDiffers {
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// replayConn sends the recorded client frames and compares the server frames
+func (r *Replayer) replayConn(ctx context.Context, records []*capture.Record) (challengeDiffers bool, diffs []*Diff, err error) {
+	conn, err := r.Dial(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+	defer conn.Close()
+	framer := zkp.NewFramer(conn, conn)
+
+	for i, record := range records {
+		if r.Timeout > 0 {
+			conn.SetDeadline(time.Now().Add(r.Timeout))
+		}
+		if record.Direction == capture.ClientToServer {
+			if err := framer.WriteFrame(record.Frame); err != nil {
+				diffs = append(diffs, &Diff{Frame: i, Expected: "send frame", Actual: err.Error()})
+				return challengeDiffers, diffs, nil
+			}
+			continue
+		}
+
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			diffs = append(diffs, &Diff{Frame: i, Expected: describe(framer.Codec, record.Frame), Actual: err.Error()})
+			return challengeDiffers, diffs, nil
+		}
+		if bytes.Equal(frame, record.Frame) {
+			continue
+		}
+
+		expected, expectedErr := framer.Codec.Decode(record.Frame)
+		actual, actualErr := framer.Codec.Decode(frame)
+		if expectedErr == nil && actualErr == nil {
+			if _, ok := expected.(*zkp_pb.ChallengeResponse); ok && zkp.MessageName(expected) == zkp.MessageName(actual) {
+				// random, the following responses depend on it
+				challengeDiffers = true
+				continue
+			}
+			if challengeDiffers && zkp.MessageName(expected) == zkp.MessageName(actual) {
+				continue
+			}
+			if proto.Equal(maskSession(expected), maskSession(actual)) {
+				// the same message encoded differently
+				continue
+			}
+		}
+		diffs = append(diffs, &Diff{
+			Frame:    i,
+			Expected: describe(framer.Codec, record.Frame),
+			Actual:   describe(framer.Codec, frame),
+		})
+	}
+	return challengeDiffers, diffs, nil
+}
+
+// maskSession replaces the session values issued by the server with placeholders, they differ in every run
+func maskSession(msg proto.Message) proto.Message {
+	switch m := msg.(type) {
+	case *zkp_pb.AuthResponse:
+		m = proto.Clone(m).(*zkp_pb.AuthResponse)
+		m.Token, m.ExpiresAt, m.SessionId, m.RefreshToken = maskSessionValues(m.Token, m.ExpiresAt, m.SessionId, m.RefreshToken)
+		return m
+	case *zkp_pb.RefreshResponse:
+		m = proto.Clone(m).(*zkp_pb.RefreshResponse)
+		m.Token, m.ExpiresAt, m.SessionId, m.RefreshToken = maskSessionValues(m.Token, m.ExpiresAt, m.SessionId, m.RefreshToken)
+		return m
+	}
+	return msg
+}
+
+// maskSessionValues replaces the set values with placeholders, the unset ones stay empty
+func maskSessionValues(token string, expiresAt int64, sessionID, refreshToken string) (string, int64, string, string) {
+	mask := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return "masked"
+	}
+	if expiresAt != 0 {
+		expiresAt = 1
+	}
+	return mask(token), expiresAt, mask(sessionID), mask(refreshToken)
+}
+
+// describe returns the text representation of the frame
+func describe(codec *zkp.Codec, frame []byte) string {
+	msg, err := codec.Decode(frame)
+	if err != nil {
+		return fmt.Sprintf("undecodable frame %x: %v", frame, err)
+	}
+	text := strings.TrimSpace(prototext.MarshalOptions{}.Format(msg))
+	return fmt.Sprintf("%s {%s}", zkp.MessageName(msg), text)
+}
@@ -0,0 +1,132 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/capture"
+	client "github.com/mindaugasrukas/zkp_example/client/app"
+	"github.com/mindaugasrukas/zkp_example/replay/app"
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer serves a new server on the loopback until the test ends, the logins aren't limited
+func startServer(t *testing.T, configure ...func(server *svr.Server)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	server := svr.NewServer()
+	// the replay retries the logins until the server issues the recorded challenge
+	server.RateLimits = svr.RateLimits{}
+	server.Lockout = svr.Lockout{}
+	// the replayed registration of the taken user name differs
+	server.ReportUserExists = true
+	for _, configure := range configure {
+		configure(server)
+	}
+	go server.ServeContext(ctx, l)
+	return l.Addr().String()
+}
+
+// recordSession records the registration and a login with the password on separate connections
+func recordSession(t *testing.T, address string, password int) []*capture.Record {
+	var recording bytes.Buffer
+	recorder := capture.NewRecorder(&recording)
+	c := client.NewClient(address)
+	c.Recorder = recorder
+	if err := c.Register("max", 123); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = client.NewClient(address)
+	c.Recorder = recorder
+	if _, err := c.Login("max", password); (err == nil) != (password == 123) {
+		t.Fatalf("login with the password %d: %v", password, err)
+	}
+	c.Close()
+
+	records, err := capture.ReadRecording(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	assert := assert.New(t)
+	records := recordSession(t, startServer(t), 124)
+
+	// the new server issues the recorded challenge eventually
+	replayer := app.NewReplayer(startServer(t))
+	replayer.Retries = 1000
+	results, err := replayer.Replay(context.Background(), records)
+	assert.NoError(err)
+	assert.Len(results, 2)
+	for _, result := range results {
+		assert.Empty(result.Diffs)
+		assert.False(result.ChallengeDiffers)
+	}
+}
+
+func TestReplayer_Replay_Diff(t *testing.T) {
+	assert := assert.New(t)
+	address := startServer(t)
+	records := recordSession(t, address, 124)
+
+	// replay against the server with the registered user, without retries
+	results, err := app.NewReplayer(address).Replay(context.Background(), records)
+	assert.NoError(err)
+	assert.Len(results, 2)
+
+	// the registration fails
+	assert.Len(results[0].Diffs, 1)
+	assert.Contains(results[0].Diffs[0].Expected, "RegisterResponse")
+	assert.Contains(results[0].Diffs[0].Actual, "USER_EXISTS")
+
+	// the authentication result depends on the challenge
+	assert.Equal(1, results[1].Attempts)
+	if results[1].ChallengeDiffers {
+		assert.Empty(results[1].Diffs)
+	}
+}
+
+func TestReplayer_Replay_Tokens(t *testing.T) {
+	assert := assert.New(t)
+	withTokens := func(server *svr.Server) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Tokens = token.NewSigner(key)
+	}
+	records := recordSession(t, startServer(t, withTokens), 123)
+
+	// the successful login issues a new session in every run
+	replayer := app.NewReplayer(startServer(t, withTokens))
+	replayer.Retries = 1000
+	results, err := replayer.Replay(context.Background(), records)
+	assert.NoError(err)
+	assert.Len(results, 2)
+	for _, result := range results {
+		assert.Empty(result.Diffs)
+		assert.False(result.ChallengeDiffers)
+	}
+
+	// the server without the tokens still differs
+	replayer = app.NewReplayer(startServer(t))
+	replayer.Retries = 1000
+	results, err = replayer.Replay(context.Background(), records)
+	assert.NoError(err)
+	if assert.Len(results, 2) && assert.False(results[1].ChallengeDiffers) && assert.Len(results[1].Diffs, 1) {
+		assert.Contains(results[1].Diffs[0].Expected, "token")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/capture"
+	"github.com/mindaugasrukas/zkp_example/replay/app"
+)
+
+func main() {
+	server := flag.String("s", "localhost:8080", "server address host:port or unix:///path")
+	retries := flag.Int("retries", 50, "replays of a connection until the server issues the recorded challenge")
+	timeout := flag.Duration("timeout", 10*time.Second, "read and write timeout, 0 - no timeout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] recording ...\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Replays the client side of the recordings and diffs the server responses.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	replayer := app.NewReplayer(*server)
+	replayer.Retries = *retries
+	replayer.Timeout = *timeout
+
+	// exit with an error if any response differs
+	failed := false
+	for _, path := range flag.Args() {
+		records, err := readRecording(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results, err := replayer.Replay(context.Background(), records)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		for _, result := range results {
+			status := "ok"
+			if len(result.Diffs) > 0 {
+				status = fmt.Sprintf("%d difference(s)", len(result.Diffs))
+				failed = true
+			}
+			fmt.Printf("%s conn %d: %s, %d attempt(s)", path, result.Conn, status, result.Attempts)
+			if result.ChallengeDiffers {
+				fmt.Print(", challenge differs: responses after it compared by type only")
+			}
+			fmt.Println()
+			for _, diff := range result.Diffs {
+				fmt.Printf("  frame %d:\n  - %s\n  + %s\n", diff.Frame, diff.Expected, diff.Actual)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func readRecording(path string) ([]*capture.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return capture.ReadRecording(f)
+}
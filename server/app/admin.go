@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// Admin commands run by the users of Server.Admins
+const (
+	// UnlockCommand unlocks the user named by the AppRequest payload, see Server.Unlock
+	UnlockCommand = "unlock"
+	// StatsCommand replies with the JSON encoded ConnectionStats
+	StatsCommand = "stats"
+)
+
+// PermissionDeniedError is reported as PERMISSION_DENIED to the user logged in without the admin rights
+var PermissionDeniedError = errors.New("permission denied")
+
+// handleAdmin registers the admin commands
+func (s *Server) handleAdmin() {
+	s.HandleCommand(UnlockCommand, s.unlockCommand, s.RequireAdmin)
+	s.HandleCommand(StatsCommand, s.statsCommand, s.RequireAdmin)
+}
+
+// RequireAdmin is the middleware rejecting the request with PERMISSION_DENIED unless the user is one of Admins
+// It runs after RequireLogin, e.g. as the middleware of HandleCommand.
+func (s *Server) RequireAdmin(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, req *Request) error {
+		for _, admin := range s.Admins {
+			if req.User == admin {
+				return next(ctx, req)
+			}
+		}
+		return req.Fail(ctx, fmt.Errorf("%w: user %q isn't an admin", PermissionDeniedError, req.User))
+	}
+}
+
+// unlockCommand unlocks the user named by the payload
+func (s *Server) unlockCommand(ctx context.Context, admin zkp.UUID, payload []byte) ([]byte, error) {
+	user := zkp.UUID(payload)
+	if user == "" {
+		return nil, fmt.Errorf("%w %q", model.MissingFieldError, "user")
+	}
+	if err := s.Unlock(user); err != nil {
+		return nil, err
+	}
+	s.infof("user %q unlocked by admin %q", user, admin)
+	return nil, nil
+}
+
+// statsCommand replies with the connection metrics
+func (s *Server) statsCommand(ctx context.Context, admin zkp.UUID, payload []byte) ([]byte, error) {
+	return json.Marshal(s.ConnectionStats())
+}
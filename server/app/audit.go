@@ -0,0 +1,46 @@
+package app
+
+import (
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// Audit event types
+const (
+	AuditLoginSucceeded = "login succeeded"
+	AuditLoginFailed    = "login failed"
+	AuditUserLocked     = "user locked"
+	AuditUserUnlocked   = "user unlocked"
+)
+
+type (
+	// AuditEvent describes the login or the lockout of the user
+	AuditEvent struct {
+		Type string
+		// User is the user name of the request, it might not exist
+		User zkp.UUID
+		// RemoteIP is the client address, empty if unknown or the event isn't caused by a client
+		RemoteIP string
+		Time     time.Time
+		// Failures are the consecutive failed logins of the user
+		Failures int
+		// RetryAt is the time the next login is allowed at, zero if it is allowed now
+		RetryAt time.Time
+	}
+
+	// AuditHook is called with each event, it must not block the login
+	AuditHook func(event AuditEvent)
+)
+
+// audit logs the event and notifies the audit hook
+func (s *Server) audit(event AuditEvent) {
+	if event.RetryAt.IsZero() {
+		s.infof("%s: user %q from %q, failures %d", event.Type, event.User, event.RemoteIP, event.Failures)
+	} else {
+		s.infof("%s: user %q from %q, failures %d, retry at %v", event.Type, event.User, event.RemoteIP, event.Failures, event.RetryAt.Format(time.RFC3339))
+	}
+	if s.Audit != nil {
+		s.Audit(event)
+	}
+}
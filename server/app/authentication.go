@@ -1,32 +1,28 @@
 package app
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
-	"net"
+	"time"
 
 	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/token"
 	"github.com/mindaugasrukas/zkp_example/zkp"
 	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
 )
 
-func (s *Server) serveAuth(conn net.Conn, authRequest *zkp_pb.AuthRequest) error {
-	if len(authRequest.GetCommits()) == 0 {
-		// todo: wrong request
-		return WrongRequestError
+// serveAuth runs the authentication, the successful login is recorded in the session unless it is nil
+func (s *Server) serveAuth(ctx context.Context, conn zkp.MessageConn, sess *session, authRequest *zkp_pb.AuthRequest) error {
+	user, auth, err := model.GetAuthentication(authRequest)
+	if err == nil {
+		err = s.authenticate(ctx, conn, sess, user, auth)
 	}
-
-	user, auth := model.GetAuthentication(authRequest)
-	if err := s.authenticate(conn, user, auth); err != nil {
+	if err != nil {
 		// send error response
-		authResponse := &zkp_pb.AuthResponse{
-			Result: false,
-			Error:  err.Error(),
-		}
-		if err := zkp.SendMessage(conn, authResponse); err != nil {
+		if err := s.send(ctx, conn, newResponseError(err).authResponse()); err != nil {
 			// log the error and continue
-			fmt.Println(err.Error())
+			s.errorf("%v", err)
 		}
 		return err
 	}
@@ -34,47 +30,120 @@ func (s *Server) serveAuth(conn net.Conn, authRequest *zkp_pb.AuthRequest) error
 	return nil
 }
 
-func (s *Server) authenticate(connection net.Conn, user zkp.UUID, authRequest *zkp.Commits) error {
-	// Get the user data
-	userCommits, err := s.registry.Get(user)
+func (s *Server) authenticate(ctx context.Context, conn zkp.MessageConn, sess *session, user zkp.UUID, authRequest *zkp.Commits) error {
+	auth, err := s.createChallenge(ctx, user)
 	if err != nil {
 		return err
 	}
 
 	// Send the challenge
-	challenge, err := s.Verifier.CreateAuthenticationChallenge()
-	if err != nil {
-		return err
-	}
 	challengeResponse := &zkp_pb.ChallengeResponse{
-		Challenge: (challenge).Bytes(),
+		Challenge: (auth.challenge).Bytes(),
 	}
-	if err := zkp.SendMessage(connection, challengeResponse); err != nil {
+	if err := s.send(ctx, conn, challengeResponse); err != nil {
 		return err
 	}
 
 	// Verify the answer
-	msg, err := zkp.ReadMessage(connection)
+	answerCtx, cancel := WithTimeout(ctx, s.Timeouts.Answer)
+	msg, err := conn.ReadMessageContext(answerCtx)
+	cancel()
 	if err != nil {
 		return err
 	}
 	answerRequest, ok := msg.(*zkp_pb.AnswerRequest)
 	if !ok {
-		return errors.New("wrong auth answer")
+		return fmt.Errorf("%w: expected AnswerRequest, got %q", WrongRequestError, zkp.MessageName(msg))
 	}
 
 	answer := model.GetAnswer(answerRequest)
-	log.Print("answer = ", &answer)
+	s.debugf("answer = %v", answer)
 
-	result := s.Verifier.VerifyAuthentication(userCommits, authRequest, challenge, answer)
+	// the unknown user fails after the verification taking the same time
+	if !s.Verifier.VerifyAuthentication(auth.userCommits, authRequest, auth.challenge, answer) || !auth.known {
+		s.loginFailed(ctx, user, auth.failures)
+		return AuthFailedError
+	}
+	s.loginSucceeded(ctx, user)
+	authResponse, err := s.authResult(user)
+	if err != nil {
+		return err
+	}
+	if sess != nil {
+		// logged in before the client learns it, so its next request is authenticated
+		sess.login(user, authResponse.SessionId)
+	}
 
 	// Send authentication results
-	authResponse := &zkp_pb.AuthResponse{
-		Result: result,
-	}
-	if err := zkp.SendMessage(connection, authResponse); err != nil {
+	if err := s.send(ctx, conn, authResponse); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// authResult returns the successful authentication response
+// The response carries the tokens of the new session if the server issues tokens.
+func (s *Server) authResult(user zkp.UUID) (*zkp_pb.AuthResponse, error) {
+	response := &zkp_pb.AuthResponse{Result: true}
+	if s.Tokens == nil {
+		return response, nil
+	}
+	signed, claims, err := s.Tokens.Issue(string(user), token.AuthMethodZKP)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, refreshHash, err := newRefreshToken(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	// the token times are in seconds, the precise time orders the sessions issued within a second
+	issued := time.Now()
+	err = s.sessions.AddSession(&store.Session{
+		ID:          claims.ID,
+		User:        user,
+		AuthMethods: claims.AuthMethods,
+		IssuedAt:    issued,
+		ExpiresAt:   issued.Add(s.SessionTTL),
+		RefreshHash: refreshHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response.Token = signed
+	response.ExpiresAt = claims.ExpiresAt
+	response.SessionId = claims.ID
+	response.RefreshToken = refreshToken
+	return response, nil
+}
+
+// createChallenge gets the user data and creates the authentication challenge waiting for the answer
+// The attempts are rate limited, delayed after the failed ones and counted before looking the user up.
+// The unknown user gets the fake commits and the challenge as well, known is false.
+func (s *Server) createChallenge(ctx context.Context, user zkp.UUID) (*pendingAuth, error) {
+	if err := s.limit(ctx, OperationAuth, user); err != nil {
+		return nil, err
+	}
+	failures, err := s.reserveAttempt(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the user data
+	userCommits, known, err := s.lookupUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.Verifier.CreateAuthenticationChallenge()
+	if err != nil {
+		return nil, err
+	}
+	return &pendingAuth{
+		user:        user,
+		userCommits: userCommits,
+		known:       known,
+		challenge:   challenge,
+		failures:    failures,
+	}, nil
+}
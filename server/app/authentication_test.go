@@ -1,3 +1,66 @@
 package app_test
 
-// todo: write tests
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSigner returns the token signer with a new key
+func newSigner(t *testing.T) *token.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.NewSigner(key)
+}
+
+func TestServer_Token(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.Tokens = newSigner(t)
+	server.Tokens.Issuer = "zkp-test"
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+
+	// no token for the failed login
+	response := login(t, mux, "alice", 124)
+	assert.False(response.GetResult())
+	assert.Empty(response.GetToken())
+
+	response = login(t, mux, "alice", 123)
+	assert.True(response.GetResult())
+	verifier := token.NewVerifier(server.Tokens.PublicKey())
+	verifier.Issuer = "zkp-test"
+	claims, err := verifier.Verify(response.GetToken())
+	assert.NoError(err)
+	assert.Equal("alice", claims.Subject)
+	assert.Equal([]string{token.AuthMethodZKP}, claims.AuthMethods)
+	assert.Equal(response.GetSessionId(), claims.ID)
+	assert.Equal(response.GetExpiresAt(), claims.ExpiresAt)
+	assert.WithinDuration(time.Now().Add(token.DefaultTTL), claims.Expires(), 2*time.Second)
+
+	// every login starts a new session
+	other := login(t, mux, "alice", 123)
+	assert.NotEqual(response.GetSessionId(), other.GetSessionId())
+}
+
+func TestServer_NoTokens(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+	response := login(t, mux, "alice", 123)
+	assert.True(response.GetResult())
+	assert.Empty(response.GetToken())
+	assert.Empty(response.GetSessionId())
+}
@@ -0,0 +1,316 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// maxRejecting limits the connections told they are rejected at once, the next ones are closed
+const maxRejecting = 64
+
+// rejectRetryAfter is the retry time sent to the rejected connections
+const rejectRetryAfter = time.Second
+
+var (
+	ServerBusyError         = errors.New("server busy")
+	TooManyConnectionsError = errors.New("too many connections")
+)
+
+type (
+	// ConnectionLimits bound the connections of all listeners together, zero disables the limit
+	// The rejected TCP connections are told the reason in the hello response, the connections of the other transports
+	// are closed.
+	ConnectionLimits struct {
+		// Max is the number of connections served at once by the worker pool
+		Max int
+		// Queue is the number of accepted connections waiting for a free worker, the next ones are rejected
+		Queue int
+		// QueueTimeout is the longest wait for a free worker, the connection is rejected after
+		QueueTimeout time.Duration
+		// PerIP limits the served and queued connections of a client address
+		PerIP int
+	}
+
+	// ConnectionStats are the metrics of the connections of all listeners
+	ConnectionStats struct {
+		// Active are the connections served
+		Active int `json:"active"`
+		// Queued are the connections waiting for a free worker
+		Queued int `json:"queued"`
+		// MaxQueued is the deepest queue since the server started
+		MaxQueued int `json:"max_queued"`
+		// Accepted and Rejected count the connections since the server started
+		Accepted uint64 `json:"accepted"`
+		Rejected uint64 `json:"rejected"`
+	}
+
+	// connPool admits the accepted connections to the workers
+	connPool struct {
+		mu    sync.Mutex
+		stats ConnectionStats
+		// connections of the client addresses, served or queued
+		perIP map[string]int
+		// free workers wait for the queued connections
+		freed     chan struct{}
+		rejecting int
+	}
+
+	// connTicket is the admitted connection
+	connTicket struct {
+		pool   *connPool
+		ip     string
+		active bool
+	}
+
+	// limitListener admits the connections of the HTTP and gRPC servers, see Server.limitListener
+	limitListener struct {
+		net.Listener
+		conns chan net.Conn
+		// errs pass the temporary accept errors, the server retries them
+		errs chan error
+		// failed is closed with err when the listener fails
+		failed chan struct{}
+		err    error
+		closed chan struct{}
+		once   sync.Once
+	}
+
+	// limitConn releases the worker when the connection is closed
+	limitConn struct {
+		net.Conn
+		ticket *connTicket
+		once   sync.Once
+	}
+)
+
+// DefaultConnectionLimits are the connection limits used by NewServer
+var DefaultConnectionLimits = ConnectionLimits{
+	Max:          1024,
+	Queue:        256,
+	QueueTimeout: 5 * time.Second,
+	PerIP:        32,
+}
+
+// ConnectionStats returns the connection metrics, e.g. the queue depth
+func (s *Server) ConnectionStats() ConnectionStats {
+	s.conns.mu.Lock()
+	defer s.conns.mu.Unlock()
+	return s.conns.stats
+}
+
+// admitConn queues the accepted connection, the connection is rejected if the queue or the client limit is full
+func (s *Server) admitConn(conn net.Conn) (*connTicket, error) {
+	limits := s.Connections
+	ip := ""
+	if _, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		// the unix socket peers share no address
+		ip = remoteHost(conn.RemoteAddr().String())
+	}
+
+	p := &s.conns
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.perIP == nil {
+		p.perIP = make(map[string]int)
+		p.freed = make(chan struct{})
+	}
+	switch {
+	case ip != "" && limits.PerIP > 0 && p.perIP[ip] >= limits.PerIP:
+		p.stats.Rejected++
+		return nil, fmt.Errorf("%w from %s", TooManyConnectionsError, ip)
+	case limits.Max > 0 && p.stats.Active+p.stats.Queued >= limits.Max+limits.Queue:
+		// the queued connections reserve the free workers as well, they turn active in their own goroutines
+		p.stats.Rejected++
+		return nil, fmt.Errorf("%w: %d connections served, %d queued", ServerBusyError, p.stats.Active, p.stats.Queued)
+	}
+	p.stats.Accepted++
+	p.stats.Queued++
+	if p.stats.Queued > p.stats.MaxQueued {
+		p.stats.MaxQueued = p.stats.Queued
+	}
+	if ip != "" {
+		p.perIP[ip]++
+	}
+	return &connTicket{pool: p, ip: ip}, nil
+}
+
+// wait waits for a free worker, returns ServerBusyError if none is free within the queue timeout
+// and ServerClosedError if the server stops serving first.
+func (t *connTicket) wait(ctx context.Context, limits ConnectionLimits, closed <-chan struct{}) error {
+	ctx, cancel := WithTimeout(ctx, limits.QueueTimeout)
+	defer cancel()
+	p := t.pool
+	for {
+		p.mu.Lock()
+		if limits.Max <= 0 || p.stats.Active < limits.Max {
+			p.stats.Queued--
+			p.stats.Active++
+			t.active = true
+			p.mu.Unlock()
+			return nil
+		}
+		freed := p.freed
+		p.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-closed:
+			return ServerClosedError
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				// the server stopped serving
+				return ServerClosedError
+			}
+			return fmt.Errorf("%w: no free worker within %v", ServerBusyError, limits.QueueTimeout)
+		}
+	}
+}
+
+// done releases the worker and the client address of the connection
+func (t *connTicket) done() {
+	p := t.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.active {
+		p.stats.Active--
+		// wake up the queued connections
+		close(p.freed)
+		p.freed = make(chan struct{})
+	} else {
+		p.stats.Queued--
+		p.stats.Rejected++
+	}
+	if t.ip != "" {
+		p.perIP[t.ip]--
+		if p.perIP[t.ip] == 0 {
+			delete(p.perIP, t.ip)
+		}
+	}
+}
+
+// rejectConn tells the client the connection is rejected and closes it
+// The hello of the client is read first, so the response is not lost by closing the unread data.
+// Only maxRejecting connections are told at once, the next ones are closed.
+func (s *Server) rejectConn(conn net.Conn, reason error) {
+	s.debugf("rejected connection from %v: %v", conn.RemoteAddr(), reason)
+	p := &s.conns
+	p.mu.Lock()
+	if p.rejecting >= maxRejecting {
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.rejecting++
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			p.rejecting--
+			p.mu.Unlock()
+		}()
+		defer conn.Close()
+		s.sendRejection(conn, reason)
+	}()
+}
+
+// sendRejection reads the hello and sends the failed hello response
+func (s *Server) sendRejection(conn net.Conn, reason error) {
+	ctx, cancel := WithTimeout(context.Background(), s.Timeouts.Write)
+	defer cancel()
+	framer := zkp.NewFramer(conn, conn)
+	framer.RequireHello = true
+	if _, err := framer.ReadMessageContext(ctx); err != nil {
+		return
+	}
+	response := newResponseError(&retryError{error: reason, after: rejectRetryAfter}).helloResponse()
+	if err := s.send(ctx, framer, response); err != nil {
+		s.debugf("%v", err)
+	}
+}
+
+// limitListener applies the connection limits to the listener of the HTTP or gRPC server
+// Accept returns the admitted connection once a worker is free, the worker is released when it is closed.
+// The rejected connections are closed, these transports have no hello to tell the reason.
+func (s *Server) limitListener(ctx context.Context, l net.Listener) net.Listener {
+	limited := &limitListener{
+		Listener: l,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		failed:   make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go limited.acceptLoop(ctx, s)
+	return limited
+}
+
+// acceptLoop admits the accepted connections until the listener fails
+func (l *limitListener) acceptLoop(ctx context.Context, s *Server) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				select {
+				case l.errs <- err:
+					continue
+				case <-l.closed:
+				}
+			}
+			l.err = err
+			close(l.failed)
+			return
+		}
+		ticket, err := s.admitConn(conn)
+		if err != nil {
+			s.debugf("rejected connection from %v: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		go func(conn net.Conn) {
+			if err := ticket.wait(ctx, s.Connections, s.shutdown.doneChan()); err != nil {
+				ticket.done()
+				s.debugf("rejected connection from %v: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			limited := &limitConn{Conn: conn, ticket: ticket}
+			select {
+			case l.conns <- limited:
+			case <-l.closed:
+				limited.Close()
+			}
+		}(conn)
+	}
+}
+
+// Accept returns the next admitted connection
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.failed:
+		return nil, l.err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener, the admitted connections waiting for Accept are closed
+func (l *limitListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// Close closes the connection and releases its worker
+func (c *limitConn) Close() error {
+	c.once.Do(c.ticket.done)
+	return c.Conn.Close()
+}
@@ -0,0 +1,243 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// startConnLimitServer serves the TCP listener with the connection limits
+func startConnLimitServer(t *testing.T, limits svr.ConnectionLimits) (*svr.Server, string) {
+	server := svr.NewServer()
+	server.Connections = limits
+	return server, startServer(t, server)
+}
+
+// sendHello dials the server from the local address and sends the hello without waiting for the response
+func sendHello(t *testing.T, local, address string) *zkp.Framer {
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(local)}}
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	framer := zkp.NewFramer(conn, conn)
+	framer.RequireHello = true
+	if err := framer.SendMessageContext(context.Background(), zkp.DefaultCapabilities.Hello()); err != nil {
+		t.Fatal(err)
+	}
+	return framer
+}
+
+// readHello reads the hello response
+func readHello(t *testing.T, framer *zkp.Framer) *zkp_pb.HelloResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := framer.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.(*zkp_pb.HelloResponse)
+}
+
+func TestServer_ConnectionLimits(t *testing.T) {
+	assert := assert.New(t)
+	server, address := startConnLimitServer(t, svr.ConnectionLimits{Max: 1, Queue: 1})
+
+	served := connect(t, address)
+	queued := sendHello(t, "127.0.0.1", address)
+	assert.Eventually(func() bool { return server.ConnectionStats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// the full queue rejects the next connection
+	response := readHello(t, sendHello(t, "127.0.0.1", address))
+	assert.False(response.Result)
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, response.Code)
+	assert.Equal(uint32(1), response.RetryAfter)
+
+	// the queued connection is served when the worker is free
+	served.Close()
+	assert.True(readHello(t, queued).Result)
+	assert.Equal(svr.ConnectionStats{Active: 1, MaxQueued: 1, Accepted: 2, Rejected: 1}, server.ConnectionStats())
+}
+
+func TestServer_ConnectionLimits_REST(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.Connections = svr.ConnectionLimits{Max: 1}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.ServeREST(ctx, listener)
+	url := "http://" + listener.Addr().String()
+
+	// the idle keep-alive connection holds the worker
+	client := &http.Client{Transport: &http.Transport{}}
+	status, _ := registerREST(t, url, "alice", 123)
+	assert.Equal(http.StatusOK, status)
+	_, err = client.Get(url + "/register")
+	assert.Error(err)
+	assert.Equal(uint64(1), server.ConnectionStats().Rejected)
+
+	http.DefaultClient.CloseIdleConnections()
+	assert.Eventually(func() bool { return server.ConnectionStats().Active == 0 }, time.Second, time.Millisecond)
+	resp, err := client.Get(url + "/register")
+	if assert.NoError(err) {
+		resp.Body.Close()
+		assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+// burstListener hands out the queued connections at once, then blocks until it is closed
+type burstListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *burstListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *burstListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *burstListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "burst", Net: "unix"}
+}
+
+func TestServer_ConnectionLimits_Burst(t *testing.T) {
+	assert := assert.New(t)
+	// the accept loop admits the whole burst before any connection goroutine runs
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	const burst = 16
+	l := &burstListener{conns: make(chan net.Conn, burst), closed: make(chan struct{})}
+	responses := make(chan *zkp_pb.HelloResponse, burst)
+	for i := 0; i < burst; i++ {
+		client, conn := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+		l.conns <- conn
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			framer := zkp.NewFramer(client, client)
+			framer.RequireHello = true
+			var response *zkp_pb.HelloResponse
+			if err := framer.SendMessageContext(ctx, zkp.DefaultCapabilities.Hello()); err == nil {
+				msg, _ := framer.ReadMessageContext(ctx)
+				response, _ = msg.(*zkp_pb.HelloResponse)
+			}
+			responses <- response
+		}()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := svr.NewServer()
+	server.Connections = svr.ConnectionLimits{Max: 2, Queue: 1}
+	go server.ServeContext(ctx, l)
+
+	served, rejected, queued := 0, 0, 0
+	for i := 0; i < burst; i++ {
+		response := <-responses
+		switch {
+		case response == nil:
+			queued++
+		case response.Result:
+			served++
+		default:
+			assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, response.Code)
+			rejected++
+		}
+	}
+	assert.Equal([]int{2, 1, burst - 3}, []int{served, queued, rejected})
+	stats := server.ConnectionStats()
+	assert.Equal(uint64(3), stats.Accepted)
+	assert.Equal(uint64(burst-3), stats.Rejected)
+}
+
+func TestServer_ConnectionLimits_NoQueue(t *testing.T) {
+	assert := assert.New(t)
+	server, address := startConnLimitServer(t, svr.ConnectionLimits{Max: 1, QueueTimeout: time.Minute})
+
+	served := sendHello(t, "127.0.0.1", address)
+	// rejected at once instead of waiting for the queue timeout
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, readHello(t, sendHello(t, "127.0.0.1", address)).Code)
+	assert.True(readHello(t, served).Result)
+	assert.Equal(svr.ConnectionStats{Active: 1, MaxQueued: 1, Accepted: 1, Rejected: 1}, server.ConnectionStats())
+}
+
+func TestServer_ConnectionLimits_QueueTimeout(t *testing.T) {
+	assert := assert.New(t)
+	server, address := startConnLimitServer(t, svr.ConnectionLimits{Max: 1, Queue: 1, QueueTimeout: 50 * time.Millisecond})
+
+	served := connect(t, address)
+	defer served.Close()
+	response := readHello(t, sendHello(t, "127.0.0.1", address))
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, response.Code)
+	assert.Equal(svr.ConnectionStats{Active: 1, MaxQueued: 1, Accepted: 2, Rejected: 1}, server.ConnectionStats())
+}
+
+func TestServer_ConnectionLimits_PerIP(t *testing.T) {
+	assert := assert.New(t)
+	_, address := startConnLimitServer(t, svr.ConnectionLimits{PerIP: 1})
+
+	served := connect(t, address)
+	response := readHello(t, sendHello(t, "127.0.0.1", address))
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, response.Code)
+
+	// the other clients are served
+	assert.True(readHello(t, sendHello(t, "127.0.0.2", address)).Result)
+
+	// the client is served again once its connection ends
+	served.Close()
+	assert.Eventually(func() bool {
+		return readHello(t, sendHello(t, "127.0.0.1", address)).Result
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_ConnectionLimits_Disabled(t *testing.T) {
+	assert := assert.New(t)
+	server, address := startConnLimitServer(t, svr.ConnectionLimits{})
+
+	for i := 0; i < 5; i++ {
+		mux := connect(t, address)
+		defer mux.Close()
+	}
+	assert.Equal(svr.ConnectionStats{Active: 5, MaxQueued: 1, Accepted: 5}, server.ConnectionStats())
+}
+
+func TestServer_StatsCommand(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.Admins = []zkp.UUID{"root"}
+	mux := connect(t, startServer(t, server, "root"))
+	defer mux.Close()
+
+	assert.True(login(t, mux, "root", 123).GetResult())
+	response := command(t, mux, svr.StatsCommand, "")
+	assert.True(response.GetResult())
+	var stats svr.ConnectionStats
+	assert.NoError(json.Unmarshal(response.GetPayload(), &stats))
+	assert.Equal(server.ConnectionStats(), stats)
+	assert.Equal(1, stats.Active)
+}
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+var (
+	AuthFailedError = errors.New("authentication failed")
+)
+
+type (
+	// responseError is the error reported to the client
+	responseError struct {
+		code zkp_pb.ErrorCode
+		// message is safe to show to the client
+		message string
+		// detail is empty unless the error describes the client input
+		detail     string
+		retryAfter time.Duration
+	}
+)
+
+// errorMessages are the public messages of the error codes
+// The messages never reveal the server internals.
+var errorMessages = map[zkp_pb.ErrorCode]string{
+	zkp_pb.ErrorCode_INVALID_REQUEST:     "invalid request",
+	zkp_pb.ErrorCode_USER_EXISTS:         "user already exists",
+	zkp_pb.ErrorCode_AUTH_FAILED:         "wrong user name or password",
+	zkp_pb.ErrorCode_RATE_LIMITED:        "too many requests",
+	zkp_pb.ErrorCode_UNSUPPORTED_VERSION: "unsupported protocol version",
+	zkp_pb.ErrorCode_TIMEOUT:             "timeout",
+	zkp_pb.ErrorCode_INTERNAL:            "internal server error",
+	zkp_pb.ErrorCode_UNAUTHENTICATED:     "login required",
+	zkp_pb.ErrorCode_PERMISSION_DENIED:   "permission denied",
+}
+
+// errorCode maps the server error to the code reported to the client
+func errorCode(err error) zkp_pb.ErrorCode {
+	switch {
+	case err == nil:
+		return zkp_pb.ErrorCode_NO_ERROR
+	case errors.Is(err, store.UserExistsError):
+		return zkp_pb.ErrorCode_USER_EXISTS
+	case errors.Is(err, store.UserDoesNotExistError),
+		errors.Is(err, AuthFailedError),
+		errors.Is(err, UnknownAuthError):
+		return zkp_pb.ErrorCode_AUTH_FAILED
+	case errors.Is(err, WrongRequestError),
+		errors.Is(err, UnknownRequestError),
+		errors.Is(err, zkp.HelloRequiredError),
+		errors.Is(err, zkp.UnexpectedHelloError),
+		errors.Is(err, zkp.UnknownMessageError),
+		errors.Is(err, zkp.EmptyEnvelopeError),
+		errors.Is(err, zkp.FrameTooLargeError),
+		errors.Is(err, model.InvalidNumberError),
+		errors.Is(err, model.MissingFieldError),
+		errors.Is(err, TokensDisabledError),
+		errors.Is(err, UnknownSessionError):
+		return zkp_pb.ErrorCode_INVALID_REQUEST
+	case errors.Is(err, zkp.NegotiationError),
+		errors.Is(err, zkp.UnsupportedFrameVersionError):
+		return zkp_pb.ErrorCode_UNSUPPORTED_VERSION
+	case errors.Is(err, NotAuthenticatedError),
+		errors.Is(err, InvalidRefreshTokenError),
+		errors.Is(err, token.MalformedTokenError),
+		errors.Is(err, token.UnsupportedAlgorithmError),
+		errors.Is(err, token.UnknownKeyError),
+		errors.Is(err, token.InvalidSignatureError),
+		errors.Is(err, token.ExpiredTokenError),
+		errors.Is(err, token.FutureTokenError),
+		errors.Is(err, token.WrongIssuerError),
+		errors.Is(err, token.RevokedTokenError):
+		return zkp_pb.ErrorCode_UNAUTHENTICATED
+	case errors.Is(err, PermissionDeniedError):
+		return zkp_pb.ErrorCode_PERMISSION_DENIED
+	case errors.Is(err, RateLimitedError),
+		errors.Is(err, UserLockedError),
+		errors.Is(err, ServerBusyError),
+		errors.Is(err, TooManyConnectionsError):
+		return zkp_pb.ErrorCode_RATE_LIMITED
+	case errors.Is(err, context.DeadlineExceeded):
+		return zkp_pb.ErrorCode_TIMEOUT
+	}
+	return zkp_pb.ErrorCode_INTERNAL
+}
+
+// newResponseError returns the error reported to the client
+func newResponseError(err error) *responseError {
+	code := errorCode(err)
+	response := &responseError{
+		code:    code,
+		message: errorMessages[code],
+	}
+	switch code {
+	case zkp_pb.ErrorCode_INVALID_REQUEST, zkp_pb.ErrorCode_UNSUPPORTED_VERSION:
+		// the error describes what was wrong with the request
+		response.detail = err.Error()
+	}
+	var retry *retryError
+	if errors.As(err, &retry) {
+		response.retryAfter = retry.after
+	}
+	return response
+}
+
+// retryAfterSeconds rounds the retry time up to whole seconds
+func (e *responseError) retryAfterSeconds() uint32 {
+	if e.retryAfter <= 0 {
+		return 0
+	}
+	return uint32((e.retryAfter + time.Second - 1) / time.Second)
+}
+
+// registerResponse returns the failed registration response
+func (e *responseError) registerResponse() *zkp_pb.RegisterResponse {
+	return &zkp_pb.RegisterResponse{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code,
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
+
+// authResponse returns the failed authentication response
+func (e *responseError) authResponse() *zkp_pb.AuthResponse {
+	return &zkp_pb.AuthResponse{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code,
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
+
+// whoAmIResponse returns the failed whoami response
+func (e *responseError) whoAmIResponse() *zkp_pb.WhoAmIResponse {
+	return &zkp_pb.WhoAmIResponse{
+		Result: false,
+		Error:  e.message,
+		Code:   e.code,
+		Detail: e.detail,
+	}
+}
+
+// changePasswordResponse returns the failed password change response
+func (e *responseError) changePasswordResponse() *zkp_pb.ChangePasswordResponse {
+	return &zkp_pb.ChangePasswordResponse{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code,
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
+
+// logoutResponse returns the failed logout response
+func (e *responseError) logoutResponse() *zkp_pb.LogoutResponse {
+	return &zkp_pb.LogoutResponse{
+		Result: false,
+		Error:  e.message,
+		Code:   e.code,
+		Detail: e.detail,
+	}
+}
+
+// appResponse returns the failed application message response
+func (e *responseError) appResponse() *zkp_pb.AppResponse {
+	return &zkp_pb.AppResponse{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code,
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
+
+// introspectResponse returns the failed introspection response
+func (e *responseError) introspectResponse() *zkp_pb.IntrospectResponse {
+	return &zkp_pb.IntrospectResponse{
+		Result: false,
+		Error:  e.message,
+		Code:   e.code,
+		Detail: e.detail,
+	}
+}
+
+// refreshResponse returns the failed token refresh response
+func (e *responseError) refreshResponse() *zkp_pb.RefreshResponse {
+	return &zkp_pb.RefreshResponse{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code,
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
+
+// revokeResponse returns the failed revocation response
+func (e *responseError) revokeResponse() *zkp_pb.RevokeResponse {
+	return &zkp_pb.RevokeResponse{
+		Result: false,
+		Error:  e.message,
+		Code:   e.code,
+		Detail: e.detail,
+	}
+}
+
+// sessionsResponse returns the failed session list response
+func (e *responseError) sessionsResponse() *zkp_pb.SessionsResponse {
+	return &zkp_pb.SessionsResponse{
+		Result: false,
+		Error:  e.message,
+		Code:   e.code,
+		Detail: e.detail,
+	}
+}
+
+// restResult returns the failed HTTP/JSON API result
+func (e *responseError) restResult() *model.RESTResult {
+	return &model.RESTResult{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code.String(),
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
+
+// helloResponse returns the failed hello response
+func (e *responseError) helloResponse() *zkp_pb.HelloResponse {
+	return &zkp_pb.HelloResponse{
+		Result:     false,
+		Error:      e.message,
+		Code:       e.code,
+		RetryAfter: e.retryAfterSeconds(),
+		Detail:     e.detail,
+	}
+}
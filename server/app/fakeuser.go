@@ -0,0 +1,63 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// fakeUserKeySize is the size of the random key generated if FakeUserKey isn't set
+const fakeUserKeySize = 32
+
+// lookupUser returns the commits of the user, the unknown user gets the fake commits
+// known is false for the unknown user, its login has to fail. The fake commits are derived
+// for every user, so the unknown users take the same time and get the challenge as well.
+func (s *Server) lookupUser(user zkp.UUID) (commits *zkp.Commits, known bool, err error) {
+	fake, err := s.fakeCommits(user)
+	if err != nil {
+		return nil, false, err
+	}
+	commits, err = s.registry.Get(user)
+	if errors.Is(err, store.UserDoesNotExistError) {
+		return fake, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return commits, true, nil
+}
+
+// fakeCommits returns the commits of the unknown user derived from FakeUserKey and the user name
+// The same user name always gets the same commits.
+func (s *Server) fakeCommits(user zkp.UUID) (*zkp.Commits, error) {
+	key, err := s.fakeUserKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(user))
+	x := new(big.Int).SetBytes(mac.Sum(nil))
+	x.Mod(x, big.NewInt(zkp.Q))
+	return zkp.NewProver(x.Int64()).CreateRegisterCommits()
+}
+
+// fakeUserKey returns FakeUserKey, the random key is generated once if it isn't set
+func (s *Server) fakeUserKey() ([]byte, error) {
+	if len(s.FakeUserKey) > 0 {
+		return s.FakeUserKey, nil
+	}
+	s.fakeKeyOnce.Do(func() {
+		key := make([]byte, fakeUserKeySize)
+		if _, err := rand.Read(key); err != nil {
+			s.fakeKeyErr = err
+			return
+		}
+		s.fakeKey = key
+	})
+	return s.fakeKey, s.fakeKeyErr
+}
@@ -0,0 +1,66 @@
+package app_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServer_UnknownUser(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.Lockout = svr.Lockout{}
+	server.FakeUserKey = []byte("fake user key")
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+
+	// the unknown user gets the challenge and fails like the wrong password
+	wrongPassword := login(t, mux, "alice", 124)
+	assert.False(wrongPassword.GetResult())
+	assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, wrongPassword.GetCode())
+	unknown := login(t, mux, "mallory", 123)
+	assert.True(proto.Equal(wrongPassword, unknown), "%v != %v", wrongPassword, unknown)
+
+	// the password matching the fake commits fails as well
+	mac := hmac.New(sha256.New, server.FakeUserKey)
+	mac.Write([]byte("mallory"))
+	x := new(big.Int).SetBytes(mac.Sum(nil))
+	x.Mod(x, big.NewInt(zkp.Q))
+	assert.True(proto.Equal(wrongPassword, login(t, mux, "mallory", x.Int64())))
+}
+
+func TestServer_RegisterTakenUser(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	address := startServer(t, server)
+
+	mux := connect(t, address)
+	defer mux.Close()
+	register := func(user string, password int64) *zkp_pb.RegisterResponse {
+		commits, err := zkp.NewProver(password).CreateRegisterCommits()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return request(t, mux, &zkp_pb.RegisterRequest{
+			User:    user,
+			Commits: []*zkp_pb.RegisterRequest_Commits{{Y1: commits.C1.Bytes(), Y2: commits.C2.Bytes()}},
+		}).(*zkp_pb.RegisterResponse)
+	}
+
+	// the taken user name looks registered, the user keeps the password
+	registered := register("alice", 123)
+	assert.True(registered.GetResult())
+	taken := register("alice", 124)
+	assert.True(proto.Equal(registered, taken), "%v != %v", registered, taken)
+	assert.False(login(t, mux, "alice", 124).GetResult())
+	assert.True(login(t, mux, "alice", 123).GetResult())
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"net"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	// grpcService implements ZKPAuth gRPC service on top of the Server
+	grpcService struct {
+		zkp_pb.UnimplementedZKPAuthServer
+		server *Server
+	}
+)
+
+// NewGRPCService returns ZKPAuth gRPC service backed by the server
+// Use it to register the service on an existing gRPC server.
+func NewGRPCService(s *Server) zkp_pb.ZKPAuthServer {
+	return &grpcService{server: s}
+}
+
+// RunGRPCContext starts the gRPC server and serves until the context is cancelled
+func (s *Server) RunGRPCContext(ctx context.Context, port string) error {
+	l, err := Listen(port)
+	if err != nil {
+		return err
+	}
+	return s.ServeGRPC(ctx, l)
+}
+
+// ServeGRPC serves ZKPAuth gRPC service on the listener until the context is cancelled or Shutdown is called
+func (s *Server) ServeGRPC(ctx context.Context, l net.Listener) error {
+	l = s.limitListener(ctx, l)
+	var options []grpc.ServerOption
+	if s.TLSConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(s.TLSConfig)))
+	}
+	grpcServer := grpc.NewServer(options...)
+	zkp_pb.RegisterZKPAuthServer(grpcServer, NewGRPCService(s))
+
+	untrack, err := s.shutdown.trackTransport(func(ctx context.Context) error {
+		// the RPCs in progress finish
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			grpcServer.Stop()
+			<-stopped
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		l.Close()
+		return err
+	}
+	defer untrack()
+
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-ctx.Done():
+			grpcServer.Stop()
+		case <-served:
+		}
+	}()
+
+	s.infof("Listening gRPC on %v", l.Addr())
+	return grpcServer.Serve(l)
+}
+
+// Register registers a new user
+func (g *grpcService) Register(ctx context.Context, registerRequest *zkp_pb.RegisterRequest) (*zkp_pb.RegisterResponse, error) {
+	response, err := g.server.register(grpcContext(ctx), registerRequest)
+	if response.Code == zkp_pb.ErrorCode_INVALID_REQUEST {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		// log the error and reply with the response
+		g.server.errorf("%v", err)
+	}
+	return response, nil
+}
+
+// Authenticate runs the interactive authentication on the stream
+func (g *grpcService) Authenticate(stream zkp_pb.ZKPAuth_AuthenticateServer) error {
+	ctx := stream.Context()
+	conn := zkp.NewGRPCServerConn(stream)
+
+	readCtx, cancel := WithTimeout(ctx, g.server.Timeouts.Request)
+	msg, err := conn.ReadMessageContext(readCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	authRequest, ok := msg.(*zkp_pb.AuthRequest)
+	if !ok {
+		return status.Error(codes.InvalidArgument, WrongRequestError.Error())
+	}
+
+	if err := g.server.serveAuth(grpcContext(ctx), conn, nil, authRequest); err != nil {
+		// the error code was reported to the client, log the error
+		g.server.errorf("%v", err)
+	}
+	return nil
+}
+
+// grpcContext returns the call context carrying the client address for the rate limits
+func grpcContext(ctx context.Context) context.Context {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return withRemoteAddr(ctx, p.Addr.String())
+	}
+	return ctx
+}
@@ -0,0 +1,176 @@
+package app_test
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"testing"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient runs the gRPC service in memory and returns a connected client
+func newGRPCClient(t *testing.T) zkp_pb.ZKPAuthClient {
+	listener := bufconn.Listen(1024 * 1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svr.NewServer().ServeGRPC(ctx, listener)
+	}()
+
+	conn, err := grpc.DialContext(ctx, "bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		<-done
+	})
+	return zkp_pb.NewZKPAuthClient(conn)
+}
+
+func registerGRPC(t *testing.T, client zkp_pb.ZKPAuthClient, user string, password int64) *zkp_pb.RegisterResponse {
+	commits, err := zkp.NewProver(password).CreateRegisterCommits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Register(context.Background(), &zkp_pb.RegisterRequest{
+		User: user,
+		Commits: []*zkp_pb.RegisterRequest_Commits{
+			{Y1: commits.C1.Bytes(), Y2: commits.C2.Bytes()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func authenticateGRPC(t *testing.T, client zkp_pb.ZKPAuthClient, user string, password int64) *zkp_pb.AuthResponse {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Authenticate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := zkp.NewGRPCClientConn(stream)
+
+	prover := zkp.NewProver(password)
+	commits, err := prover.CreateAuthenticationCommits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.SendMessageContext(ctx, &zkp_pb.AuthRequest{
+		User: user,
+		Commits: []*zkp_pb.AuthRequest_Commits{
+			{R1: commits.C1.Bytes(), R2: commits.C2.Bytes()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := conn.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authResponse, ok := msg.(*zkp_pb.AuthResponse); ok {
+		// failed before the challenge
+		return authResponse
+	}
+	challengeResponse, ok := msg.(*zkp_pb.ChallengeResponse)
+	if !ok {
+		t.Fatalf("unexpected message %q", zkp.MessageName(msg))
+	}
+
+	challenge := new(big.Int).SetBytes(challengeResponse.GetChallenge())
+	answer := prover.ProveAuthentication(challenge)
+	if err := conn.SendMessageContext(ctx, &zkp_pb.AnswerRequest{Answer: answer.Bytes()}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = conn.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authResponse, ok := msg.(*zkp_pb.AuthResponse)
+	if !ok {
+		t.Fatalf("unexpected message %q", zkp.MessageName(msg))
+	}
+	return authResponse
+}
+
+func TestGRPCService_Register(t *testing.T) {
+	assert := assert.New(t)
+	client := newGRPCClient(t)
+
+	response := registerGRPC(t, client, "max", 123)
+	assert.True(response.Result)
+
+	// the duplicate user looks registered
+	response = registerGRPC(t, client, "max", 123)
+	assert.True(response.Result)
+	assert.Empty(response.Error)
+
+	// malformed request
+	_, err := client.Register(context.Background(), &zkp_pb.RegisterRequest{User: "max"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCService_Authenticate(t *testing.T) {
+	assert := assert.New(t)
+	client := newGRPCClient(t)
+
+	response := registerGRPC(t, client, "max", 123)
+	assert.True(response.Result)
+
+	tests := map[string]struct {
+		user         string
+		password     int64
+		expected     bool
+		expectedCode zkp_pb.ErrorCode
+	}{
+		"correct password": {
+			user:     "max",
+			password: 123,
+			expected: true,
+		},
+		"wrong password": {
+			user:         "max",
+			password:     124,
+			expected:     false,
+			expectedCode: zkp_pb.ErrorCode_AUTH_FAILED,
+		},
+		"unknown user": {
+			user:         "john",
+			password:     123,
+			expected:     false,
+			expectedCode: zkp_pb.ErrorCode_AUTH_FAILED,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			authResponse := authenticateGRPC(t, client, test.user, test.password)
+			assert.Equal(test.expected, authResponse.Result)
+			assert.Equal(test.expectedCode, authResponse.Code)
+			// the response doesn't reveal whether the user exists
+			assert.Empty(authResponse.Detail)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// commandSeparator joins AppRequest and the application command in the handler message type
+const commandSeparator = "/"
+
+type (
+	// HandlerFunc serves the request starting the stream
+	// The handler sends the responses with Request.Respond, or Request.Fail, and may read the next messages
+	// of the exchange from Request.Conn. The returned error is logged.
+	HandlerFunc func(ctx context.Context, req *Request) error
+
+	// Middleware wraps the handler, e.g. to reject the request with Request.Fail before it is handled
+	Middleware func(next HandlerFunc) HandlerFunc
+
+	// Request is the first message of the stream passed to the handler
+	Request struct {
+		// Type is the message type or the application command the handler is registered for
+		Type string
+		// Message is the request, e.g. *zkp_pb.AppRequest for the application commands
+		Message proto.Message
+		// Conn is the stream of the exchange
+		Conn zkp.MessageConn
+		// User is the user logged in on the connection, set by RequireLogin
+		User zkp.UUID
+
+		server *Server
+		stream *zkp.Stream
+		sess   *session
+		// failure returns the failed response of the request, the stream is aborted if nil
+		failure func(e *responseError) proto.Message
+	}
+
+	// handlers are the stream handlers by the message type
+	handlers struct {
+		mu         sync.RWMutex
+		byType     map[string]HandlerFunc
+		middleware []Middleware
+	}
+)
+
+// failureResponses build the failed responses of the built-in request types
+var failureResponses = map[string]func(e *responseError) proto.Message{
+	"RegisterRequest":       func(e *responseError) proto.Message { return e.registerResponse() },
+	"AuthRequest":           func(e *responseError) proto.Message { return e.authResponse() },
+	"WhoAmIRequest":         func(e *responseError) proto.Message { return e.whoAmIResponse() },
+	"ChangePasswordRequest": func(e *responseError) proto.Message { return e.changePasswordResponse() },
+	"LogoutRequest":         func(e *responseError) proto.Message { return e.logoutResponse() },
+	"AppRequest":            func(e *responseError) proto.Message { return e.appResponse() },
+	"IntrospectRequest":     func(e *responseError) proto.Message { return e.introspectResponse() },
+	"RefreshRequest":        func(e *responseError) proto.Message { return e.refreshResponse() },
+	"RevokeRequest":         func(e *responseError) proto.Message { return e.revokeResponse() },
+	"SessionsRequest":       func(e *responseError) proto.Message { return e.sessionsResponse() },
+}
+
+// AppCommand returns the message type of the application command carried by AppRequest
+func AppCommand(command string) string {
+	return zkp.MessageName(&zkp_pb.AppRequest{}) + commandSeparator + command
+}
+
+// Handle registers the handler of the stream request type, e.g. "AuthRequest", replacing the previous one
+// The middleware wraps the handler in the order given, the first one runs first.
+// The request types of the application are registered with zkp.RegisterMessage on both peers,
+// they are carried in the Frame extension and Request.Fail aborts their streams.
+func (s *Server) Handle(messageType string, handler HandlerFunc, middleware ...Middleware) {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	s.handlers.mu.Lock()
+	defer s.handlers.mu.Unlock()
+	if s.handlers.byType == nil {
+		s.handlers.byType = make(map[string]HandlerFunc)
+	}
+	s.handlers.byType[messageType] = handler
+}
+
+// HandleCommand registers the handler of the application command sent in AppRequest
+// The command is protected, it runs after RequireLogin and the other middleware.
+// The returned payload is sent back in AppResponse.
+func (s *Server) HandleCommand(command string, handler AppHandler, middleware ...Middleware) {
+	serve := func(ctx context.Context, req *Request) error {
+		payload, err := handler(ctx, req.User, req.Message.(*zkp_pb.AppRequest).GetPayload())
+		if err != nil {
+			return req.Fail(ctx, err)
+		}
+		return req.Respond(ctx, &zkp_pb.AppResponse{Result: true, Payload: payload})
+	}
+	s.Handle(AppCommand(command), serve, append([]Middleware{s.RequireLogin}, middleware...)...)
+}
+
+// Use adds the middleware wrapping all handlers, e.g. LogRequests
+func (s *Server) Use(middleware ...Middleware) {
+	s.handlers.mu.Lock()
+	defer s.handlers.mu.Unlock()
+	s.handlers.middleware = append(s.handlers.middleware, middleware...)
+}
+
+// handler returns the handler of the message type wrapped by the middleware of Use, nil if there is none
+func (s *Server) handler(messageType string) HandlerFunc {
+	s.handlers.mu.RLock()
+	defer s.handlers.mu.RUnlock()
+	handler, ok := s.handlers.byType[messageType]
+	if !ok {
+		return nil
+	}
+	for i := len(s.handlers.middleware) - 1; i >= 0; i-- {
+		handler = s.handlers.middleware[i](handler)
+	}
+	return handler
+}
+
+// handleBuiltins registers the handlers of the protocol requests
+func (s *Server) handleBuiltins() {
+	s.Handle("RegisterRequest", func(ctx context.Context, req *Request) error {
+		return s.serveRegistration(ctx, req.Conn, req.Message.(*zkp_pb.RegisterRequest))
+	})
+	s.Handle("AuthRequest", func(ctx context.Context, req *Request) error {
+		return s.serveAuth(ctx, req.Conn, req.sess, req.Message.(*zkp_pb.AuthRequest))
+	})
+	s.Handle("WhoAmIRequest", func(ctx context.Context, req *Request) error {
+		return s.serveWhoAmI(ctx, req.Conn, req.sess)
+	})
+	s.Handle("ChangePasswordRequest", func(ctx context.Context, req *Request) error {
+		return s.serveChangePassword(ctx, req.Conn, req.sess, req.Message.(*zkp_pb.ChangePasswordRequest))
+	})
+	s.Handle("LogoutRequest", func(ctx context.Context, req *Request) error {
+		return s.serveLogout(ctx, req.Conn, req.sess)
+	})
+	s.Handle("AppRequest", func(ctx context.Context, req *Request) error {
+		return s.serveApp(ctx, req.Conn, req.sess, req.Message.(*zkp_pb.AppRequest))
+	})
+	s.Handle("IntrospectRequest", func(ctx context.Context, req *Request) error {
+		return s.serveIntrospect(ctx, req.Conn, req.Message.(*zkp_pb.IntrospectRequest))
+	})
+	s.Handle("RefreshRequest", func(ctx context.Context, req *Request) error {
+		return s.serveRefresh(ctx, req.Conn, req.Message.(*zkp_pb.RefreshRequest))
+	})
+	s.Handle("RevokeRequest", func(ctx context.Context, req *Request) error {
+		return s.serveRevoke(ctx, req.Conn, req.sess, req.Message.(*zkp_pb.RevokeRequest))
+	})
+	s.Handle("SessionsRequest", func(ctx context.Context, req *Request) error {
+		return s.serveSessions(ctx, req.Conn, req.sess, req.Message.(*zkp_pb.SessionsRequest))
+	})
+}
+
+// newRequest returns the request starting the stream, AppRequest carrying a command gets the command type
+func (s *Server) newRequest(sess *session, stream *zkp.Stream, msg proto.Message) *Request {
+	messageType := zkp.MessageName(msg)
+	failure := failureResponses[messageType]
+	if app, ok := msg.(*zkp_pb.AppRequest); ok && app.GetCommand() != "" {
+		messageType = AppCommand(app.GetCommand())
+	}
+	return &Request{
+		Type:    messageType,
+		Message: msg,
+		Conn:    stream,
+		server:  s,
+		stream:  stream,
+		sess:    sess,
+		failure: failure,
+	}
+}
+
+// Respond sends the response of the request
+func (r *Request) Respond(ctx context.Context, response proto.Message) error {
+	return r.server.send(ctx, r.Conn, response)
+}
+
+// Fail sends the failed response of the request type and returns the error
+// The stream is aborted if the request type has no known response.
+func (r *Request) Fail(ctx context.Context, err error) error {
+	if r.failure == nil {
+		abortCtx, cancel := WithTimeout(ctx, r.server.Timeouts.Write)
+		defer cancel()
+		if err := r.stream.Abort(abortCtx); err != nil {
+			r.server.errorf("%v", err)
+		}
+		return err
+	}
+	if err := r.Respond(ctx, r.failure(newResponseError(err))); err != nil {
+		// log the error and continue
+		r.server.errorf("%v", err)
+	}
+	return err
+}
+
+// command returns the application command of the request, empty if it isn't one
+func (r *Request) command() string {
+	i := strings.Index(r.Type, commandSeparator)
+	if i < 0 {
+		return ""
+	}
+	return r.Type[i+1:]
+}
+
+// RequireLogin is the middleware rejecting the request with UNAUTHENTICATED
+// unless a user logged in with the ZKP on the connection, the user is set in Request.User
+func (s *Server) RequireLogin(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, req *Request) error {
+		user, _, err := s.currentUser(req.sess)
+		if err != nil {
+			return req.Fail(ctx, err)
+		}
+		req.User = user
+		return next(ctx, req)
+	}
+}
+
+// RateLimit returns the middleware limiting the operation with RateLimits like the registrations
+// The per-user limit applies after RequireLogin, the anonymous requests are limited per client address and in total.
+func (s *Server) RateLimit(operation string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *Request) error {
+			if err := s.limit(ctx, operation, req.User); err != nil {
+				return req.Fail(ctx, err)
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// LogRequests is the middleware logging the handled requests at the debug level
+func (s *Server) LogRequests(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, req *Request) error {
+		start := time.Now()
+		err := next(ctx, req)
+		result := "ok"
+		if err != nil {
+			result = err.Error()
+		}
+		s.debugf("%s of user %q from %q handled in %v: %s", req.Type, req.User, remoteIP(ctx), time.Since(start), result)
+		return err
+	}
+}
+
+// unknownRequest rejects the request without the handler
+// The commands are protected, the anonymous clients can't tell the unknown ones from the registered ones.
+func (r *Request) unknownRequest(ctx context.Context) error {
+	if command := r.command(); command != "" {
+		unknown := func(ctx context.Context, req *Request) error {
+			return req.Fail(ctx, fmt.Errorf("%w: command %q", UnknownRequestError, command))
+		}
+		return r.server.RequireLogin(unknown)(ctx, r)
+	}
+	// nothing to answer, the stream is aborted to tell the client to give up
+	return r.Fail(ctx, UnknownRequestError)
+}
@@ -0,0 +1,137 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func command(t *testing.T, mux *zkp.Mux, name string, payload string) *zkp_pb.AppResponse {
+	return request(t, mux, &zkp_pb.AppRequest{Command: name, Payload: []byte(payload)}).(*zkp_pb.AppResponse)
+}
+
+func TestServer_HandleCommand(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.HandleCommand("balance", func(ctx context.Context, user zkp.UUID, payload []byte) ([]byte, error) {
+		if string(payload) != "EUR" {
+			return nil, svr.WrongRequestError
+		}
+		return []byte(string(user) + ": 100 EUR"), nil
+	})
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+	other := connect(t, address)
+	defer other.Close()
+
+	// the command runs after the login on the same connection only
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, command(t, mux, "balance", "EUR").GetCode())
+	// the unknown commands are protected as well
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, command(t, mux, "unknown", "").GetCode())
+	assert.True(login(t, other, "alice", 123).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, command(t, mux, "balance", "EUR").GetCode())
+	assert.False(login(t, mux, "alice", 124).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, command(t, mux, "balance", "EUR").GetCode())
+	assert.True(login(t, mux, "alice", 123).GetResult())
+
+	response := command(t, mux, "balance", "EUR")
+	assert.True(response.GetResult())
+	assert.Equal([]byte("alice: 100 EUR"), response.GetPayload())
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, command(t, mux, "balance", "USD").GetCode())
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, command(t, mux, "unknown", "").GetCode())
+	// the default handler echoes the payload
+	assert.Equal([]byte("hi"), command(t, mux, "", "hi").GetPayload())
+
+	// the logout protects the command again
+	assert.True(request(t, mux, &zkp_pb.LogoutRequest{}).(*zkp_pb.LogoutResponse).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, command(t, mux, "balance", "EUR").GetCode())
+}
+
+func TestServer_Handle_Middleware(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.RateLimits = svr.RateLimits{PerUser: svr.RateLimit{Rate: 0.001, Burst: 2}}
+
+	var mu sync.Mutex
+	var handled []string
+	server.Use(server.LogRequests, func(next svr.HandlerFunc) svr.HandlerFunc {
+		return func(ctx context.Context, req *svr.Request) error {
+			mu.Lock()
+			handled = append(handled, req.Type)
+			mu.Unlock()
+			return next(ctx, req)
+		}
+	})
+	server.HandleCommand("ping", func(ctx context.Context, user zkp.UUID, payload []byte) ([]byte, error) {
+		return []byte("pong"), nil
+	}, server.RateLimit("ping"))
+	// the built-in handler is replaced
+	server.Handle("WhoAmIRequest", func(ctx context.Context, req *svr.Request) error {
+		return req.Respond(ctx, &zkp_pb.WhoAmIResponse{Result: true, User: "root"})
+	})
+	server.Handle("IntrospectRequest", func(ctx context.Context, req *svr.Request) error {
+		return req.Fail(ctx, errors.New("disabled"))
+	})
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+	assert.Equal("root", request(t, mux, &zkp_pb.WhoAmIRequest{}).(*zkp_pb.WhoAmIResponse).GetUser())
+	assert.Equal(zkp_pb.ErrorCode_INTERNAL, request(t, mux, &zkp_pb.IntrospectRequest{}).(*zkp_pb.IntrospectResponse).GetCode())
+	assert.True(login(t, mux, "alice", 123).GetResult())
+
+	// the per-user limit applies to the logged in user
+	assert.True(command(t, mux, "ping", "").GetResult())
+	assert.True(command(t, mux, "ping", "").GetResult())
+	limited := command(t, mux, "ping", "")
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, limited.GetCode())
+	assert.NotZero(limited.GetRetryAfter())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]string{
+		"WhoAmIRequest",
+		"IntrospectRequest",
+		"AuthRequest",
+		svr.AppCommand("ping"),
+		svr.AppCommand("ping"),
+		svr.AppCommand("ping"),
+	}, handled)
+}
+
+func TestServer_Handle_Message(t *testing.T) {
+	assert := assert.New(t)
+	// the application messages are sent in the Frame extension
+	assert.NoError(zkp.RegisterMessage(&wrapperspb.StringValue{}))
+	server := svr.NewServer()
+	server.Handle("StringValue", func(ctx context.Context, req *svr.Request) error {
+		greeting := "hello " + req.Message.(*wrapperspb.StringValue).GetValue() + ", " + string(req.User)
+		return req.Respond(ctx, &wrapperspb.StringValue{Value: greeting})
+	}, server.RequireLogin)
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+
+	// the failed request without the known response aborts the stream
+	stream, err := mux.Open()
+	assert.NoError(err)
+	defer stream.Close()
+	assert.NoError(stream.SendMessageContext(context.Background(), &wrapperspb.StringValue{Value: "world"}))
+	_, err = stream.ReadMessageContext(context.Background())
+	assert.ErrorIs(err, zkp.StreamAbortedError)
+
+	assert.True(login(t, mux, "alice", 123).GetResult())
+	response := request(t, mux, &wrapperspb.StringValue{Value: "world"})
+	assert.True(proto.Equal(&wrapperspb.StringValue{Value: "hello world, alice"}, response))
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+// handshake negotiates the protocol parameters, the connection must start with Hello
+func (s *Server) handshake(ctx context.Context, framer *zkp.Framer) error {
+	readCtx, cancel := WithTimeout(ctx, s.Timeouts.Request)
+	msg, err := framer.ReadMessageContext(readCtx)
+	cancel()
+	if errors.Is(err, zkp.HelloRequiredError) || errors.Is(err, zkp.UnsupportedFrameVersionError) {
+		// tell the client why the connection is closed
+		if sendErr := s.send(ctx, framer, newResponseError(err).helloResponse()); sendErr != nil {
+			return sendErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	hello, ok := msg.(*zkp_pb.Hello)
+	if !ok {
+		return WrongRequestError
+	}
+
+	// the authentication runs with the implemented parameters only
+	response, negotiateErr := s.Capabilities.Implemented().Negotiate(hello)
+	if negotiateErr != nil {
+		response = newResponseError(negotiateErr).helloResponse()
+	}
+	if err := s.send(ctx, framer, response); err != nil {
+		return err
+	}
+	return negotiateErr
+}
@@ -0,0 +1,111 @@
+package app_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServer_HelloRequired(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(svr.NewServer().WebSocketHandler())
+	defer server.Close()
+
+	framer := dialWebSocket(t, server.URL)
+	err := framer.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"})
+	assert.NoError(err)
+
+	// the server explains the failure and closes the connection
+	msg, err := framer.ReadMessageContext(ctx)
+	assert.NoError(err)
+	response, ok := msg.(*zkp_pb.HelloResponse)
+	assert.True(ok)
+	assert.False(response.Result)
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, response.Code)
+	assert.Equal(zkp.HelloRequiredError.Error(), response.Detail)
+	_, err = framer.ReadMessageContext(ctx)
+	assert.Error(err)
+}
+
+func TestServer_HelloMismatch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(svr.NewServer().WebSocketHandler())
+	defer server.Close()
+
+	framer := dialWebSocket(t, server.URL)
+	client := zkp.DefaultCapabilities
+	client.Versions = []uint32{zkp.ProtocolVersion + 1}
+	err := framer.SendMessageContext(ctx, client.Hello())
+	assert.NoError(err)
+
+	msg, err := framer.ReadMessageContext(ctx)
+	assert.NoError(err)
+	response, ok := msg.(*zkp_pb.HelloResponse)
+	assert.True(ok)
+	assert.Equal(zkp_pb.ErrorCode_UNSUPPORTED_VERSION, response.Code)
+	assert.ErrorIs(client.Check(response), zkp.NegotiationError)
+	_, err = framer.ReadMessageContext(ctx)
+	assert.Error(err)
+}
+
+func TestServer_HelloNotImplemented(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	zkpServer := svr.NewServer()
+	zkpServer.Capabilities.ProofModes = []string{"non-interactive", zkp.ProofInteractive}
+	server := httptest.NewServer(zkpServer.WebSocketHandler())
+	defer server.Close()
+
+	// the parameter offered by the server without the implementation isn't chosen
+	client := zkp.DefaultCapabilities
+	for _, modes := range [][]string{{"non-interactive", zkp.ProofInteractive}, {"non-interactive"}} {
+		framer := dialWebSocket(t, server.URL)
+		client.ProofModes = modes
+		assert.NoError(framer.SendMessageContext(ctx, client.Hello()))
+		msg, err := framer.ReadMessageContext(ctx)
+		assert.NoError(err)
+		response, ok := msg.(*zkp_pb.HelloResponse)
+		if !assert.True(ok) {
+			continue
+		}
+		if len(modes) > 1 {
+			assert.True(response.Result)
+			assert.Equal(zkp.ProofInteractive, response.ProofMode)
+		} else {
+			assert.False(response.Result)
+			assert.Equal(zkp_pb.ErrorCode_UNSUPPORTED_VERSION, response.Code)
+		}
+	}
+}
+
+func TestServer_FrameVersion(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(svr.NewServer().WebSocketHandler())
+	defer server.Close()
+
+	framer := dialWebSocket(t, server.URL)
+	out, err := proto.Marshal(&zkp_pb.Frame{
+		Version: zkp.FrameVersion + 1,
+		Message: &zkp_pb.Frame_Hello{Hello: zkp.DefaultCapabilities.Hello()},
+	})
+	assert.NoError(err)
+	assert.NoError(framer.WriteFrame(out))
+
+	// the server answers in the frame version it supports
+	msg, err := framer.ReadMessageContext(ctx)
+	assert.NoError(err)
+	response, ok := msg.(*zkp_pb.HelloResponse)
+	assert.True(ok)
+	assert.Equal(zkp_pb.ErrorCode_UNSUPPORTED_VERSION, response.Code)
+	_, err = framer.ReadMessageContext(ctx)
+	assert.Error(err)
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// UnixScheme prefixes the unix domain socket path
+	UnixScheme = "unix://"
+	// FDScheme prefixes the number of the inherited listener file descriptor
+	FDScheme = "fd://"
+
+	// systemdFirstFD is the first file descriptor passed by systemd socket activation
+	systemdFirstFD = 3
+)
+
+var (
+	InvalidAddressError = errors.New("invalid listen address")
+)
+
+// Listen creates the listener for the address
+//
+// Supported addresses:
+// 8080              - TCP port on all interfaces
+// host:port         - TCP address, IPv6 hosts in brackets: [::1]:8080
+// tcp://host:port   - TCP address
+// unix:///path      - unix domain socket, a stale socket file is replaced
+// fd://3            - listener file descriptor inherited from the parent process
+func Listen(address string) (net.Listener, error) {
+	network, address, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case "unix":
+		return listenUnix(address)
+	case "fd":
+		fd, _ := strconv.Atoi(address)
+		return fileListener(uintptr(fd), FDScheme+address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// ValidateAddress checks the address is supported by Listen without listening on it
+func ValidateAddress(address string) error {
+	_, _, err := parseAddress(address)
+	return err
+}
+
+// parseAddress returns the network (tcp, unix or fd) and the address without the scheme
+func parseAddress(address string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(address, UnixScheme):
+		path := strings.TrimPrefix(address, UnixScheme)
+		if path == "" {
+			return "", "", fmt.Errorf("%w: empty unix socket path", InvalidAddressError)
+		}
+		return "unix", path, nil
+	case strings.HasPrefix(address, FDScheme):
+		fd, err := strconv.Atoi(strings.TrimPrefix(address, FDScheme))
+		if err != nil || fd < 0 {
+			return "", "", fmt.Errorf("%w: %q", InvalidAddressError, address)
+		}
+		return "fd", strconv.Itoa(fd), nil
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	case !strings.Contains(address, ":"):
+		// port only
+		address = ":" + address
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", fmt.Errorf("%w: %v", InvalidAddressError, err)
+	}
+	return "tcp", address, nil
+}
+
+// SystemdListeners returns the listeners passed by systemd socket activation
+// Returns no listeners if the process wasn't socket activated.
+// The environment variables are unset so child processes don't inherit them.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		fd := systemdFirstFD + i
+		name := FDScheme + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		l, err := fileListener(uintptr(fd), name)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// fileListener creates the listener from the inherited file descriptor
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, fmt.Errorf("%w: %q", InvalidAddressError, name)
+	}
+	// the listener keeps a close-on-exec duplicate of the descriptor
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listenUnix listens on the unix domain socket
+// A socket file left behind by a crashed server is removed, other files are never replaced.
+func listenUnix(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err == nil || !errors.Is(err, syscall.EADDRINUSE) {
+		return l, err
+	}
+
+	info, statErr := os.Stat(path)
+	if statErr != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil, err
+	}
+	if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+		// another server is listening
+		conn.Close()
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,168 @@
+package app_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListen(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "zkp.sock")
+	tests := map[string]struct {
+		address string
+		network string
+	}{
+		"port":          {address: "0", network: "tcp"},
+		"host and port": {address: "127.0.0.1:0", network: "tcp"},
+		"tcp scheme":    {address: "tcp://127.0.0.1:0", network: "tcp"},
+		"ipv6":          {address: "[::1]:0", network: "tcp"},
+		"unix socket":   {address: svr.UnixScheme + socket, network: "unix"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			l, err := svr.Listen(test.address)
+			if name == "ipv6" && err != nil {
+				t.Skip("IPv6 isn't available: ", err)
+			}
+			assert.NoError(err)
+			defer l.Close()
+			assert.Equal(test.network, l.Addr().Network())
+		})
+	}
+}
+
+func TestListen_Errors(t *testing.T) {
+	for _, address := range []string{"unix://", "fd://", "fd://x", "fd://-1", "1:2:3"} {
+		_, err := svr.Listen(address)
+		assert.ErrorIs(t, err, svr.InvalidAddressError, address)
+		assert.ErrorIs(t, svr.ValidateAddress(address), svr.InvalidAddressError, address)
+	}
+}
+
+func TestListen_InheritedFD(t *testing.T) {
+	assert := assert.New(t)
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	assert.NoError(err)
+	// Listen owns the descriptor, the file would close it again when collected
+	fd, err := syscall.Dup(int(f.Fd()))
+	assert.NoError(err)
+	f.Close()
+
+	l, err := svr.Listen(svr.FDScheme + strconv.Itoa(fd))
+	assert.NoError(err)
+	defer l.Close()
+	assert.Equal(parent.Addr().String(), l.Addr().String())
+}
+
+func TestListen_StaleUnixSocket(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "zkp.sock")
+
+	// a crashed server leaves the socket file behind
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	assert.NoError(err)
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := svr.Listen(svr.UnixScheme + socket)
+	assert.NoError(err)
+	defer l.Close()
+
+	// the socket of the running server isn't replaced
+	_, err = svr.Listen(svr.UnixScheme + socket)
+	assert.Error(err)
+
+	// other files are never replaced
+	file := filepath.Join(dir, "file")
+	assert.NoError(os.WriteFile(file, nil, 0600))
+	_, err = svr.Listen(svr.UnixScheme + file)
+	assert.Error(err)
+	_, err = os.Stat(file)
+	assert.NoError(err)
+}
+
+func TestServer_ServeListeners(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tcp, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+	socket := filepath.Join(t.TempDir(), "zkp.sock")
+	unix, err := svr.Listen(svr.UnixScheme + socket)
+	assert.NoError(err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svr.NewServer().ServeListeners(ctx, tcp, unix)
+	}()
+
+	for i, l := range []net.Listener{tcp, unix} {
+		conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		assert.NoError(err)
+		framer := zkp.NewFramer(conn, conn)
+		handshake(t, framer)
+
+		commits, err := zkp.NewProver(123).CreateRegisterCommits()
+		assert.NoError(err)
+		err = framer.SendMessageContext(ctx, &zkp_pb.RegisterRequest{
+			User: "user-" + strconv.Itoa(i),
+			Commits: []*zkp_pb.RegisterRequest_Commits{
+				{Y1: commits.C1.Bytes(), Y2: commits.C2.Bytes()},
+			},
+		})
+		assert.NoError(err)
+		msg, err := framer.ReadMessageContext(ctx)
+		assert.NoError(err)
+		response, ok := msg.(*zkp_pb.RegisterResponse)
+		assert.True(ok)
+		assert.True(response.Result)
+		conn.Close()
+	}
+
+	// cancelling the context stops all listeners
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(time.Second):
+		t.Fatal("listeners didn't stop")
+	}
+	_, err = os.Stat(socket)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestServer_Serve_ClosedListener(t *testing.T) {
+	assert := assert.New(t)
+	l, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svr.NewServer().Serve(l)
+	}()
+	l.Close()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// UserLockedError is reported as RATE_LIMITED, the same for the existing and the unknown users
+var UserLockedError = errors.New("too many failed logins")
+
+// Lockout delays the next login after the consecutive failed ones
+// The failures are counted for any user name, so the lockout doesn't tell whether the user exists.
+// The zero Lockout disables it.
+type Lockout struct {
+	// FreeAttempts are the failures allowed without the delay
+	FreeAttempts int
+	// Delay is the wait after the first failure exceeding FreeAttempts, doubled by each next one up to MaxDelay
+	// Zero MaxDelay keeps the Delay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// LockAttempts are the failures locking the user for LockDuration, 0 never locks
+	// The failures are forgotten after the longest wait since the last one.
+	LockAttempts int
+	LockDuration time.Duration
+}
+
+// DefaultLockout is the lockout used by NewServer
+var DefaultLockout = Lockout{
+	FreeAttempts: 3,
+	Delay:        time.Second,
+	MaxDelay:     time.Minute,
+	LockAttempts: 10,
+	LockDuration: 15 * time.Minute,
+}
+
+// Unlock forgets the failed logins of the user, so the user logs in without the delay
+func (s *Server) Unlock(user zkp.UUID) error {
+	if err := s.failures.ResetFailures(user); err != nil {
+		return err
+	}
+	s.audit(AuditEvent{Type: AuditUserUnlocked, User: user, Time: time.Now()})
+	return nil
+}
+
+// wait returns the delay after the failures
+func (l Lockout) wait(failures int) time.Duration {
+	if l.LockAttempts > 0 && failures >= l.LockAttempts {
+		return l.LockDuration
+	}
+	if failures <= l.FreeAttempts || l.Delay <= 0 {
+		return 0
+	}
+	delay := l.Delay
+	for i := l.FreeAttempts + 1; i < failures && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	if l.MaxDelay > 0 && delay > l.MaxDelay {
+		delay = l.MaxDelay
+	}
+	return delay
+}
+
+// keep returns the time the failures are kept after the last one, the longest wait
+func (l Lockout) keep() time.Duration {
+	keep := l.LockDuration
+	if l.MaxDelay > keep {
+		keep = l.MaxDelay
+	}
+	if l.Delay > keep {
+		keep = l.Delay
+	}
+	return keep
+}
+
+// enabled tells whether the failures delay or lock the logins
+func (l Lockout) enabled() bool {
+	return l.Delay > 0 || l.LockAttempts > 0
+}
+
+// reserveAttempt counts the login attempt as failed before the challenge is issued, the success forgets it
+// The attempt is checked and counted at once, so the concurrent logins don't get more attempts than allowed.
+// Returns UserLockedError telling when to retry if the user has to wait after the failed logins,
+// ServerBusyError if the store can't count the failures of another user name.
+func (s *Server) reserveAttempt(user zkp.UUID) (*store.Failures, error) {
+	if !s.Lockout.enabled() {
+		return &store.Failures{}, nil
+	}
+	s.attempts.Lock()
+	defer s.attempts.Unlock()
+	failures, err := s.failures.Failures(user)
+	if err != nil {
+		return nil, err
+	}
+	retryAt := s.retryAt(failures)
+	if wait := time.Until(retryAt); wait > 0 {
+		return nil, &retryError{
+			error: fmt.Errorf("%w: user %q", UserLockedError, user),
+			after: wait,
+		}
+	}
+	now := time.Now()
+	failures, err = s.failures.AddFailure(user, now, now.Add(s.Lockout.keep()))
+	if errors.Is(err, store.FailuresFullError) {
+		return nil, &retryError{
+			error: fmt.Errorf("%w: %v", ServerBusyError, err),
+			after: rejectRetryAfter,
+		}
+	}
+	return failures, err
+}
+
+// loginFailed audits the failed login of the user counted by reserveAttempt, the unknown users are counted the same
+func (s *Server) loginFailed(ctx context.Context, user zkp.UUID, failures *store.Failures) {
+	event := AuditEvent{
+		Type:     AuditLoginFailed,
+		User:     user,
+		RemoteIP: remoteIP(ctx),
+		Time:     time.Now(),
+		Failures: failures.Count,
+		RetryAt:  s.retryAt(failures),
+	}
+	s.audit(event)
+	if s.Lockout.LockAttempts > 0 && failures.Count == s.Lockout.LockAttempts {
+		event.Type = AuditUserLocked
+		s.audit(event)
+	}
+}
+
+// loginSucceeded forgets the failed logins of the user
+func (s *Server) loginSucceeded(ctx context.Context, user zkp.UUID) {
+	failures, err := s.failures.Failures(user)
+	if err == nil && failures.Count > 0 {
+		err = s.failures.ResetFailures(user)
+	}
+	if err != nil {
+		s.errorf("fail to reset the failed logins of user %q: %v", user, err)
+	}
+	s.audit(AuditEvent{Type: AuditLoginSucceeded, User: user, RemoteIP: remoteIP(ctx), Time: time.Now()})
+}
+
+// retryAt returns the time the next login is allowed at, zero if there is no delay
+func (s *Server) retryAt(failures *store.Failures) time.Time {
+	wait := s.Lockout.wait(failures.Count)
+	if wait <= 0 {
+		return time.Time{}
+	}
+	return failures.Last.Add(wait)
+}
@@ -0,0 +1,196 @@
+package app_test
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// auditLog collects the audit events
+type auditLog struct {
+	mu     sync.Mutex
+	events []svr.AuditEvent
+}
+
+func (a *auditLog) add(event svr.AuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, event)
+}
+
+// types returns the event types of the user
+func (a *auditLog) types(user zkp.UUID) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var types []string
+	for _, event := range a.events {
+		if event.User == user {
+			types = append(types, event.Type)
+		}
+	}
+	return types
+}
+
+// startLockoutServer serves the server with alice registered and without the rate limits
+func startLockoutServer(t *testing.T, lockout svr.Lockout) (*svr.Server, *zkp.Mux, *auditLog) {
+	server := svr.NewServer()
+	server.RateLimits = svr.RateLimits{}
+	server.Lockout = lockout
+	audit := &auditLog{}
+	server.Audit = audit.add
+	mux := connect(t, startServer(t, server, "alice"))
+	t.Cleanup(func() { mux.Close() })
+	return server, mux, audit
+}
+
+// failLogin logs in with the wrong password
+// Returns the response code and the retry time.
+func failLogin(t *testing.T, mux *zkp.Mux, user string) (zkp_pb.ErrorCode, uint32) {
+	ctx := context.Background()
+	stream, err := mux.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	prover := sendAuthRequest(t, stream, user, 124)
+	msg, err := stream.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the delayed login fails without the challenge
+	if challenge, ok := msg.(*zkp_pb.ChallengeResponse); ok {
+		answer := prover.ProveAuthentication(new(big.Int).SetBytes(challenge.GetChallenge()))
+		if err := stream.SendMessageContext(ctx, &zkp_pb.AnswerRequest{Answer: answer.Bytes()}); err != nil {
+			t.Fatal(err)
+		}
+		if msg, err = stream.ReadMessageContext(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	response := msg.(*zkp_pb.AuthResponse)
+	return response.GetCode(), response.GetRetryAfter()
+}
+
+func TestServer_Lockout_Delay(t *testing.T) {
+	server, mux, audit := startLockoutServer(t, svr.Lockout{FreeAttempts: 1, Delay: 2 * time.Second, MaxDelay: time.Minute})
+
+	// the existing and the unknown users are delayed the same
+	for _, user := range []string{"alice", "mallory"} {
+		t.Run(user, func(t *testing.T) {
+			assert := assert.New(t)
+			code, retry := failLogin(t, mux, user)
+			assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, code)
+			assert.Zero(retry)
+			code, retry = failLogin(t, mux, user)
+			assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, code)
+			assert.Zero(retry)
+			code, retry = failLogin(t, mux, user)
+			assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, code)
+			assert.Equal(uint32(2), retry)
+			assert.Equal([]string{svr.AuditLoginFailed, svr.AuditLoginFailed}, audit.types(zkp.UUID(user)))
+		})
+	}
+
+	// the admin unlocks the user
+	assert := assert.New(t)
+	assert.NoError(server.Unlock("alice"))
+	assert.True(login(t, mux, "alice", 123).GetResult())
+	assert.Equal([]string{svr.AuditLoginFailed, svr.AuditLoginFailed, svr.AuditUserUnlocked, svr.AuditLoginSucceeded}, audit.types("alice"))
+
+	// the success forgets the failures
+	code, _ := failLogin(t, mux, "alice")
+	assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, code)
+	assert.True(login(t, mux, "alice", 123).GetResult())
+}
+
+func TestServer_Lockout_Lock(t *testing.T) {
+	assert := assert.New(t)
+	_, mux, audit := startLockoutServer(t, svr.Lockout{LockAttempts: 2, LockDuration: time.Hour})
+
+	for _, user := range []string{"alice", "mallory"} {
+		code, _ := failLogin(t, mux, user)
+		assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, code)
+		code, _ = failLogin(t, mux, user)
+		assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, code)
+		code, retry := failLogin(t, mux, user)
+		assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, code)
+		assert.Equal(uint32(3600), retry)
+		assert.Equal([]string{svr.AuditLoginFailed, svr.AuditLoginFailed, svr.AuditUserLocked}, audit.types(zkp.UUID(user)))
+	}
+
+	// the locked user can't log in with the right password
+	response, ok := startAuth(t, mux, "alice").(*zkp_pb.AuthResponse)
+	if assert.True(ok) {
+		assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, response.GetCode())
+	}
+}
+
+func TestServer_Lockout_Disabled(t *testing.T) {
+	assert := assert.New(t)
+	_, mux, _ := startLockoutServer(t, svr.Lockout{})
+	for i := 0; i < 5; i++ {
+		code, _ := failLogin(t, mux, "alice")
+		assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, code)
+	}
+	assert.True(login(t, mux, "alice", 123).GetResult())
+}
+
+func TestServer_Lockout_Concurrent(t *testing.T) {
+	assert := assert.New(t)
+	_, mux, _ := startLockoutServer(t, svr.Lockout{LockAttempts: 2, LockDuration: time.Hour})
+
+	// the challenges issued at once count against the lock before any answer
+	var streams []*zkp.Stream
+	for i := 0; i < 5; i++ {
+		stream, err := mux.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		sendAuthRequest(t, stream, "alice", 124)
+		streams = append(streams, stream)
+	}
+	challenges := 0
+	for _, stream := range streams {
+		msg, err := stream.ReadMessageContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg.(*zkp_pb.ChallengeResponse); ok {
+			challenges++
+		} else {
+			assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, msg.(*zkp_pb.AuthResponse).GetCode())
+		}
+	}
+	assert.Equal(2, challenges)
+}
+
+func TestServer_UnlockCommand(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.RateLimits = svr.RateLimits{}
+	server.Lockout = svr.Lockout{LockAttempts: 1, LockDuration: time.Hour}
+	server.Admins = []zkp.UUID{"root"}
+	mux := connect(t, startServer(t, server, "alice", "bob", "root"))
+	defer mux.Close()
+
+	failLogin(t, mux, "alice")
+	code, _ := failLogin(t, mux, "alice")
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, code)
+
+	// only the admins unlock the users
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, command(t, mux, svr.UnlockCommand, "alice").GetCode())
+	assert.True(login(t, mux, "bob", 123).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_PERMISSION_DENIED, command(t, mux, svr.UnlockCommand, "alice").GetCode())
+	assert.True(login(t, mux, "root", 123).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, command(t, mux, svr.UnlockCommand, "").GetCode())
+	assert.True(command(t, mux, svr.UnlockCommand, "alice").GetResult())
+	assert.True(login(t, mux, "alice", 123).GetResult())
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// LogLevel selects the server messages logged
+type LogLevel int
+
+const (
+	// LogDebug logs the protocol values as well
+	LogDebug LogLevel = iota
+	// LogInfo logs the user events and the errors
+	LogInfo
+	// LogError logs the errors only
+	LogError
+)
+
+var UnknownLogLevelError = errors.New("unknown log level")
+
+var logLevels = map[string]LogLevel{
+	"debug": LogDebug,
+	"info":  LogInfo,
+	"error": LogError,
+}
+
+// ParseLogLevel returns the level by name: debug, info or error
+func ParseLogLevel(name string) (LogLevel, error) {
+	level, ok := logLevels[name]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", UnknownLogLevelError, name)
+	}
+	return level, nil
+}
+
+func (s *Server) debugf(format string, v ...interface{}) {
+	s.logf(LogDebug, format, v...)
+}
+
+func (s *Server) infof(format string, v ...interface{}) {
+	s.logf(LogInfo, format, v...)
+}
+
+func (s *Server) errorf(format string, v ...interface{}) {
+	s.logf(LogError, format, v...)
+}
+
+// logf logs the message if the level is enabled
+func (s *Server) logf(level LogLevel, format string, v ...interface{}) {
+	if level < s.LogLevel {
+		return
+	}
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
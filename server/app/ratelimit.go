@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// Rate limited operations
+const (
+	OperationRegister = "register"
+	OperationAuth     = "auth"
+)
+
+// bucketPruneInterval is the period dropping the full buckets of the idle clients
+const bucketPruneInterval = time.Minute
+
+var RateLimitedError = errors.New("rate limited")
+
+type (
+	// RateLimit is the token bucket refilled with Rate tokens per second up to Burst tokens,
+	// each request takes a token. Zero Rate disables the limit.
+	RateLimit struct {
+		Rate  float64
+		Burst int
+	}
+
+	// RateLimits limit the registrations and the authentications, each operation separately
+	RateLimits struct {
+		// PerIP limits the requests from the client address
+		PerIP RateLimit
+		// PerUser limits the requests for the user id
+		PerUser RateLimit
+		// Global limits all requests
+		Global RateLimit
+	}
+
+	// retryError tells the client when the request may succeed
+	retryError struct {
+		error
+		after time.Duration
+	}
+
+	// bucket is the token bucket of a client, a user or the server
+	bucket struct {
+		limit   RateLimit
+		tokens  float64
+		updated time.Time
+	}
+
+	// bucketKey names the bucket and its limit
+	bucketKey struct {
+		name  string
+		limit RateLimit
+	}
+
+	// rateLimiter keeps the token buckets
+	rateLimiter struct {
+		mu      sync.Mutex
+		buckets map[string]*bucket
+		pruned  time.Time
+	}
+
+	// remoteIPKey is the context key of the client address
+	remoteIPKey struct{}
+)
+
+// DefaultRateLimits are the limits used by NewServer
+var DefaultRateLimits = RateLimits{
+	PerIP:   RateLimit{Rate: 5, Burst: 20},
+	PerUser: RateLimit{Rate: 1, Burst: 10},
+	Global:  RateLimit{Rate: 200, Burst: 400},
+}
+
+// Unwrap returns the reason of the failure
+func (e *retryError) Unwrap() error {
+	return e.error
+}
+
+// limit takes the tokens of the operation requested by the client for the user, the per-user limit is skipped without the user
+// Returns RateLimitedError telling when to retry if any limit is exceeded.
+func (s *Server) limit(ctx context.Context, operation string, user zkp.UUID) error {
+	ip := remoteIP(ctx)
+	keys := []bucketKey{
+		{name: operation, limit: s.RateLimits.Global},
+		{name: operation + " ip " + ip, limit: s.RateLimits.PerIP},
+	}
+	if user != "" {
+		keys = append(keys, bucketKey{name: operation + " user " + string(user), limit: s.RateLimits.PerUser})
+	}
+	wait := s.limiter.take(time.Now(), keys...)
+	if wait == 0 {
+		return nil
+	}
+	s.debugf("rate limited %s of user %q from %q, retry in %v", operation, user, ip, wait)
+	return &retryError{
+		error: fmt.Errorf("%w: %s", RateLimitedError, operation),
+		after: wait,
+	}
+}
+
+// take takes a token from every bucket, nothing is taken if any of them is empty
+// Returns the time until all buckets have a token, zero if the tokens were taken.
+func (l *rateLimiter) take(now time.Time, keys ...bucketKey) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+
+	var wait time.Duration
+	for _, key := range keys {
+		if key.limit.Rate <= 0 {
+			continue
+		}
+		tokens := float64(key.limit.Burst)
+		if b, ok := l.buckets[key.name]; ok {
+			tokens = b.refill(now)
+		}
+		if tokens < 1 {
+			seconds := (1 - tokens) / key.limit.Rate
+			if w := time.Duration(math.Ceil(seconds * float64(time.Second))); w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	for _, key := range keys {
+		if key.limit.Rate <= 0 {
+			continue
+		}
+		b, ok := l.buckets[key.name]
+		if !ok {
+			// the buckets are created when taken only, the rejected requests don't grow the map
+			b = &bucket{limit: key.limit, tokens: float64(key.limit.Burst), updated: now}
+			l.buckets[key.name] = b
+		}
+		b.refill(now)
+		b.tokens--
+	}
+	l.prune(now)
+	return 0
+}
+
+// prune drops the full buckets, they are the same as the missing ones
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < bucketPruneInterval {
+		return
+	}
+	l.pruned = now
+	for name, b := range l.buckets {
+		if b.refill(now) >= float64(b.limit.Burst) {
+			delete(l.buckets, name)
+		}
+	}
+}
+
+// refill adds the tokens since the last update and returns the tokens
+func (b *bucket) refill(now time.Time) float64 {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.updated = now
+	}
+	return b.tokens
+}
+
+// withRemoteAddr returns the context carrying the client address
+func withRemoteAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, remoteIPKey{}, remoteHost(addr))
+}
+
+// remoteHost returns the host of the client address without the port
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		// e.g. the unix socket peers
+		return addr
+	}
+	return host
+}
+
+// remoteIP returns the client address of the request, empty if unknown
+func remoteIP(ctx context.Context) string {
+	ip, _ := ctx.Value(remoteIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,115 @@
+package app_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// startAuth sends the authentication request on a new stream and returns the first response
+func startAuth(t *testing.T, mux *zkp.Mux, user string) interface{} {
+	stream, err := mux.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	sendAuthRequest(t, stream, user, 123)
+	msg, err := stream.ReadMessageContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestServer_RateLimits(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.RateLimits = svr.RateLimits{
+		PerIP:   svr.RateLimit{Rate: 0.5, Burst: 3},
+		PerUser: svr.RateLimit{Rate: 0.5, Burst: 2},
+	}
+	address := startServer(t, server, "alice", "bob")
+
+	mux := connect(t, address)
+	defer mux.Close()
+
+	// the user burst is spent, the failed attempts count as well
+	assert.True(login(t, mux, "alice", 123).GetResult())
+	assert.False(login(t, mux, "alice", 124).GetResult())
+	limited, ok := startAuth(t, mux, "alice").(*zkp_pb.AuthResponse)
+	if assert.True(ok) {
+		assert.False(limited.GetResult())
+		assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, limited.GetCode())
+		assert.Equal(uint32(2), limited.GetRetryAfter())
+	}
+
+	// the connection stays open and the other users log in, the rejected attempts don't spend the address burst
+	assert.True(login(t, mux, "bob", 123).GetResult())
+
+	// the registrations are limited separately from the authentications, by the client address
+	commits, err := zkp.NewProver(123).CreateRegisterCommits()
+	assert.NoError(err)
+	register := func(user string) *zkp_pb.RegisterResponse {
+		return request(t, mux, &zkp_pb.RegisterRequest{
+			User:    user,
+			Commits: []*zkp_pb.RegisterRequest_Commits{{Y1: commits.C1.Bytes(), Y2: commits.C2.Bytes()}},
+		}).(*zkp_pb.RegisterResponse)
+	}
+	assert.True(register("carol").GetResult())
+	assert.True(register("dave").GetResult())
+	assert.True(register("erin").GetResult())
+	registered := register("frank")
+	assert.False(registered.GetResult())
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED, registered.GetCode())
+	assert.Equal(uint32(2), registered.GetRetryAfter())
+}
+
+func TestREST_RateLimits(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.RateLimits = svr.RateLimits{Global: svr.RateLimit{Rate: 20, Burst: 1}}
+	httpServer := httptest.NewServer(server.RESTHandler())
+	defer httpServer.Close()
+
+	status, result := registerREST(t, httpServer.URL, "max", 123)
+	assert.Equal(http.StatusOK, status)
+	assert.True(result.Result)
+
+	status, result = registerREST(t, httpServer.URL, "john", 123)
+	assert.Equal(http.StatusTooManyRequests, status)
+	assert.Equal(zkp_pb.ErrorCode_RATE_LIMITED.String(), result.Code)
+	assert.Equal(uint32(1), result.RetryAfter)
+	resp, err := http.Post(httpServer.URL+"/register", "application/json", strings.NewReader(`{"user": "john", "y1": "10", "y2": "c"}`))
+	if assert.NoError(err) {
+		resp.Body.Close()
+		assert.Equal(http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal("1", resp.Header.Get("Retry-After"))
+	}
+
+	// the bucket refills
+	time.Sleep(60 * time.Millisecond)
+	status, result = registerREST(t, httpServer.URL, "john", 123)
+	assert.Equal(http.StatusOK, status)
+	assert.True(result.Result)
+}
+
+func TestServer_RateLimits_Disabled(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.RateLimits = svr.RateLimits{}
+	httpServer := httptest.NewServer(server.RESTHandler())
+	defer httpServer.Close()
+
+	for _, user := range []string{"a", "b", "c", "d", "e"} {
+		status, _ := registerREST(t, httpServer.URL, user, 123)
+		assert.Equal(http.StatusOK, status)
+	}
+}
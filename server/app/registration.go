@@ -1,39 +1,52 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net"
 
 	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/store"
 	"github.com/mindaugasrukas/zkp_example/zkp"
 	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
 )
 
-func (s *Server) serveRegistration(conn net.Conn, registerRequest *zkp_pb.RegisterRequest) error {
-	if len(registerRequest.GetCommits()) == 0 {
-		// todo: wrong request
-		return WrongRequestError
+func (s *Server) serveRegistration(ctx context.Context, conn zkp.MessageConn, registerRequest *zkp_pb.RegisterRequest) error {
+	response, err := s.register(ctx, registerRequest)
+	if err := s.send(ctx, conn, response); err != nil {
+		s.errorf("%v", err)
+		return err
 	}
+	return err
+}
 
-	user, commits := model.GetRegistration(registerRequest)
-	response := &zkp_pb.RegisterResponse{Result: true}
-
-	if err := s.Register(user, commits); err != nil {
-		response.Result = false
-		response.Error = err.Error()
-		if err := zkp.SendMessage(conn, response); err != nil {
-			return err
-		}
-		return fmt.Errorf("fail to register user %q: %v", user, err)
+// register handles the registration request independently of the transport
+// Returns the response for the client and the error if the registration failed.
+func (s *Server) register(ctx context.Context, registerRequest *zkp_pb.RegisterRequest) (*zkp_pb.RegisterResponse, error) {
+	user, commits, err := model.GetRegistration(registerRequest)
+	if err != nil {
+		return newResponseError(err).registerResponse(), err
 	}
-
-	fmt.Printf("registered new user %q\n", user)
-	if err := zkp.SendMessage(conn, response); err != nil {
-		fmt.Println(err)
-		return err
+	if err := s.limit(ctx, OperationRegister, user); err != nil {
+		return newResponseError(err).registerResponse(), err
+	}
+	if err := s.concealUserExists(user, s.Register(user, commits)); err != nil {
+		return newResponseError(err).registerResponse(), fmt.Errorf("fail to register user %q: %w", user, err)
 	}
+	return &zkp_pb.RegisterResponse{Result: true}, nil
+}
 
-	return nil
+// concealUserExists returns nil for the taken user name unless ReportUserExists is set,
+// the client gets the same response as registering the new user
+func (s *Server) concealUserExists(user zkp.UUID, err error) error {
+	switch {
+	case err == nil:
+		s.infof("registered new user %q", user)
+	case errors.Is(err, store.UserExistsError) && !s.ReportUserExists:
+		s.infof("concealed the registration of the taken user name %q", user)
+		return nil
+	}
+	return err
 }
 
 // Register Registers a new user
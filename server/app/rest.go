@@ -0,0 +1,328 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+// maxRESTRequestSize limits the JSON request body
+const maxRESTRequestSize = 64 * 1024
+
+// defaultAnswerTTL is the time to answer the challenge of the HTTP/JSON API without the answer timeout
+const defaultAnswerTTL = time.Minute
+
+// pendingPruneInterval is the period dropping the expired pending authentications
+const pendingPruneInterval = 10 * time.Second
+
+// DefaultMaxPendingAuths is the limit of the authentications waiting for the answer used by NewServer
+const DefaultMaxPendingAuths = 10000
+
+var (
+	UnknownAuthError = errors.New("unknown or expired authentication")
+)
+
+type (
+	// pendingAuth is the authentication waiting for the answer
+	pendingAuth struct {
+		user        zkp.UUID
+		userCommits *zkp.Commits
+		commits     *zkp.Commits
+		challenge   *big.Int
+		expires     time.Time
+		// false for the unknown user, the login fails
+		known bool
+		// failures of the user counting this attempt
+		failures *store.Failures
+	}
+
+	// pendingAuths keeps the challenges issued by /auth/start until /auth/finish
+	pendingAuths struct {
+		mu     sync.Mutex
+		auths  map[string]*pendingAuth
+		pruned time.Time
+	}
+)
+
+func newPendingAuths() *pendingAuths {
+	return &pendingAuths{
+		auths: make(map[string]*pendingAuth),
+	}
+}
+
+// add stores the pending authentication and returns its id
+// returns ServerBusyError if max authentications are pending already, zero max means no limit.
+func (p *pendingAuths) add(auth *pendingAuth, max int) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	authID := hex.EncodeToString(id)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune(time.Now())
+	if max > 0 && len(p.auths) >= max {
+		return "", &retryError{
+			error: fmt.Errorf("%w: %d authentications pending", ServerBusyError, len(p.auths)),
+			after: rejectRetryAfter,
+		}
+	}
+	p.auths[authID] = auth
+	return authID, nil
+}
+
+// prune drops the expired authentications, they can't be answered anymore
+func (p *pendingAuths) prune(now time.Time) {
+	if now.Sub(p.pruned) < pendingPruneInterval {
+		return
+	}
+	p.pruned = now
+	for id, pending := range p.auths {
+		if now.After(pending.expires) {
+			delete(p.auths, id)
+		}
+	}
+}
+
+// take removes and returns the pending authentication, each challenge can be answered only once
+func (p *pendingAuths) take(authID string) (*pendingAuth, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	auth, ok := p.auths[authID]
+	if !ok {
+		return nil, UnknownAuthError
+	}
+	delete(p.auths, authID)
+	if time.Now().After(auth.expires) {
+		return nil, UnknownAuthError
+	}
+	return auth, nil
+}
+
+// RunRESTContext starts the HTTP/JSON API and serves until the context is cancelled
+func (s *Server) RunRESTContext(ctx context.Context, port string) error {
+	l, err := Listen(port)
+	if err != nil {
+		return err
+	}
+	return s.ServeREST(ctx, l)
+}
+
+// ServeREST serves the HTTP/JSON API on the listener until the context is cancelled or Shutdown is called
+func (s *Server) ServeREST(ctx context.Context, l net.Listener) error {
+	l = s.limitListener(ctx, l)
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	httpServer := &http.Server{
+		Handler:      s.RESTHandler(),
+		ReadTimeout:  s.Timeouts.Request,
+		WriteTimeout: s.Timeouts.Write,
+	}
+
+	untrack, err := s.shutdown.trackTransport(httpServer.Shutdown)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	defer untrack()
+
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-ctx.Done():
+			httpServer.Close()
+		case <-served:
+		}
+	}()
+
+	s.infof("Listening HTTP on %v", l.Addr())
+	if err := httpServer.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// RESTHandler returns the HTTP/JSON API handler
+//
+// POST /register     {"user", "y1", "y2"}  -> {"result", "error"}
+// POST /auth/start   {"user", "r1", "r2"}  -> {"auth_id", "challenge"}
+// POST /auth/finish  {"auth_id", "answer"} -> {"result", "error"}
+//
+// Big integers are encoded as hex strings.
+func (s *Server) RESTHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", s.restRegister)
+	mux.HandleFunc("/auth/start", s.restAuthStart)
+	mux.HandleFunc("/auth/finish", s.restAuthFinish)
+	return mux
+}
+
+func (s *Server) restRegister(w http.ResponseWriter, r *http.Request) {
+	var request model.RESTRegisterRequest
+	if !s.readJSON(w, r, &request) {
+		return
+	}
+	user, commits, err := model.GetRESTRegistration(&request)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if err := s.limit(restContext(r), OperationRegister, user); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if err := s.concealUserExists(user, s.Register(user, commits)); err != nil {
+		s.errorf("fail to register user %q: %v", user, err)
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, &model.RESTResult{Result: true})
+}
+
+func (s *Server) restAuthStart(w http.ResponseWriter, r *http.Request) {
+	var request model.RESTAuthStartRequest
+	if !s.readJSON(w, r, &request) {
+		return
+	}
+	user, commits, err := model.GetRESTAuthentication(&request)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	auth, err := s.createChallenge(restContext(r), user)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	// the challenges without the answer are forgotten even without the answer timeout
+	ttl := s.Timeouts.Answer
+	if ttl <= 0 {
+		ttl = defaultAnswerTTL
+	}
+	auth.commits = commits
+	auth.expires = time.Now().Add(ttl)
+	authID, err := s.pending.add(auth, s.MaxPendingAuths)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, &model.RESTAuthStartResponse{
+		AuthID:    authID,
+		Challenge: model.EncodeNumber(auth.challenge),
+	})
+}
+
+func (s *Server) restAuthFinish(w http.ResponseWriter, r *http.Request) {
+	var request model.RESTAuthFinishRequest
+	if !s.readJSON(w, r, &request) {
+		return
+	}
+	authID, answer, err := model.GetRESTAnswer(&request)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	auth, err := s.pending.take(authID)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if !s.Verifier.VerifyAuthentication(auth.userCommits, auth.commits, auth.challenge, answer) || !auth.known {
+		s.loginFailed(restContext(r), auth.user, auth.failures)
+		s.writeError(w, AuthFailedError)
+		return
+	}
+	s.loginSucceeded(restContext(r), auth.user)
+	response, err := s.authResult(auth.user)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, &model.RESTResult{
+		Result:       true,
+		Token:        response.Token,
+		ExpiresAt:    response.ExpiresAt,
+		SessionID:    response.SessionId,
+		RefreshToken: response.RefreshToken,
+	})
+}
+
+// readJSON decodes the POST request body, writes the error response on failure
+func (s *Server) readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeJSON(w, http.StatusMethodNotAllowed, &model.RESTResult{
+			Error: "method not allowed",
+			Code:  zkp_pb.ErrorCode_INVALID_REQUEST.String(),
+		})
+		return false
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRESTRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		s.writeError(w, fmt.Errorf("%w: %v", WrongRequestError, err))
+		return false
+	}
+	return true
+}
+
+// restContext returns the request context carrying the client address for the rate limits
+func restContext(r *http.Request) context.Context {
+	return withRemoteAddr(r.Context(), r.RemoteAddr)
+}
+
+// restStatus maps the error codes to HTTP status codes
+var restStatus = map[zkp_pb.ErrorCode]int{
+	zkp_pb.ErrorCode_INVALID_REQUEST:     http.StatusBadRequest,
+	zkp_pb.ErrorCode_USER_EXISTS:         http.StatusConflict,
+	zkp_pb.ErrorCode_AUTH_FAILED:         http.StatusUnauthorized,
+	zkp_pb.ErrorCode_RATE_LIMITED:        http.StatusTooManyRequests,
+	zkp_pb.ErrorCode_UNSUPPORTED_VERSION: http.StatusBadRequest,
+	zkp_pb.ErrorCode_TIMEOUT:             http.StatusRequestTimeout,
+	zkp_pb.ErrorCode_INTERNAL:            http.StatusInternalServerError,
+	zkp_pb.ErrorCode_UNAUTHENTICATED:     http.StatusUnauthorized,
+	zkp_pb.ErrorCode_PERMISSION_DENIED:   http.StatusForbidden,
+}
+
+// writeError writes the failed result with the error code
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	e := newResponseError(err)
+	if seconds := e.retryAfterSeconds(); seconds > 0 {
+		w.Header().Set("Retry-After", strconv.FormatUint(uint64(seconds), 10))
+	}
+	s.writeJSON(w, restStatus[e.code], e.restResult())
+}
+
+// writeJSON writes the JSON response
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		// log the error and continue
+		s.errorf("%v", err)
+	}
+}
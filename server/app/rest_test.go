@@ -0,0 +1,235 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// postJSON sends the JSON request and decodes the JSON response
+func postJSON(t *testing.T, url string, request, response interface{}) int {
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func registerREST(t *testing.T, url, user string, password int64) (int, *model.RESTResult) {
+	commits, err := zkp.NewProver(password).CreateRegisterCommits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result model.RESTResult
+	status := postJSON(t, url+"/register", &model.RESTRegisterRequest{
+		User: user,
+		Y1:   model.EncodeNumber(commits.C1),
+		Y2:   model.EncodeNumber(commits.C2),
+	}, &result)
+	return status, &result
+}
+
+func TestREST_Register(t *testing.T) {
+	assert := assert.New(t)
+	zkpServer := svr.NewServer()
+	zkpServer.ReportUserExists = true
+	server := httptest.NewServer(zkpServer.RESTHandler())
+	defer server.Close()
+
+	status, result := registerREST(t, server.URL, "max", 123)
+	assert.Equal(http.StatusOK, status)
+	assert.True(result.Result)
+
+	// fail to register duplicate user
+	status, result = registerREST(t, server.URL, "max", 123)
+	assert.Equal(http.StatusConflict, status)
+	assert.False(result.Result)
+	assert.NotEmpty(result.Error)
+	assert.Equal(zkp_pb.ErrorCode_USER_EXISTS.String(), result.Code)
+
+	// malformed request
+	status = postJSON(t, server.URL+"/register", &model.RESTRegisterRequest{User: "john", Y1: "zz", Y2: "1"}, result)
+	assert.Equal(http.StatusBadRequest, status)
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST.String(), result.Code)
+	assert.NotEmpty(result.Detail)
+
+	// wrong method
+	resp, err := http.Get(server.URL + "/register")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestREST_Authenticate(t *testing.T) {
+	assert := assert.New(t)
+	zkpServer := svr.NewServer()
+	zkpServer.Tokens = newSigner(t)
+	server := httptest.NewServer(zkpServer.RESTHandler())
+	defer server.Close()
+
+	status, _ := registerREST(t, server.URL, "max", 123)
+	assert.Equal(http.StatusOK, status)
+
+	tests := map[string]struct {
+		user           string
+		password       int64
+		expectedStart  int
+		expectedFinish int
+	}{
+		"correct password": {
+			user:           "max",
+			password:       123,
+			expectedStart:  http.StatusOK,
+			expectedFinish: http.StatusOK,
+		},
+		"wrong password": {
+			user:           "max",
+			password:       124,
+			expectedStart:  http.StatusOK,
+			expectedFinish: http.StatusUnauthorized,
+		},
+		"unknown user": {
+			user:           "john",
+			password:       123,
+			expectedStart:  http.StatusOK,
+			expectedFinish: http.StatusUnauthorized,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			prover := zkp.NewProver(test.password)
+			commits, err := prover.CreateAuthenticationCommits()
+			assert.NoError(err)
+
+			var start model.RESTAuthStartResponse
+			status := postJSON(t, server.URL+"/auth/start", &model.RESTAuthStartRequest{
+				User: test.user,
+				R1:   model.EncodeNumber(commits.C1),
+				R2:   model.EncodeNumber(commits.C2),
+			}, &start)
+			assert.Equal(test.expectedStart, status)
+			if status != http.StatusOK {
+				return
+			}
+
+			challenge, err := model.DecodeNumber("challenge", start.Challenge)
+			assert.NoError(err)
+			finish := &model.RESTAuthFinishRequest{
+				AuthID: start.AuthID,
+				Answer: model.EncodeNumber(prover.ProveAuthentication(challenge)),
+			}
+			var result model.RESTResult
+			status = postJSON(t, server.URL+"/auth/finish", finish, &result)
+			assert.Equal(test.expectedFinish, status)
+			assert.Equal(test.expectedFinish == http.StatusOK, result.Result)
+			if result.Result {
+				// the session token of the user
+				claims, err := token.Verify(result.Token, zkpServer.Tokens.PublicKey())
+				assert.NoError(err)
+				assert.Equal(test.user, claims.Subject)
+				assert.Equal(claims.ID, result.SessionID)
+				assert.Equal(claims.ExpiresAt, result.ExpiresAt)
+			}
+
+			// the challenge can be answered only once
+			status = postJSON(t, server.URL+"/auth/finish", finish, &result)
+			assert.Equal(http.StatusUnauthorized, status)
+		})
+	}
+}
+
+func TestREST_Authenticate_Expired(t *testing.T) {
+	assert := assert.New(t)
+	app := svr.NewServer()
+	app.Timeouts.Answer = time.Millisecond
+	server := httptest.NewServer(app.RESTHandler())
+	defer server.Close()
+
+	status, _ := registerREST(t, server.URL, "max", 123)
+	assert.Equal(http.StatusOK, status)
+
+	prover := zkp.NewProver(123)
+	commits, err := prover.CreateAuthenticationCommits()
+	assert.NoError(err)
+	var start model.RESTAuthStartResponse
+	status = postJSON(t, server.URL+"/auth/start", &model.RESTAuthStartRequest{
+		User: "max",
+		R1:   model.EncodeNumber(commits.C1),
+		R2:   model.EncodeNumber(commits.C2),
+	}, &start)
+	assert.Equal(http.StatusOK, status)
+
+	time.Sleep(10 * time.Millisecond)
+	challenge, err := model.DecodeNumber("challenge", start.Challenge)
+	assert.NoError(err)
+	var result model.RESTResult
+	status = postJSON(t, server.URL+"/auth/finish", &model.RESTAuthFinishRequest{
+		AuthID: start.AuthID,
+		Answer: model.EncodeNumber(prover.ProveAuthentication(challenge)),
+	}, &result)
+	assert.Equal(http.StatusUnauthorized, status)
+	assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED.String(), result.Code)
+}
+
+func TestREST_Authenticate_MaxPending(t *testing.T) {
+	assert := assert.New(t)
+	app := svr.NewServer()
+	app.RateLimits = svr.RateLimits{}
+	app.MaxPendingAuths = 2
+	server := httptest.NewServer(app.RESTHandler())
+	defer server.Close()
+
+	status, _ := registerREST(t, server.URL, "max", 123)
+	assert.Equal(http.StatusOK, status)
+	prover := zkp.NewProver(123)
+	commits, err := prover.CreateAuthenticationCommits()
+	assert.NoError(err)
+	start := func() (int, *model.RESTAuthStartResponse) {
+		var start model.RESTAuthStartResponse
+		status := postJSON(t, server.URL+"/auth/start", &model.RESTAuthStartRequest{
+			User: "max",
+			R1:   model.EncodeNumber(commits.C1),
+			R2:   model.EncodeNumber(commits.C2),
+		}, &start)
+		return status, &start
+	}
+
+	status, first := start()
+	assert.Equal(http.StatusOK, status)
+	status, _ = start()
+	assert.Equal(http.StatusOK, status)
+	// the challenges without the answer don't pile up
+	status, _ = start()
+	assert.Equal(http.StatusTooManyRequests, status)
+
+	// the answered challenge frees the slot
+	challenge, err := model.DecodeNumber("challenge", first.Challenge)
+	assert.NoError(err)
+	var result model.RESTResult
+	status = postJSON(t, server.URL+"/auth/finish", &model.RESTAuthFinishRequest{
+		AuthID: first.AuthID,
+		Answer: model.EncodeNumber(prover.ProveAuthentication(challenge)),
+	}, &result)
+	assert.Equal(http.StatusOK, status)
+	status, _ = start()
+	assert.Equal(http.StatusOK, status)
+}
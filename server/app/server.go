@@ -1,15 +1,22 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/mindaugasrukas/zkp_example/capture"
 	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/token"
 	"github.com/mindaugasrukas/zkp_example/zkp"
-	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
 )
 
 type (
@@ -19,6 +26,40 @@ type (
 		Add(user zkp.UUID, commits *zkp.Commits) error
 		// Get user data from the registry
 		Get(user zkp.UUID) (*zkp.Commits, error)
+		// Update user data in the registry
+		Update(user zkp.UUID, commits *zkp.Commits) error
+	}
+
+	// SessionStore keeps the sessions of the issued tokens and the revoked ones
+	SessionStore interface {
+		// AddSession adds the new session
+		AddSession(session *store.Session) error
+		// GetSession returns the active session by id
+		GetSession(id string) (*store.Session, error)
+		// RotateSession replaces the session if its refresh hash is still oldHash, SessionChangedError otherwise
+		RotateSession(id string, oldHash []byte, session *store.Session) error
+		// Sessions returns the active sessions of the user
+		Sessions(user zkp.UUID) ([]*store.Session, error)
+		// RevokeSession ends the session, its tokens are revoked until the time
+		RevokeSession(id string, until time.Time) error
+		token.RevocationList
+	}
+
+	// FailureStore counts the consecutive failed logins of the user names, existing or not
+	FailureStore interface {
+		// Failures returns the failed logins of the user, zero if there are none
+		Failures(user zkp.UUID) (*store.Failures, error)
+		// AddFailure counts the failed login, the failures are forgotten at expires
+		AddFailure(user zkp.UUID, at, expires time.Time) (*store.Failures, error)
+		// ResetFailures forgets the failed logins of the user
+		ResetFailures(user zkp.UUID) error
+	}
+
+	// Store keeps the users, the sessions and the failed logins
+	Store interface {
+		Registry
+		SessionStore
+		FailureStore
 	}
 
 	// Verifier interface
@@ -27,12 +68,75 @@ type (
 		VerifyAuthentication(commits *zkp.Commits, authRequest *zkp.Commits, challenge, answer *big.Int) bool
 	}
 
+	// Timeouts limits the time of each protocol phase, zero means no limit
+	Timeouts struct {
+		// Request is the time allowed to receive the first request after accepting the connection
+		// and the next one while the connection is idle
+		Request time.Duration
+		// Answer is the time allowed between sending ChallengeResponse and receiving AnswerRequest
+		Answer time.Duration
+		// Write is the time allowed to send a response
+		Write time.Duration
+	}
+
 	// Server application
 	Server struct {
 		// Pluggable storage
 		registry Registry
+		sessions SessionStore
+		failures FailureStore
 		// Pluggable ZKP verifier
 		Verifier Verifier
+		// Protocol phase timeouts
+		Timeouts Timeouts
+		// Capabilities offered in the protocol negotiation, a subset of zkp.DefaultCapabilities
+		Capabilities zkp.Capabilities
+		// TLSConfig enables TLS if set
+		TLSConfig *tls.Config
+		// Tokens issues the session tokens of the authenticated users if set
+		Tokens *token.Signer
+		// SessionTTL is the lifetime of the token session, the token is refreshed until it ends
+		SessionTTL time.Duration
+		// App handles the application messages of the logged in users, nil echoes them back
+		// The application commands are added with HandleCommand.
+		App AppHandler
+		// the stream handlers by the message type, see Handle
+		handlers handlers
+		// LogLevel is the lowest level of the logged messages
+		LogLevel LogLevel
+		// Logger prints the server messages, the standard logger if nil
+		Logger *log.Logger
+		// Recorder records the envelope protocol traffic if set
+		Recorder *capture.Recorder
+		// Connections bound the connections served at once and queued for a worker
+		Connections ConnectionLimits
+		conns       connPool
+		// RateLimits limit the registrations and the authentications
+		RateLimits RateLimits
+		limiter    rateLimiter
+		// Lockout delays the logins of the users failing them
+		Lockout Lockout
+		// attempts serializes the lockout check with counting the attempt
+		attempts sync.Mutex
+		// Admins are the users allowed to run the admin commands, e.g. UnlockCommand
+		Admins []zkp.UUID
+		// Audit is notified of the logins and the lockouts if set
+		Audit AuditHook
+		// FakeUserKey derives the commits of the unknown users, so their logins fail like the wrong passwords
+		// A random key is generated if it isn't set.
+		FakeUserKey []byte
+		fakeKeyOnce sync.Once
+		fakeKey     []byte
+		fakeKeyErr  error
+		// ReportUserExists reports USER_EXISTS to the registration of a taken user name
+		// By default the registration appears successful, so it doesn't tell which users exist.
+		ReportUserExists bool
+		// MaxPendingAuths limits the authentications of the HTTP/JSON API waiting for the answer, 0 - no limit
+		MaxPendingAuths int
+		// authentications started over the HTTP/JSON API
+		pending *pendingAuths
+		// the running transports and connections stopped by Shutdown
+		shutdown shutdownState
 	}
 )
 
@@ -41,66 +145,270 @@ var (
 	UnknownRequestError = errors.New("unknown request")
 )
 
-// NewServer returns a new server instance
+// DefaultTimeouts are the protocol phase timeouts used by NewServer
+var DefaultTimeouts = Timeouts{
+	Request: 10 * time.Second,
+	Answer:  10 * time.Second,
+	Write:   5 * time.Second,
+}
+
+// DefaultSessionTTL is the token session lifetime used by NewServer
+const DefaultSessionTTL = 7 * 24 * time.Hour
+
+// NewServer returns a new server instance keeping the users in memory
 func NewServer() *Server {
-	return &Server{
-		registry: store.NewInMemoryStore(),
-		Verifier: zkp.NewVerifier(),
+	return NewServerWithStore(store.NewInMemoryStore())
+}
+
+// NewServerWithStore returns a new server instance keeping the users, the sessions and the failed logins in the store
+// The store is flushed by Shutdown if it implements Flusher.
+func NewServerWithStore(store Store) *Server {
+	s := &Server{
+		registry:        store,
+		sessions:        store,
+		failures:        store,
+		SessionTTL:      DefaultSessionTTL,
+		Verifier:        zkp.NewVerifier(),
+		Timeouts:        DefaultTimeouts,
+		Capabilities:    zkp.DefaultCapabilities,
+		Connections:     DefaultConnectionLimits,
+		RateLimits:      DefaultRateLimits,
+		Lockout:         DefaultLockout,
+		LogLevel:        LogInfo,
+		MaxPendingAuths: DefaultMaxPendingAuths,
+		pending:         newPendingAuths(),
 	}
+	s.handleBuiltins()
+	s.handleAdmin()
+	return s
 }
 
 // Run starts the server
+// port is any address supported by Listen. Panics if the server can't start,
+// use Serve to handle the error.
 func (s *Server) Run(port string) {
-	l, err := net.Listen("tcp", ":"+port)
-	if err != nil {
+	if err := s.RunContext(context.Background(), port); err != nil {
 		// Can't start - panic
 		panic(err.Error())
 	}
+}
+
+// RunContext starts the server and serves until the context is cancelled
+// Cancelling the context also cancels the connections in progress.
+func (s *Server) RunContext(ctx context.Context, port string) error {
+	l, err := Listen(port)
+	if err != nil {
+		return err
+	}
+	return s.ServeContext(ctx, l)
+}
+
+// Serve accepts connections on the listener until it is closed
+// Returns the error if the listener fails.
+func (s *Server) Serve(l net.Listener) error {
+	return s.ServeContext(context.Background(), l)
+}
+
+// ServeContext accepts connections on the listener until the context is cancelled or Shutdown is called
+// Cancelling the context closes the listener and cancels the connections in progress.
+func (s *Server) ServeContext(ctx context.Context, l net.Listener) error {
+	return s.acceptLoop(ctx, ctx, l)
+}
+
+// acceptLoop accepts connections on the listener until the context is cancelled or Shutdown is called
+// The connections are cancelled with connCtx.
+func (s *Server) acceptLoop(ctx, connCtx context.Context, l net.Listener) error {
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
 	defer l.Close()
+	untrack, err := s.shutdown.trackTransport(func(context.Context) error {
+		// the connections are drained by Shutdown
+		l.Close()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer untrack()
 
-	log.Print("Listening on ", l.Addr())
+	s.infof("Listening on %v", l.Addr())
+
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		// unblock Accept
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-served:
+		}
+	}()
 
-	// run infinite loop
+	var delay time.Duration
 	for {
-		// todo: add a rate limiter
 		conn, err := l.Accept()
 		if err != nil {
-			// log the error and continue
-			fmt.Println(err.Error())
+			if ctx.Err() != nil || s.shuttingDown() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				// retry with backoff, e.g. too many open files
+				delay = acceptBackoff(delay)
+				s.errorf("accept error: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		if s.Recorder != nil {
+			conn = s.Recorder.Conn(conn, capture.Server)
 		}
 
+		ticket, err := s.admitConn(conn)
+		if err != nil {
+			s.rejectConn(conn, err)
+			continue
+		}
 		go func(conn net.Conn) {
+			if err := ticket.wait(connCtx, s.Connections, s.shutdown.doneChan()); err != nil {
+				ticket.done()
+				if errors.Is(err, ServerClosedError) {
+					conn.Close()
+				} else {
+					s.rejectConn(conn, err)
+				}
+				return
+			}
+			defer ticket.done()
 			defer conn.Close()
-			if err := s.serve(conn); err != nil {
+			if err := s.serveConn(connCtx, conn); err != nil {
 				// log the error and continue
-				fmt.Println(err.Error())
+				s.errorf("%v", err)
 			}
-			fmt.Println()
 		}(conn)
 	}
 }
 
+// ServeListeners serves all listeners until the context is cancelled, Shutdown is called or any of them fails
+// The failure closes the other listeners and the error is returned, the connections in progress
+// continue until the context is cancelled.
+func (s *Server) ServeListeners(ctx context.Context, listeners ...net.Listener) error {
+	listenerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			err := s.acceptLoop(listenerCtx, ctx, l)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", l.Addr(), err)
+			}
+			errs <- err
+			// stop the other listeners
+			cancel()
+		}(l)
+	}
+
+	var firstErr error
+	for range listeners {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// acceptBackoff doubles the delay between the failed accepts up to a second
+func acceptBackoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	delay *= 2
+	if delay > time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
 // server accepted connection
-func (s *Server) serve(conn net.Conn) error {
-	msg, err := zkp.ReadMessage(conn)
-	if err != nil {
+func (s *Server) serve(ctx context.Context, conn net.Conn) error {
+	framer := zkp.NewFramer(conn, conn)
+	framer.RequireHello = true
+
+	if err := s.handshake(ctx, framer); err != nil {
 		return err
 	}
 
-	switch string(msg.ProtoReflect().Descriptor().Name()) {
-	case "RegisterRequest":
-		registerRequest, ok := msg.(*zkp_pb.RegisterRequest)
-		if !ok {
-			return WrongRequestError
+	// the exchanges run concurrently, each on its own stream,
+	// the login on any of them authenticates the following requests of the connection
+	sess := &session{}
+	var streams sync.WaitGroup
+	defer streams.Wait()
+	mux := zkp.NewServerMux(framer, conn)
+	defer mux.Close()
+	drainCtx, cancelDrain := s.drainContext(ctx)
+	defer cancelDrain()
+	for {
+		acceptCtx, cancel := WithTimeout(drainCtx, s.Timeouts.Request)
+		stream, err := mux.Accept(acceptCtx)
+		cancel()
+		if err != nil && drainCtx.Err() != nil && ctx.Err() == nil {
+			// shutting down, the exchanges in progress finish before the connection is closed
+			streams.Wait()
+			return nil
 		}
-		return s.serveRegistration(conn, registerRequest)
-	case "AuthRequest":
-		authRequest, ok := msg.(*zkp_pb.AuthRequest)
-		if !ok {
-			return WrongRequestError
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil && mux.Streams() > 0 {
+			// not idle, the exchanges in progress have their own timeouts
+			continue
 		}
-		return s.serveAuth(conn, authRequest)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		streams.Add(1)
+		go func() {
+			defer streams.Done()
+			if err := s.serveStream(ctx, sess, stream); err != nil {
+				// log the error and continue
+				s.errorf("stream %d: %v", stream.ID, err)
+			}
+		}()
 	}
+}
+
+// serveStream serves the exchange started by the first message of the stream
+func (s *Server) serveStream(ctx context.Context, sess *session, stream *zkp.Stream) error {
+	defer stream.Close()
+	msg, err := stream.ReadMessageContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the message type, or the application command, selects the handler
+	req := s.newRequest(sess, stream, msg)
+	handler := s.handler(req.Type)
+	if handler == nil {
+		return req.unknownRequest(ctx)
+	}
+	return handler(ctx, req)
+}
+
+// WithTimeout returns the context limited by the timeout, zero timeout means no limit
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	return UnknownRequestError
+// send writes the message within the write timeout
+func (s *Server) send(ctx context.Context, conn zkp.MessageConn, message proto.Message) error {
+	ctx, cancel := WithTimeout(ctx, s.Timeouts.Write)
+	defer cancel()
+	return conn.SendMessageContext(ctx, message)
 }
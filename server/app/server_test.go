@@ -1,15 +1,40 @@
 package app_test
 
 import (
+	"context"
 	"math/big"
+	"net"
 	"testing"
 
 	svr "github.com/mindaugasrukas/zkp_example/server/app"
 	"github.com/mindaugasrukas/zkp_example/store"
 	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
 	"github.com/stretchr/testify/assert"
 )
 
+// startServer serves the TCP listener until the test ends and registers the users with the password 123
+// Returns the listener address.
+func startServer(t *testing.T, server *svr.Server, users ...zkp.UUID) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	l, err := svr.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeContext(ctx, l)
+	commits, err := zkp.NewProver(123).CreateRegisterCommits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		if err := server.Register(user, commits); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l.Addr().String()
+}
+
 func TestServer_Register(t *testing.T) {
 	assert := assert.New(t)
 	server := svr.NewServer()
@@ -50,3 +75,80 @@ func TestServer_CreateAuthenticationChallenge(t *testing.T) {
 	assert.NoError(err)
 	assert.True(challenge != nil)
 }
+
+// sendAuthRequest starts the login on the stream returning the prover answering the challenge
+func sendAuthRequest(t *testing.T, stream *zkp.Stream, user string, password int64) *zkp.PedersenProver {
+	prover := zkp.NewProver(password)
+	commits, err := prover.CreateAuthenticationCommits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.SendMessageContext(context.Background(), &zkp_pb.AuthRequest{
+		User: user,
+		Commits: []*zkp_pb.AuthRequest_Commits{
+			{R1: commits.C1.Bytes(), R2: commits.C2.Bytes()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prover
+}
+
+// answerChallenge reads the challenge from the stream and sends the answer
+func answerChallenge(t *testing.T, stream *zkp.Stream, prover *zkp.PedersenProver) {
+	ctx := context.Background()
+	msg, err := stream.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := new(big.Int).SetBytes(msg.(*zkp_pb.ChallengeResponse).GetChallenge())
+	err = stream.SendMessageContext(ctx, &zkp_pb.AnswerRequest{Answer: prover.ProveAuthentication(challenge).Bytes()})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_Multiplexed(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	address := startServer(t, svr.NewServer(), "alice", "bob")
+
+	conn, err := net.Dial("tcp", address)
+	assert.NoError(err)
+	framer := zkp.NewFramer(conn, conn)
+	handshake(t, framer)
+	mux := zkp.NewClientMux(framer, conn)
+	defer mux.Close()
+
+	// two logins in progress at once, answered in the reverse order
+	alice, err := mux.Open()
+	assert.NoError(err)
+	bob, err := mux.Open()
+	assert.NoError(err)
+	aliceProver := sendAuthRequest(t, alice, "alice", 123)
+	bobProver := sendAuthRequest(t, bob, "bob", 124)
+	answerChallenge(t, bob, bobProver)
+	answerChallenge(t, alice, aliceProver)
+
+	msg, err := alice.ReadMessageContext(ctx)
+	assert.NoError(err)
+	assert.True(msg.(*zkp_pb.AuthResponse).GetResult())
+	msg, err = bob.ReadMessageContext(ctx)
+	assert.NoError(err)
+	assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, msg.(*zkp_pb.AuthResponse).GetCode())
+
+	// the unknown request aborts only its stream
+	unknown, err := mux.Open()
+	assert.NoError(err)
+	assert.NoError(unknown.SendMessageContext(ctx, &zkp_pb.ChallengeResponse{}))
+	_, err = unknown.ReadMessageContext(ctx)
+	assert.ErrorIs(err, zkp.StreamAbortedError)
+
+	stream, err := mux.Open()
+	assert.NoError(err)
+	answerChallenge(t, stream, sendAuthRequest(t, stream, "alice", 123))
+	msg, err = stream.ReadMessageContext(ctx)
+	assert.NoError(err)
+	assert.True(msg.(*zkp_pb.AuthResponse).GetResult())
+}
@@ -0,0 +1,202 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+var (
+	NotAuthenticatedError = errors.New("login required")
+)
+
+type (
+	// AppHandler handles the application message of the logged in user
+	// The returned payload is sent back to the client.
+	AppHandler func(ctx context.Context, user zkp.UUID, payload []byte) ([]byte, error)
+
+	// session is the login state of the connection shared by its streams
+	session struct {
+		mu   sync.Mutex
+		user zkp.UUID
+		// id of the session token issued by the login, empty if the server doesn't issue tokens
+		id string
+		// false until the first successful login and after the logout
+		authenticated bool
+	}
+)
+
+// login makes the user the one logged in on the connection
+func (sess *session) login(user zkp.UUID, id string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.user = user
+	sess.id = id
+	sess.authenticated = true
+}
+
+// logout ends the session returning the user logged out and the session token id
+// returns NotAuthenticatedError if nobody is logged in
+func (sess *session) logout() (zkp.UUID, string, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if !sess.authenticated {
+		return "", "", NotAuthenticatedError
+	}
+	user, id := sess.user, sess.id
+	sess.user = ""
+	sess.id = ""
+	sess.authenticated = false
+	return user, id, nil
+}
+
+// revoked logs out if the session token was revoked
+func (sess *session) revoked(id string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.authenticated && sess.id != "" && sess.id == id {
+		sess.user = ""
+		sess.id = ""
+		sess.authenticated = false
+	}
+}
+
+// currentID returns the logged in user and the session token id
+// returns NotAuthenticatedError if nobody is logged in
+func (sess *session) currentID() (zkp.UUID, string, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if !sess.authenticated {
+		return "", "", NotAuthenticatedError
+	}
+	return sess.user, sess.id, nil
+}
+
+// currentUser returns the user logged in on the connection and the session token id
+// returns NotAuthenticatedError if nobody is logged in or the session token was revoked since the login
+func (s *Server) currentUser(sess *session) (zkp.UUID, string, error) {
+	user, id, err := sess.currentID()
+	if err != nil || id == "" {
+		return user, id, err
+	}
+	revoked, err := s.sessions.Revoked(id)
+	if err != nil {
+		return "", "", err
+	}
+	if revoked {
+		sess.revoked(id)
+		return "", "", NotAuthenticatedError
+	}
+	return user, id, nil
+}
+
+func (s *Server) serveWhoAmI(ctx context.Context, conn zkp.MessageConn, sess *session) error {
+	response := &zkp_pb.WhoAmIResponse{Result: true}
+	user, _, err := s.currentUser(sess)
+	if err != nil {
+		response = newResponseError(err).whoAmIResponse()
+	}
+	response.User = string(user)
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+func (s *Server) serveChangePassword(ctx context.Context, conn zkp.MessageConn, sess *session, request *zkp_pb.ChangePasswordRequest) error {
+	response := &zkp_pb.ChangePasswordResponse{Result: true}
+	err := s.changePassword(sess, request)
+	if err != nil {
+		response = newResponseError(err).changePasswordResponse()
+	}
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// changePassword replaces the commits of the user logged in on the connection
+func (s *Server) changePassword(sess *session, request *zkp_pb.ChangePasswordRequest) error {
+	user, _, err := s.currentUser(sess)
+	if err != nil {
+		return err
+	}
+	commits, err := model.GetChangePassword(request)
+	if err != nil {
+		return err
+	}
+	if err := s.ChangePassword(user, commits); err != nil {
+		return fmt.Errorf("fail to change password of user %q: %w", user, err)
+	}
+	s.infof("changed password of user %q", user)
+	return nil
+}
+
+// ChangePassword replaces the registered commits of the user
+func (s *Server) ChangePassword(user zkp.UUID, commits *zkp.Commits) error {
+	return s.registry.Update(user, commits)
+}
+
+func (s *Server) serveLogout(ctx context.Context, conn zkp.MessageConn, sess *session) error {
+	response := &zkp_pb.LogoutResponse{Result: true}
+	err := s.logout(sess)
+	if err != nil {
+		response = newResponseError(err).logoutResponse()
+	}
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// logout ends the session of the connection revoking its token
+func (s *Server) logout(sess *session) error {
+	user, id, err := sess.logout()
+	if err != nil {
+		return err
+	}
+	s.infof("user %q logged out", user)
+	if id == "" || s.Tokens == nil {
+		return nil
+	}
+	session, err := s.sessions.GetSession(id)
+	if errors.Is(err, store.SessionDoesNotExistError) {
+		// already revoked or expired
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.revokeSession(session)
+}
+
+func (s *Server) serveApp(ctx context.Context, conn zkp.MessageConn, sess *session, request *zkp_pb.AppRequest) error {
+	response := &zkp_pb.AppResponse{Result: true}
+	payload, err := s.handleApp(ctx, sess, request.GetPayload())
+	if err != nil {
+		response = newResponseError(err).appResponse()
+	}
+	response.Payload = payload
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// handleApp passes the application message to the App handler, the payload is echoed if the handler isn't set
+func (s *Server) handleApp(ctx context.Context, sess *session, payload []byte) ([]byte, error) {
+	user, _, err := s.currentUser(sess)
+	if err != nil {
+		return nil, err
+	}
+	if s.App == nil {
+		return payload, nil
+	}
+	return s.App(ctx, user, payload)
+}
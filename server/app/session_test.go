@@ -0,0 +1,131 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// request sends the message on a new stream and returns the response
+func request(t *testing.T, mux *zkp.Mux, message proto.Message) proto.Message {
+	ctx := context.Background()
+	stream, err := mux.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err := stream.SendMessageContext(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := stream.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// login runs the authentication on a new stream and returns the result
+func login(t *testing.T, mux *zkp.Mux, user string, password int64) *zkp_pb.AuthResponse {
+	stream, err := mux.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	answerChallenge(t, stream, sendAuthRequest(t, stream, user, password))
+	msg, err := stream.ReadMessageContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg.(*zkp_pb.AuthResponse)
+}
+
+// connect dials the server and runs the hello
+func connect(t *testing.T, address string) *zkp.Mux {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	framer := zkp.NewFramer(conn, conn)
+	handshake(t, framer)
+	return zkp.NewClientMux(framer, conn)
+}
+
+func TestServer_Session(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+
+	// the session requests need the login
+	unauthenticated := map[string]proto.Message{
+		"whoami":   &zkp_pb.WhoAmIRequest{},
+		"password": &zkp_pb.ChangePasswordRequest{},
+		"logout":   &zkp_pb.LogoutRequest{},
+		"app":      &zkp_pb.AppRequest{Payload: []byte("hi")},
+	}
+	for name, message := range unauthenticated {
+		response := request(t, mux, message).(interface{ GetCode() zkp_pb.ErrorCode })
+		assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, response.GetCode(), name)
+	}
+
+	// the failed login doesn't authenticate the connection
+	assert.False(login(t, mux, "alice", 124).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, request(t, mux, &zkp_pb.WhoAmIRequest{}).(*zkp_pb.WhoAmIResponse).GetCode())
+
+	assert.True(login(t, mux, "alice", 123).GetResult())
+	whoAmI := request(t, mux, &zkp_pb.WhoAmIRequest{}).(*zkp_pb.WhoAmIResponse)
+	assert.True(whoAmI.GetResult())
+	assert.Equal("alice", whoAmI.GetUser())
+
+	app := request(t, mux, &zkp_pb.AppRequest{Payload: []byte("hi")}).(*zkp_pb.AppResponse)
+	assert.True(app.GetResult())
+	assert.Equal([]byte("hi"), app.GetPayload())
+
+	// change the password
+	invalid := request(t, mux, &zkp_pb.ChangePasswordRequest{}).(*zkp_pb.ChangePasswordResponse)
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, invalid.GetCode())
+	commits, err := zkp.NewProver(456).CreateRegisterCommits()
+	assert.NoError(err)
+	changed := request(t, mux, &zkp_pb.ChangePasswordRequest{
+		Commits: []*zkp_pb.RegisterRequest_Commits{
+			{Y1: commits.C1.Bytes(), Y2: commits.C2.Bytes()},
+		},
+	}).(*zkp_pb.ChangePasswordResponse)
+	assert.True(changed.GetResult())
+
+	// the session ends, the connection stays open
+	assert.True(request(t, mux, &zkp_pb.LogoutRequest{}).(*zkp_pb.LogoutResponse).GetResult())
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, request(t, mux, &zkp_pb.WhoAmIRequest{}).(*zkp_pb.WhoAmIResponse).GetCode())
+	assert.Equal(zkp_pb.ErrorCode_AUTH_FAILED, login(t, mux, "alice", 123).GetCode())
+	assert.True(login(t, mux, "alice", 456).GetResult())
+
+	// the other connection has its own session
+	other := connect(t, address)
+	defer other.Close()
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, request(t, other, &zkp_pb.WhoAmIRequest{}).(*zkp_pb.WhoAmIResponse).GetCode())
+}
+
+func TestServer_App(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.App = func(ctx context.Context, user zkp.UUID, payload []byte) ([]byte, error) {
+		return bytes.ToUpper(append([]byte(user+": "), payload...)), nil
+	}
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+	assert.True(login(t, mux, "alice", 123).GetResult())
+	response := request(t, mux, &zkp_pb.AppRequest{Payload: []byte("hi")}).(*zkp_pb.AppResponse)
+	assert.True(response.GetResult())
+	assert.Equal([]byte("ALICE: HI"), response.GetPayload())
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// shutdownPollInterval is the period checking whether the connections are drained
+const shutdownPollInterval = 10 * time.Millisecond
+
+var ServerClosedError = errors.New("server closed")
+
+type (
+	// Flusher is implemented by the storage buffering the writes, flushed by Shutdown
+	Flusher interface {
+		Flush() error
+	}
+
+	// stopFunc stops the transport gracefully, the transport is closed when the context is done
+	stopFunc func(ctx context.Context) error
+
+	// shutdownState tracks the running transports and connections for Shutdown
+	shutdownState struct {
+		mu     sync.Mutex
+		closed bool
+		// closed when Shutdown starts
+		done       chan struct{}
+		transports map[*stopFunc]struct{}
+		// the cancel functions of the connection contexts
+		conns map[*context.CancelFunc]struct{}
+	}
+)
+
+// Shutdown stops the server gracefully
+// The listeners of all transports stop accepting, the idle connections are closed
+// and the exchanges in progress, e.g. the authentications, finish. When the context is done first,
+// the remaining connections are closed and the context error is returned. The storage is flushed at the end.
+// The Serve methods return nil once Shutdown starts and ServerClosedError if called afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	transports := s.shutdown.begin()
+	s.infof("shutting down")
+
+	errs := make(chan error, len(transports))
+	for _, stop := range transports {
+		go func(stop stopFunc) {
+			errs <- stop(ctx)
+		}(stop)
+	}
+	firstErr := s.shutdown.drain(ctx)
+	for range transports {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// the registry and the sessions share the store
+	if f, ok := s.registry.(Flusher); ok {
+		if err := f.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.infof("shutdown complete")
+	return firstErr
+}
+
+// serveConn serves the accepted connection, Shutdown waits for it to end
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if addr := conn.RemoteAddr(); addr != nil {
+		ctx = withRemoteAddr(ctx, addr.String())
+	}
+	untrack, err := s.shutdown.trackConn(&cancel)
+	if err != nil {
+		return err
+	}
+	defer untrack()
+	return s.serve(ctx, conn)
+}
+
+// drainContext returns the context cancelled when Shutdown starts
+// The connection stops accepting new streams then.
+func (s *Server) drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := s.shutdown.doneChan()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// shuttingDown tells whether Shutdown has started
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.shutdown.doneChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// doneChan returns the channel closed when Shutdown starts
+func (st *shutdownState) doneChan() <-chan struct{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done == nil {
+		st.done = make(chan struct{})
+	}
+	return st.done
+}
+
+// begin marks the server closed and returns the transports to stop
+func (st *shutdownState) begin() []stopFunc {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.done == nil {
+		st.done = make(chan struct{})
+	}
+	if !st.closed {
+		st.closed = true
+		close(st.done)
+	}
+	transports := make([]stopFunc, 0, len(st.transports))
+	for stop := range st.transports {
+		transports = append(transports, *stop)
+	}
+	return transports
+}
+
+// trackTransport registers the stop function of the running transport
+// Returns the function unregistering it, or ServerClosedError after Shutdown.
+func (st *shutdownState) trackTransport(stop stopFunc) (func(), error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return nil, ServerClosedError
+	}
+	if st.transports == nil {
+		st.transports = make(map[*stopFunc]struct{})
+	}
+	st.transports[&stop] = struct{}{}
+	return func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		delete(st.transports, &stop)
+	}, nil
+}
+
+// trackConn registers the cancel function of the connection context
+// Returns the function unregistering it, or ServerClosedError after Shutdown.
+func (st *shutdownState) trackConn(cancel *context.CancelFunc) (func(), error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return nil, ServerClosedError
+	}
+	if st.conns == nil {
+		st.conns = make(map[*context.CancelFunc]struct{})
+	}
+	st.conns[cancel] = struct{}{}
+	return func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		delete(st.conns, cancel)
+	}, nil
+}
+
+// drain waits for the connections to end, they are cancelled when the context is done
+func (st *shutdownState) drain(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		st.mu.Lock()
+		remaining := len(st.conns)
+		st.mu.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			st.mu.Lock()
+			for cancel := range st.conns {
+				(*cancel)()
+			}
+			st.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package app_test
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// flushingStore counts the flushes of the memory store
+type flushingStore struct {
+	store.InMemoryStore
+	flushed int32
+}
+
+func (f *flushingStore) Flush() error {
+	atomic.AddInt32(&f.flushed, 1)
+	return nil
+}
+
+// checkGoroutines returns the function failing the test if the goroutines started since don't exit
+func checkGoroutines(t *testing.T) func() {
+	before := runtime.NumGoroutine()
+	return func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				t.Errorf("leaked goroutines: %d, was %d\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// serveAll serves all transports on the new local listeners returning the TCP address and the serve results
+func serveAll(t *testing.T, server *svr.Server) (string, <-chan error) {
+	ctx := context.Background()
+	var listeners []net.Listener
+	for i := 0; i < 4; i++ {
+		l, err := svr.Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+	}
+	served := make(chan error, len(listeners))
+	go func() { served <- server.ServeListeners(ctx, listeners[0]) }()
+	go func() { served <- server.ServeGRPC(ctx, listeners[1]) }()
+	go func() { served <- server.ServeREST(ctx, listeners[2]) }()
+	go func() { served <- server.ServeWebSocket(ctx, listeners[3]) }()
+	return listeners[0].Addr().String(), served
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	assert := assert.New(t)
+	defer checkGoroutines(t)()
+	registry := &flushingStore{InMemoryStore: store.NewInMemoryStore()}
+	server := svr.NewServerWithStore(registry)
+	commits, err := zkp.NewProver(123).CreateRegisterCommits()
+	assert.NoError(err)
+	assert.NoError(server.Register("alice", commits))
+	address, served := serveAll(t, server)
+
+	idle := connect(t, address)
+	defer idle.Close()
+	busy := connect(t, address)
+	defer busy.Close()
+	// the authentication is in progress when the shutdown starts
+	stream, err := busy.Open()
+	assert.NoError(err)
+	defer stream.Close()
+	prover := sendAuthRequest(t, stream, "alice", 123)
+	msg, err := stream.ReadMessageContext(context.Background())
+	assert.NoError(err)
+	challenge := msg.(*zkp_pb.ChallengeResponse)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	// the idle connection is closed and the new ones are refused
+	assert.Eventually(func() bool { return idle.Err() != nil }, time.Second, 10*time.Millisecond)
+	assert.Eventually(func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// the authentication finishes
+	answer := prover.ProveAuthentication(new(big.Int).SetBytes(challenge.GetChallenge()))
+	assert.NoError(stream.SendMessageContext(context.Background(), &zkp_pb.AnswerRequest{Answer: answer.Bytes()}))
+	msg, err = stream.ReadMessageContext(context.Background())
+	if assert.NoError(err) {
+		assert.True(msg.(*zkp_pb.AuthResponse).GetResult())
+	}
+
+	assert.NoError(<-shutdown)
+	for i := 0; i < 4; i++ {
+		assert.NoError(<-served)
+	}
+	assert.Equal(int32(1), atomic.LoadInt32(&registry.flushed))
+	assert.Eventually(func() bool { return busy.Err() != nil }, time.Second, 10*time.Millisecond)
+
+	// the server doesn't start again
+	l, err := svr.Listen("127.0.0.1:0")
+	assert.NoError(err)
+	assert.ErrorIs(server.Serve(l), svr.ServerClosedError)
+}
+
+func TestServer_Shutdown_Deadline(t *testing.T) {
+	assert := assert.New(t)
+	defer checkGoroutines(t)()
+	server := svr.NewServer()
+	server.Timeouts = svr.Timeouts{}
+	commits, err := zkp.NewProver(123).CreateRegisterCommits()
+	assert.NoError(err)
+	assert.NoError(server.Register("alice", commits))
+	address, served := serveAll(t, server)
+
+	// the client never answers the challenge
+	mux := connect(t, address)
+	defer mux.Close()
+	stream, err := mux.Open()
+	assert.NoError(err)
+	defer stream.Close()
+	sendAuthRequest(t, stream, "alice", 123)
+	_, err = stream.ReadMessageContext(context.Background())
+	assert.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(server.Shutdown(ctx), context.DeadlineExceeded)
+	for i := 0; i < 4; i++ {
+		assert.NoError(<-served)
+	}
+	// the connection is closed
+	_, err = stream.ReadMessageContext(context.Background())
+	assert.Error(err)
+}
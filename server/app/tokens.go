@@ -0,0 +1,257 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+var (
+	TokensDisabledError      = errors.New("session tokens are disabled")
+	InvalidRefreshTokenError = errors.New("invalid refresh token")
+	UnknownSessionError      = errors.New("unknown session")
+)
+
+// newRefreshToken returns the refresh token of the session and the hash kept in the store
+// The token is the session id and a random secret.
+func newRefreshToken(id string) (string, []byte, error) {
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", nil, err
+	}
+	hash := sha256.Sum256(secret[:])
+	return id + "." + hex.EncodeToString(secret[:]), hash[:], nil
+}
+
+// parseRefreshToken returns the session id and the secret hash of the refresh token
+func parseRefreshToken(refreshToken string) (string, []byte, error) {
+	id, encoded, ok := strings.Cut(refreshToken, ".")
+	if !ok || id == "" {
+		return "", nil, InvalidRefreshTokenError
+	}
+	secret, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", nil, InvalidRefreshTokenError
+	}
+	hash := sha256.Sum256(secret)
+	return id, hash[:], nil
+}
+
+// verifyToken checks the session token was issued by the server and isn't revoked
+func (s *Server) verifyToken(signed string) (*token.Claims, error) {
+	if s.Tokens == nil {
+		return nil, TokensDisabledError
+	}
+	verifier := token.NewVerifier(s.Tokens.PublicKey())
+	verifier.Issuer = s.Tokens.Issuer
+	verifier.Revocations = s.sessions
+	return verifier.Verify(signed)
+}
+
+// revokeSession ends the session, its tokens are rejected until they expire
+func (s *Server) revokeSession(session *store.Session) error {
+	// the last token is refreshed just before the session ends
+	until := session.ExpiresAt.Add(s.Tokens.TTL + token.DefaultLeeway)
+	if err := s.sessions.RevokeSession(session.ID, until); err != nil {
+		return err
+	}
+	s.infof("revoked session %s of user %q", session.ID, session.User)
+	return nil
+}
+
+// requestUser returns the user authenticated by the token, or by the login on the connection if the token is empty,
+// and the id of the session the request came from
+func (s *Server) requestUser(sess *session, signed string) (zkp.UUID, string, error) {
+	if s.Tokens == nil {
+		return "", "", TokensDisabledError
+	}
+	if signed == "" {
+		return s.currentUser(sess)
+	}
+	claims, err := s.verifyToken(signed)
+	if err != nil {
+		return "", "", err
+	}
+	return zkp.UUID(claims.Subject), claims.ID, nil
+}
+
+func (s *Server) serveIntrospect(ctx context.Context, conn zkp.MessageConn, request *zkp_pb.IntrospectRequest) error {
+	response, err := s.introspect(request)
+	if err != nil {
+		response = newResponseError(err).introspectResponse()
+	}
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// introspect returns the state of the token, the invalid token is reported inactive
+func (s *Server) introspect(request *zkp_pb.IntrospectRequest) (*zkp_pb.IntrospectResponse, error) {
+	if s.Tokens == nil {
+		return nil, TokensDisabledError
+	}
+	claims, err := s.verifyToken(request.GetToken())
+	if err != nil {
+		return &zkp_pb.IntrospectResponse{Result: true, Active: false}, nil
+	}
+	return &zkp_pb.IntrospectResponse{
+		Result:      true,
+		Active:      true,
+		User:        claims.Subject,
+		SessionId:   claims.ID,
+		IssuedAt:    claims.IssuedAt,
+		ExpiresAt:   claims.ExpiresAt,
+		AuthMethods: claims.AuthMethods,
+	}, nil
+}
+
+func (s *Server) serveRefresh(ctx context.Context, conn zkp.MessageConn, request *zkp_pb.RefreshRequest) error {
+	response, err := s.refresh(request)
+	if err != nil {
+		response = newResponseError(err).refreshResponse()
+	}
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// refresh issues the new token of the session replacing the refresh token
+func (s *Server) refresh(request *zkp_pb.RefreshRequest) (*zkp_pb.RefreshResponse, error) {
+	if s.Tokens == nil {
+		return nil, TokensDisabledError
+	}
+	id, hash, err := parseRefreshToken(request.GetRefreshToken())
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.sessions.GetSession(id)
+	if errors.Is(err, store.SessionDoesNotExistError) {
+		return nil, InvalidRefreshTokenError
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(hash, session.RefreshHash) != 1 {
+		return nil, InvalidRefreshTokenError
+	}
+
+	signed, claims, err := s.Tokens.IssueSession(session.ID, string(session.User), session.AuthMethods...)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, refreshHash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	// the concurrent refreshes with the same token race for the rotation, only the first one succeeds
+	session.RefreshHash = refreshHash
+	err = s.sessions.RotateSession(session.ID, hash, session)
+	if errors.Is(err, store.SessionDoesNotExistError) || errors.Is(err, store.SessionChangedError) {
+		return nil, InvalidRefreshTokenError
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &zkp_pb.RefreshResponse{
+		Result:       true,
+		Token:        signed,
+		ExpiresAt:    claims.ExpiresAt,
+		SessionId:    claims.ID,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (s *Server) serveRevoke(ctx context.Context, conn zkp.MessageConn, sess *session, request *zkp_pb.RevokeRequest) error {
+	response, err := s.revoke(sess, request)
+	if err != nil {
+		response = newResponseError(err).revokeResponse()
+	}
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// revoke ends the requested sessions of the user
+// The connection is logged out if its session is revoked.
+func (s *Server) revoke(sess *session, request *zkp_pb.RevokeRequest) (*zkp_pb.RevokeResponse, error) {
+	user, current, err := s.requestUser(sess, request.GetToken())
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*store.Session
+	switch {
+	case request.GetAll():
+		sessions, err = s.sessions.Sessions(user)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		id := request.GetSessionId()
+		if id == "" {
+			id = current
+		}
+		session, err := s.sessions.GetSession(id)
+		if errors.Is(err, store.SessionDoesNotExistError) || (err == nil && session.User != user) {
+			// the sessions of the other users look the same as the missing ones
+			return nil, UnknownSessionError
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = []*store.Session{session}
+	}
+
+	for _, session := range sessions {
+		if err := s.revokeSession(session); err != nil {
+			return nil, err
+		}
+		sess.revoked(session.ID)
+	}
+	return &zkp_pb.RevokeResponse{Result: true, Revoked: uint32(len(sessions))}, nil
+}
+
+func (s *Server) serveSessions(ctx context.Context, conn zkp.MessageConn, sess *session, request *zkp_pb.SessionsRequest) error {
+	response, err := s.listSessions(sess, request)
+	if err != nil {
+		response = newResponseError(err).sessionsResponse()
+	}
+	if err := s.send(ctx, conn, response); err != nil {
+		return err
+	}
+	return err
+}
+
+// listSessions returns the active sessions of the user
+func (s *Server) listSessions(sess *session, request *zkp_pb.SessionsRequest) (*zkp_pb.SessionsResponse, error) {
+	user, current, err := s.requestUser(sess, request.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessions.Sessions(user)
+	if err != nil {
+		return nil, err
+	}
+	response := &zkp_pb.SessionsResponse{Result: true}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, &zkp_pb.SessionsResponse_Session{
+			Id:        session.ID,
+			IssuedAt:  session.IssuedAt.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+			Current:   session.ID == current,
+		})
+	}
+	return response, nil
+}
@@ -0,0 +1,184 @@
+package app_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/store"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServer_TokenLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	server.Tokens = newSigner(t)
+	address := startServer(t, server, "alice")
+	commits, err := zkp.NewProver(456).CreateRegisterCommits()
+	assert.NoError(err)
+	assert.NoError(server.Register("bob", commits))
+
+	mux := connect(t, address)
+	defer mux.Close()
+	first := login(t, mux, "alice", 123)
+	assert.True(first.GetResult())
+	assert.NotEmpty(first.GetRefreshToken())
+
+	introspect := request(t, mux, &zkp_pb.IntrospectRequest{Token: first.GetToken()}).(*zkp_pb.IntrospectResponse)
+	assert.True(introspect.GetActive())
+	assert.Equal("alice", introspect.GetUser())
+	assert.Equal(first.GetSessionId(), introspect.GetSessionId())
+	invalid := request(t, mux, &zkp_pb.IntrospectRequest{Token: "invalid"}).(*zkp_pb.IntrospectResponse)
+	assert.True(invalid.GetResult())
+	assert.False(invalid.GetActive())
+
+	// the refresh token is replaced on every use
+	refreshed := request(t, mux, &zkp_pb.RefreshRequest{RefreshToken: first.GetRefreshToken()}).(*zkp_pb.RefreshResponse)
+	assert.True(refreshed.GetResult())
+	assert.Equal(first.GetSessionId(), refreshed.GetSessionId())
+	assert.NotEqual(first.GetRefreshToken(), refreshed.GetRefreshToken())
+	reused := request(t, mux, &zkp_pb.RefreshRequest{RefreshToken: first.GetRefreshToken()}).(*zkp_pb.RefreshResponse)
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, reused.GetCode())
+
+	// the second session logs in on the other connection
+	other := connect(t, address)
+	defer other.Close()
+	second := login(t, other, "alice", 123)
+	assert.True(second.GetResult())
+	sessions := request(t, mux, &zkp_pb.SessionsRequest{}).(*zkp_pb.SessionsResponse)
+	assert.True(sessions.GetResult())
+	if assert.Len(sessions.GetSessions(), 2) {
+		assert.Equal(first.GetSessionId(), sessions.GetSessions()[0].GetId())
+		assert.True(sessions.GetSessions()[0].GetCurrent())
+		assert.Equal(second.GetSessionId(), sessions.GetSessions()[1].GetId())
+		assert.False(sessions.GetSessions()[1].GetCurrent())
+	}
+
+	// the sessions of the other users can't be revoked
+	bob := login(t, mux, "bob", 456)
+	assert.True(bob.GetResult())
+	unknown := request(t, mux, &zkp_pb.RevokeRequest{Token: bob.GetToken(), SessionId: second.GetSessionId()}).(*zkp_pb.RevokeResponse)
+	assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, unknown.GetCode())
+
+	// revoking the session by token logs out its connection
+	revoked := request(t, mux, &zkp_pb.RevokeRequest{Token: refreshed.GetToken(), SessionId: second.GetSessionId()}).(*zkp_pb.RevokeResponse)
+	assert.True(revoked.GetResult())
+	assert.Equal(uint32(1), revoked.GetRevoked())
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, request(t, other, &zkp_pb.WhoAmIRequest{}).(*zkp_pb.WhoAmIResponse).GetCode())
+	introspect = request(t, mux, &zkp_pb.IntrospectRequest{Token: second.GetToken()}).(*zkp_pb.IntrospectResponse)
+	assert.False(introspect.GetActive())
+	refresh := request(t, mux, &zkp_pb.RefreshRequest{RefreshToken: second.GetRefreshToken()}).(*zkp_pb.RefreshResponse)
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, refresh.GetCode())
+
+	// all sessions end
+	third := login(t, other, "alice", 123)
+	assert.True(third.GetResult())
+	revoked = request(t, other, &zkp_pb.RevokeRequest{All: true}).(*zkp_pb.RevokeResponse)
+	assert.True(revoked.GetResult())
+	assert.Equal(uint32(2), revoked.GetRevoked())
+	for _, signed := range []string{refreshed.GetToken(), third.GetToken()} {
+		introspect = request(t, mux, &zkp_pb.IntrospectRequest{Token: signed}).(*zkp_pb.IntrospectResponse)
+		assert.False(introspect.GetActive())
+	}
+	assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, request(t, other, &zkp_pb.SessionsRequest{}).(*zkp_pb.SessionsResponse).GetCode())
+
+	// the logout revokes the session token
+	assert.True(request(t, mux, &zkp_pb.LogoutRequest{}).(*zkp_pb.LogoutResponse).GetResult())
+	introspect = request(t, mux, &zkp_pb.IntrospectRequest{Token: bob.GetToken()}).(*zkp_pb.IntrospectResponse)
+	assert.False(introspect.GetActive())
+}
+
+// racingStore holds the session reads until all expected readers have the session
+type racingStore struct {
+	store.InMemoryStore
+	mu      sync.Mutex
+	readers *sync.WaitGroup
+}
+
+func (s *racingStore) expect(readers int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers = &sync.WaitGroup{}
+	s.readers.Add(readers)
+}
+
+func (s *racingStore) GetSession(id string) (*store.Session, error) {
+	session, err := s.InMemoryStore.GetSession(id)
+	s.mu.Lock()
+	readers := s.readers
+	s.mu.Unlock()
+	if readers != nil {
+		readers.Done()
+		readers.Wait()
+	}
+	return session, err
+}
+
+func TestServer_Refresh_Concurrent(t *testing.T) {
+	assert := assert.New(t)
+	sessions := &racingStore{InMemoryStore: store.NewInMemoryStore()}
+	server := svr.NewServerWithStore(sessions)
+	server.Tokens = newSigner(t)
+	address := startServer(t, server, "alice")
+
+	mux := connect(t, address)
+	defer mux.Close()
+	first := login(t, mux, "alice", 123)
+	assert.True(first.GetResult())
+
+	// all refreshes read the session before any of them rotates the refresh token
+	ctx := context.Background()
+	const refreshes = 8
+	sessions.expect(refreshes)
+	responses := make(chan *zkp_pb.RefreshResponse, refreshes)
+	for i := 0; i < refreshes; i++ {
+		go func() {
+			stream, err := mux.Open()
+			if err != nil {
+				responses <- nil
+				return
+			}
+			defer stream.Close()
+			var response *zkp_pb.RefreshResponse
+			if err := stream.SendMessageContext(ctx, &zkp_pb.RefreshRequest{RefreshToken: first.GetRefreshToken()}); err == nil {
+				msg, _ := stream.ReadMessageContext(ctx)
+				response, _ = msg.(*zkp_pb.RefreshResponse)
+			}
+			responses <- response
+		}()
+	}
+
+	succeeded := 0
+	for i := 0; i < refreshes; i++ {
+		response := <-responses
+		if assert.NotNil(response) && response.GetResult() {
+			succeeded++
+		} else if response != nil {
+			assert.Equal(zkp_pb.ErrorCode_UNAUTHENTICATED, response.GetCode())
+		}
+	}
+	assert.Equal(1, succeeded)
+}
+
+func TestServer_TokenLifecycle_NoTokens(t *testing.T) {
+	assert := assert.New(t)
+	server := svr.NewServer()
+	address := startServer(t, server)
+
+	mux := connect(t, address)
+	defer mux.Close()
+	requests := map[string]proto.Message{
+		"introspect": &zkp_pb.IntrospectRequest{Token: "token"},
+		"refresh":    &zkp_pb.RefreshRequest{RefreshToken: "1.00"},
+		"revoke":     &zkp_pb.RevokeRequest{Token: "token"},
+		"sessions":   &zkp_pb.SessionsRequest{Token: "token"},
+	}
+	for name, message := range requests {
+		response := request(t, mux, message).(interface{ GetCode() zkp_pb.ErrorCode })
+		assert.Equal(zkp_pb.ErrorCode_INVALID_REQUEST, response.GetCode(), name)
+	}
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/mindaugasrukas/zkp_example/capture"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+// WebSocketPath is the path of the WebSocket endpoint
+const WebSocketPath = "/ws"
+
+// RunWebSocketContext starts the WebSocket listener and serves until the context is cancelled
+func (s *Server) RunWebSocketContext(ctx context.Context, port string) error {
+	l, err := Listen(port)
+	if err != nil {
+		return err
+	}
+	return s.ServeWebSocket(ctx, l)
+}
+
+// ServeWebSocket serves the envelope protocol over WebSocket on the listener until the context is cancelled or Shutdown is called
+func (s *Server) ServeWebSocket(ctx context.Context, l net.Listener) error {
+	l = s.limitListener(ctx, l)
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(WebSocketPath, s.WebSocketHandler())
+	httpServer := &http.Server{
+		Handler: mux,
+		// cancel the sessions with the server
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+		// the protocol phases have own timeouts after the upgrade
+		ReadHeaderTimeout: s.Timeouts.Request,
+	}
+
+	untrack, err := s.shutdown.trackTransport(httpServer.Shutdown)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	defer untrack()
+
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-ctx.Done():
+			httpServer.Close()
+		case <-served:
+		}
+	}()
+
+	s.infof("Listening WebSocket on %v", l.Addr())
+	if err := httpServer.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// WebSocketHandler returns the handler upgrading the request to WebSocket
+// and serving the envelope protocol on it, each binary message carries one frame.
+// Cross-origin requests are rejected.
+func (s *Server) WebSocketHandler() http.Handler {
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout: s.Timeouts.Write,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader replied with the error
+			s.errorf("%v", err)
+			return
+		}
+
+		conn := zkp.NewWebSocketConn(ws)
+		defer conn.Close()
+		if s.Recorder != nil {
+			conn = s.Recorder.Conn(conn, capture.Server)
+		}
+		if err := s.serveConn(r.Context(), conn); err != nil {
+			// log the error and continue
+			s.errorf("%v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package app_test
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	svr "github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// dialWebSocket connects to the test server and returns the protocol framer
+func dialWebSocket(t *testing.T, url string) *zkp.Framer {
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+svr.WebSocketPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := zkp.NewWebSocketConn(ws)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return zkp.NewFramer(conn, conn)
+}
+
+// handshake sends the default hello and checks the server accepted it
+func handshake(t *testing.T, framer *zkp.Framer) {
+	ctx := context.Background()
+	framer.RequireHello = true
+	if err := framer.SendMessageContext(ctx, zkp.DefaultCapabilities.Hello()); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := framer.ReadMessageContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zkp.DefaultCapabilities.Check(msg.(*zkp_pb.HelloResponse)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebSocket_RegisterAndLogin(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(svr.NewServer().WebSocketHandler())
+	defer server.Close()
+
+	// register
+	framer := dialWebSocket(t, server.URL)
+	handshake(t, framer)
+	commits, err := zkp.NewProver(123).CreateRegisterCommits()
+	assert.NoError(err)
+	err = framer.SendMessageContext(ctx, &zkp_pb.RegisterRequest{
+		User: "max",
+		Commits: []*zkp_pb.RegisterRequest_Commits{
+			{Y1: commits.C1.Bytes(), Y2: commits.C2.Bytes()},
+		},
+	})
+	assert.NoError(err)
+	msg, err := framer.ReadMessageContext(ctx)
+	assert.NoError(err)
+	registerResponse, ok := msg.(*zkp_pb.RegisterResponse)
+	assert.True(ok)
+	assert.True(registerResponse.Result)
+
+	// login
+	framer = dialWebSocket(t, server.URL)
+	handshake(t, framer)
+	prover := zkp.NewProver(123)
+	authCommits, err := prover.CreateAuthenticationCommits()
+	assert.NoError(err)
+	err = framer.SendMessageContext(ctx, &zkp_pb.AuthRequest{
+		User: "max",
+		Commits: []*zkp_pb.AuthRequest_Commits{
+			{R1: authCommits.C1.Bytes(), R2: authCommits.C2.Bytes()},
+		},
+	})
+	assert.NoError(err)
+	msg, err = framer.ReadMessageContext(ctx)
+	assert.NoError(err)
+	challengeResponse, ok := msg.(*zkp_pb.ChallengeResponse)
+	assert.True(ok)
+
+	answer := prover.ProveAuthentication(new(big.Int).SetBytes(challengeResponse.GetChallenge()))
+	err = framer.SendMessageContext(ctx, &zkp_pb.AnswerRequest{Answer: answer.Bytes()})
+	assert.NoError(err)
+	msg, err = framer.ReadMessageContext(ctx)
+	assert.NoError(err)
+	authResponse, ok := msg.(*zkp_pb.AuthResponse)
+	assert.True(ok)
+	assert.True(authResponse.Result)
+}
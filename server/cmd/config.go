@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/tlsutil"
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables setting the config keys,
+// e.g. ZKP_PORT or ZKP_TLS_CERT for tls.cert
+const EnvPrefix = "ZKP"
+
+// minFakeUserKeySize is the shortest secret accepted from the fake-user-key file
+const minFakeUserKeySize = 16
+
+// StorageMemory is the storage backend keeping the users in memory, the only one supported
+const StorageMemory = "memory"
+
+var InvalidConfigError = errors.New("invalid config")
+
+type (
+	// Config is the server configuration
+	// The keys are set by the config file, the environment and the flags, the flags have the highest priority.
+	Config struct {
+		// Listen are the addresses of the TCP protocol, see app.Listen
+		Listen []string `mapstructure:"listen"`
+		// Port is listened on if there are no Listen addresses or inherited listeners
+		Port string `mapstructure:"port"`
+		// GRPCPort, HTTPPort and WSPort enable the other transports if not empty
+		GRPCPort string `mapstructure:"grpc-port"`
+		HTTPPort string `mapstructure:"http-port"`
+		WSPort   string `mapstructure:"ws-port"`
+
+		TLS TLSConfig `mapstructure:"tls"`
+		// Groups are the group names offered in the protocol negotiation in the order of preference
+		Groups []string `mapstructure:"groups"`
+		// GroupsFile defines the custom group parameters, only the built-in groups are supported so far
+		GroupsFile string `mapstructure:"groups-file"`
+
+		Storage  StorageConfig `mapstructure:"storage"`
+		Timeouts app.Timeouts  `mapstructure:"timeouts"`
+		Log      LogConfig     `mapstructure:"log"`
+		Tokens   TokensConfig  `mapstructure:"tokens"`
+		// Connections bound the connections of all transports served at once
+		Connections ConnectionsConfig `mapstructure:"connections"`
+		// RateLimits limit the registrations and the authentications
+		RateLimits RateLimitsConfig `mapstructure:"rate-limits"`
+		// Lockout delays the logins after the failed ones
+		Lockout LockoutConfig `mapstructure:"lockout"`
+		// Admins are the users allowed to run the admin commands: unlock and stats
+		Admins []string `mapstructure:"admins"`
+		// FakeUserKey is the file of the secret deriving the commits of the unknown users, random if empty
+		FakeUserKey string `mapstructure:"fake-user-key"`
+		// ReportUserExists tells the registration the user name is taken, revealing the users
+		ReportUserExists bool `mapstructure:"report-user-exists"`
+		// Record is the file recording the TCP and WebSocket protocol frames
+		Record string `mapstructure:"record"`
+		// ShutdownTimeout limits the time to finish the exchanges in progress on SIGINT or SIGTERM
+		ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout"`
+	}
+
+	// TLSConfig enables TLS if the certificate is set
+	TLSConfig struct {
+		Cert string `mapstructure:"cert"`
+		Key  string `mapstructure:"key"`
+		// ClientCA verifies the client certificates
+		ClientCA          string `mapstructure:"client-ca"`
+		RequireClientCert bool   `mapstructure:"require-client-cert"`
+	}
+
+	// StorageConfig selects the user registry
+	StorageConfig struct {
+		Backend string `mapstructure:"backend"`
+		// DSN is the data source name of the database backends
+		DSN string `mapstructure:"dsn"`
+	}
+
+	// LogConfig configures the server logging
+	LogConfig struct {
+		// Level is debug, info or error
+		Level string `mapstructure:"level"`
+	}
+
+	// TokensConfig enables the session tokens if the key is set
+	TokensConfig struct {
+		// Key is the Ed25519 private key file signing the tokens
+		Key        string        `mapstructure:"key"`
+		TTL        time.Duration `mapstructure:"ttl"`
+		Issuer     string        `mapstructure:"issuer"`
+		SessionTTL time.Duration `mapstructure:"session-ttl"`
+	}
+
+	// ConnectionsConfig is app.ConnectionLimits, zero disables the limit
+	ConnectionsConfig struct {
+		Max          int           `mapstructure:"max"`
+		Queue        int           `mapstructure:"queue"`
+		QueueTimeout time.Duration `mapstructure:"queue-timeout"`
+		PerIP        int           `mapstructure:"per-ip"`
+	}
+
+	// RateLimitsConfig are the token buckets of app.RateLimits, zero rate disables the limit
+	RateLimitsConfig struct {
+		PerIP   app.RateLimit `mapstructure:"per-ip"`
+		PerUser app.RateLimit `mapstructure:"per-user"`
+		Global  app.RateLimit `mapstructure:"global"`
+	}
+
+	// LockoutConfig is app.Lockout, all zero disables the lockout
+	LockoutConfig struct {
+		FreeAttempts int           `mapstructure:"free-attempts"`
+		Delay        time.Duration `mapstructure:"delay"`
+		MaxDelay     time.Duration `mapstructure:"max-delay"`
+		LockAttempts int           `mapstructure:"lock-attempts"`
+		LockDuration time.Duration `mapstructure:"lock-duration"`
+	}
+)
+
+// DefaultConfig returns the configuration used without the config file
+func DefaultConfig() *Config {
+	return &Config{
+		Port:     "8080",
+		Groups:   append([]string(nil), zkp.DefaultCapabilities.Groups...),
+		Storage:  StorageConfig{Backend: StorageMemory},
+		Timeouts: app.DefaultTimeouts,
+		Log:      LogConfig{Level: "info"},
+		Tokens: TokensConfig{
+			TTL:        token.DefaultTTL,
+			SessionTTL: app.DefaultSessionTTL,
+		},
+		Connections: ConnectionsConfig(app.DefaultConnectionLimits),
+		RateLimits: RateLimitsConfig{
+			PerIP:   app.DefaultRateLimits.PerIP,
+			PerUser: app.DefaultRateLimits.PerUser,
+			Global:  app.DefaultRateLimits.Global,
+		},
+		Lockout:         LockoutConfig(app.DefaultLockout),
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// setDefaults registers the keys of the default configuration
+// Viper reads the environment only for the registered keys.
+func setDefaults(v *viper.Viper) {
+	d := DefaultConfig()
+	v.SetDefault("listen", d.Listen)
+	v.SetDefault("port", d.Port)
+	v.SetDefault("grpc-port", d.GRPCPort)
+	v.SetDefault("http-port", d.HTTPPort)
+	v.SetDefault("ws-port", d.WSPort)
+	v.SetDefault("tls.cert", d.TLS.Cert)
+	v.SetDefault("tls.key", d.TLS.Key)
+	v.SetDefault("tls.client-ca", d.TLS.ClientCA)
+	v.SetDefault("tls.require-client-cert", d.TLS.RequireClientCert)
+	v.SetDefault("groups", d.Groups)
+	v.SetDefault("groups-file", d.GroupsFile)
+	v.SetDefault("storage.backend", d.Storage.Backend)
+	v.SetDefault("storage.dsn", d.Storage.DSN)
+	v.SetDefault("timeouts.request", d.Timeouts.Request)
+	v.SetDefault("timeouts.answer", d.Timeouts.Answer)
+	v.SetDefault("timeouts.write", d.Timeouts.Write)
+	v.SetDefault("log.level", d.Log.Level)
+	v.SetDefault("tokens.key", d.Tokens.Key)
+	v.SetDefault("tokens.ttl", d.Tokens.TTL)
+	v.SetDefault("tokens.issuer", d.Tokens.Issuer)
+	v.SetDefault("tokens.session-ttl", d.Tokens.SessionTTL)
+	v.SetDefault("connections.max", d.Connections.Max)
+	v.SetDefault("connections.queue", d.Connections.Queue)
+	v.SetDefault("connections.queue-timeout", d.Connections.QueueTimeout)
+	v.SetDefault("connections.per-ip", d.Connections.PerIP)
+	v.SetDefault("rate-limits.per-ip.rate", d.RateLimits.PerIP.Rate)
+	v.SetDefault("rate-limits.per-ip.burst", d.RateLimits.PerIP.Burst)
+	v.SetDefault("rate-limits.per-user.rate", d.RateLimits.PerUser.Rate)
+	v.SetDefault("rate-limits.per-user.burst", d.RateLimits.PerUser.Burst)
+	v.SetDefault("rate-limits.global.rate", d.RateLimits.Global.Rate)
+	v.SetDefault("rate-limits.global.burst", d.RateLimits.Global.Burst)
+	v.SetDefault("lockout.free-attempts", d.Lockout.FreeAttempts)
+	v.SetDefault("lockout.delay", d.Lockout.Delay)
+	v.SetDefault("lockout.max-delay", d.Lockout.MaxDelay)
+	v.SetDefault("lockout.lock-attempts", d.Lockout.LockAttempts)
+	v.SetDefault("lockout.lock-duration", d.Lockout.LockDuration)
+	v.SetDefault("admins", d.Admins)
+	v.SetDefault("fake-user-key", d.FakeUserKey)
+	v.SetDefault("report-user-exists", d.ReportUserExists)
+	v.SetDefault("record", d.Record)
+	v.SetDefault("shutdown-timeout", d.ShutdownTimeout)
+}
+
+// LoadConfig reads the config file, YAML or TOML by the extension, and returns the validated configuration
+// No file is read if the path is empty. The ZKP_ environment variables and the flags bound to v
+// override the file. Unknown keys in the file are rejected.
+func LoadConfig(v *viper.Viper, path string) (*Config, error) {
+	setDefaults(v)
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", InvalidConfigError, path, err)
+		}
+	}
+
+	config := &Config{}
+	if err := v.UnmarshalExact(config); err != nil {
+		return nil, fmt.Errorf("%w: %v", InvalidConfigError, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks the configuration, the error lists all invalid keys
+// The key files are loaded by NewServer.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(key string, format string, args ...interface{}) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	for _, address := range c.Listen {
+		if err := app.ValidateAddress(address); err != nil {
+			add("listen", "%v", err)
+		}
+	}
+	addresses := map[string]string{"port": c.Port, "grpc-port": c.GRPCPort, "http-port": c.HTTPPort, "ws-port": c.WSPort}
+	for _, key := range []string{"port", "grpc-port", "http-port", "ws-port"} {
+		if addresses[key] == "" {
+			if key == "port" && len(c.Listen) == 0 {
+				add(key, "required without listen addresses")
+			}
+			continue
+		}
+		if err := app.ValidateAddress(addresses[key]); err != nil {
+			add(key, "%v", err)
+		}
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		add("tls", "cert and key are set together")
+	}
+	if c.TLS.Cert == "" && (c.TLS.ClientCA != "" || c.TLS.RequireClientCert) {
+		add("tls", "the client certificates are verified only with tls.cert and tls.key")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCA == "" {
+		add("tls.require-client-cert", "requires tls.client-ca")
+	}
+
+	supported := zkp.DefaultCapabilities.Groups
+	if len(c.Groups) == 0 {
+		add("groups", "at least one group is required, supported: %s", strings.Join(supported, ", "))
+	}
+	for _, group := range c.Groups {
+		if !contains(supported, group) {
+			add("groups", "unsupported group %q, supported: %s", group, strings.Join(supported, ", "))
+		}
+	}
+	if c.GroupsFile != "" {
+		add("groups-file", "custom group parameters are not supported yet, use the built-in groups: %s", strings.Join(supported, ", "))
+	}
+
+	switch c.Storage.Backend {
+	case StorageMemory:
+		if c.Storage.DSN != "" {
+			add("storage.dsn", "not used by the %s backend, no database backend is supported yet", StorageMemory)
+		}
+	default:
+		add("storage.backend", "unsupported backend %q, supported: %s", c.Storage.Backend, StorageMemory)
+	}
+
+	timeouts := map[string]time.Duration{"request": c.Timeouts.Request, "answer": c.Timeouts.Answer, "write": c.Timeouts.Write}
+	for _, key := range []string{"request", "answer", "write"} {
+		if timeouts[key] < 0 {
+			add("timeouts."+key, "negative duration %v, 0 means no limit", timeouts[key])
+		}
+	}
+
+	if c.ShutdownTimeout < 0 {
+		add("shutdown-timeout", "negative duration %v, 0 means no limit", c.ShutdownTimeout)
+	}
+
+	if _, err := app.ParseLogLevel(c.Log.Level); err != nil {
+		add("log.level", "%v, supported: debug, info, error", err)
+	}
+
+	if c.Tokens.TTL <= 0 {
+		add("tokens.ttl", "must be positive")
+	}
+	if c.Tokens.SessionTTL <= 0 {
+		add("tokens.session-ttl", "must be positive")
+	}
+
+	counts := map[string]int{"max": c.Connections.Max, "queue": c.Connections.Queue, "per-ip": c.Connections.PerIP}
+	for _, key := range []string{"max", "queue", "per-ip"} {
+		if counts[key] < 0 {
+			add("connections."+key, "negative count %d, 0 disables the limit", counts[key])
+		}
+	}
+	if c.Connections.QueueTimeout < 0 {
+		add("connections.queue-timeout", "negative duration %v, 0 - no timeout", c.Connections.QueueTimeout)
+	}
+
+	limits := map[string]app.RateLimit{"per-ip": c.RateLimits.PerIP, "per-user": c.RateLimits.PerUser, "global": c.RateLimits.Global}
+	for _, key := range []string{"per-ip", "per-user", "global"} {
+		if limits[key].Rate < 0 {
+			add("rate-limits."+key+".rate", "negative rate %v, 0 disables the limit", limits[key].Rate)
+		}
+		if limits[key].Rate > 0 && limits[key].Burst < 1 {
+			add("rate-limits."+key+".burst", "at least 1 request is allowed at once")
+		}
+	}
+
+	attempts := map[string]int{"free-attempts": c.Lockout.FreeAttempts, "lock-attempts": c.Lockout.LockAttempts}
+	for _, key := range []string{"free-attempts", "lock-attempts"} {
+		if attempts[key] < 0 {
+			add("lockout."+key, "negative count %d", attempts[key])
+		}
+	}
+	delays := map[string]time.Duration{"delay": c.Lockout.Delay, "max-delay": c.Lockout.MaxDelay, "lock-duration": c.Lockout.LockDuration}
+	for _, key := range []string{"delay", "max-delay", "lock-duration"} {
+		if delays[key] < 0 {
+			add("lockout."+key, "negative duration %v", delays[key])
+		}
+	}
+	if c.Lockout.LockAttempts > 0 && c.Lockout.LockDuration <= 0 {
+		add("lockout.lock-duration", "required with lockout.lock-attempts")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n  %s", InvalidConfigError, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// NewServer returns the server configured by the validated configuration
+// Returns the error if the TLS or token key files can't be loaded.
+func NewServer(c *Config) (*app.Server, error) {
+	server := app.NewServer()
+	server.Timeouts = c.Timeouts
+	server.Capabilities.Groups = c.Groups
+	level, err := app.ParseLogLevel(c.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	server.LogLevel = level
+	server.Connections = app.ConnectionLimits(c.Connections)
+	server.RateLimits = app.RateLimits{
+		PerIP:   c.RateLimits.PerIP,
+		PerUser: c.RateLimits.PerUser,
+		Global:  c.RateLimits.Global,
+	}
+	server.Lockout = app.Lockout(c.Lockout)
+	for _, admin := range c.Admins {
+		server.Admins = append(server.Admins, zkp.UUID(admin))
+	}
+	server.ReportUserExists = c.ReportUserExists
+	if c.FakeUserKey != "" {
+		key, err := ioutil.ReadFile(c.FakeUserKey)
+		if err != nil {
+			return nil, fmt.Errorf("fake-user-key: %w", err)
+		}
+		if len(key) < minFakeUserKeySize {
+			return nil, fmt.Errorf("fake-user-key: %w: at least %d bytes are required", InvalidConfigError, minFakeUserKeySize)
+		}
+		server.FakeUserKey = key
+	}
+
+	if c.TLS.Cert != "" {
+		config, err := tlsutil.ServerConfig(tlsutil.ServerOptions{
+			CertFile:          c.TLS.Cert,
+			KeyFile:           c.TLS.Key,
+			ClientCAFile:      c.TLS.ClientCA,
+			RequireClientCert: c.TLS.RequireClientCert,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		server.TLSConfig = config
+	}
+	if c.Tokens.Key != "" {
+		key, err := token.LoadPrivateKey(c.Tokens.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tokens.key: %w", err)
+		}
+		server.Tokens = token.NewSigner(key)
+		server.Tokens.TTL = c.Tokens.TTL
+		server.Tokens.Issuer = c.Tokens.Issuer
+		server.SessionTTL = c.Tokens.SessionTTL
+	}
+	return server, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
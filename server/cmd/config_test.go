@@ -0,0 +1,155 @@
+package cmd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/server/cmd"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	expected := cmd.DefaultConfig()
+	expected.Listen = []string{"127.0.0.1:8080", "unix:///run/zkp.sock"}
+	expected.GRPCPort = "9090"
+	expected.HTTPPort = "8081"
+	expected.TLS = cmd.TLSConfig{Cert: "server.pem", Key: "server-key.pem"}
+	expected.Timeouts = app.Timeouts{Request: 30 * time.Second, Answer: 5 * time.Second, Write: 2 * time.Second}
+	expected.Log.Level = "debug"
+	expected.Tokens = cmd.TokensConfig{Key: "token.pem", TTL: 15 * time.Minute, Issuer: "zkp", SessionTTL: 24 * time.Hour}
+	expected.Connections.Max = 100
+	expected.Connections.QueueTimeout = time.Second
+	expected.RateLimits.PerIP = app.RateLimit{Rate: 2, Burst: 5}
+	expected.RateLimits.PerUser = app.RateLimit{Rate: 0.5, Burst: 3}
+	expected.Lockout.FreeAttempts = 5
+	expected.Lockout.LockDuration = time.Hour
+	expected.Admins = []string{"root"}
+
+	for _, path := range []string{"testdata/server.yaml", "testdata/server.toml"} {
+		t.Run(path, func(t *testing.T) {
+			config, err := cmd.LoadConfig(viper.New(), path)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, config)
+		})
+	}
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	config, err := cmd.LoadConfig(viper.New(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "8080", config.Port)
+	assert.Empty(t, config.Listen)
+	assert.Equal(t, app.DefaultTimeouts, config.Timeouts)
+	assert.Equal(t, cmd.StorageMemory, config.Storage.Backend)
+}
+
+func TestLoadConfig_Environment(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("ZKP_PORT", "9000")
+	t.Setenv("ZKP_LOG_LEVEL", "error")
+	t.Setenv("ZKP_TOKENS_SESSION_TTL", "1h")
+	t.Setenv("ZKP_RATE_LIMITS_GLOBAL_RATE", "0")
+	config, err := cmd.LoadConfig(viper.New(), "testdata/server.yaml")
+	assert.NoError(err)
+	assert.Equal("9000", config.Port)
+	assert.Equal("error", config.Log.Level)
+	assert.Equal(time.Hour, config.Tokens.SessionTTL)
+	assert.Equal(0.0, config.RateLimits.Global.Rate)
+	// the other keys come from the file
+	assert.Equal("9090", config.GRPCPort)
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	for _, path := range []string{"testdata/unknown.yaml", "testdata/missing.yaml"} {
+		_, err := cmd.LoadConfig(viper.New(), path)
+		assert.ErrorIs(t, err, cmd.InvalidConfigError, path)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		change func(c *cmd.Config)
+		key    string
+	}{
+		"listen":           {func(c *cmd.Config) { c.Listen = []string{"unix://"} }, "listen:"},
+		"no port":          {func(c *cmd.Config) { c.Port = "" }, "port:"},
+		"grpc port":        {func(c *cmd.Config) { c.GRPCPort = "1:2:3" }, "grpc-port:"},
+		"tls key":          {func(c *cmd.Config) { c.TLS.Cert = "server.pem" }, "tls:"},
+		"tls client ca":    {func(c *cmd.Config) { c.TLS.ClientCA = "ca.pem" }, "tls:"},
+		"tls require":      {func(c *cmd.Config) { c.TLS.Cert, c.TLS.Key, c.TLS.RequireClientCert = "a", "b", true }, "tls.require-client-cert:"},
+		"no groups":        {func(c *cmd.Config) { c.Groups = nil }, "groups:"},
+		"unknown group":    {func(c *cmd.Config) { c.Groups = []string{"p256"} }, "groups:"},
+		"groups file":      {func(c *cmd.Config) { c.GroupsFile = "groups.yaml" }, "groups-file:"},
+		"storage":          {func(c *cmd.Config) { c.Storage.Backend = "postgres" }, "storage.backend:"},
+		"storage dsn":      {func(c *cmd.Config) { c.Storage.DSN = "postgres://localhost" }, "storage.dsn:"},
+		"negative timeout": {func(c *cmd.Config) { c.Timeouts.Answer = -time.Second }, "timeouts.answer:"},
+		"log level":        {func(c *cmd.Config) { c.Log.Level = "verbose" }, "log.level:"},
+		"token ttl":        {func(c *cmd.Config) { c.Tokens.TTL = 0 }, "tokens.ttl:"},
+		"session ttl":      {func(c *cmd.Config) { c.Tokens.SessionTTL = 0 }, "tokens.session-ttl:"},
+		"shutdown timeout": {func(c *cmd.Config) { c.ShutdownTimeout = -time.Second }, "shutdown-timeout:"},
+		"max connections":  {func(c *cmd.Config) { c.Connections.Max = -1 }, "connections.max:"},
+		"queue timeout":    {func(c *cmd.Config) { c.Connections.QueueTimeout = -time.Second }, "connections.queue-timeout:"},
+		"negative rate":    {func(c *cmd.Config) { c.RateLimits.Global.Rate = -1 }, "rate-limits.global.rate:"},
+		"no burst":         {func(c *cmd.Config) { c.RateLimits.PerUser.Burst = 0 }, "rate-limits.per-user.burst:"},
+		"negative delay":   {func(c *cmd.Config) { c.Lockout.Delay = -time.Second }, "lockout.delay:"},
+		"no lock duration": {func(c *cmd.Config) { c.Lockout.LockDuration = 0 }, "lockout.lock-duration:"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := cmd.DefaultConfig()
+			test.change(config)
+			err := config.Validate()
+			assert.ErrorIs(t, err, cmd.InvalidConfigError)
+			assert.Contains(t, err.Error(), test.key)
+		})
+	}
+	assert.NoError(t, cmd.DefaultConfig().Validate())
+
+	// all problems are reported
+	config := cmd.DefaultConfig()
+	config.Log.Level = "verbose"
+	config.Storage.Backend = "postgres"
+	err := config.Validate()
+	assert.Contains(t, err.Error(), "log.level:")
+	assert.Contains(t, err.Error(), "storage.backend:")
+}
+
+func TestNewServer(t *testing.T) {
+	assert := assert.New(t)
+	config := cmd.DefaultConfig()
+	config.Log.Level = "error"
+	config.Tokens.Key = "../../token/testdata/ed25519.pem"
+	config.Tokens.Issuer = "zkp"
+	config.Admins = []string{"root"}
+	server, err := cmd.NewServer(config)
+	assert.NoError(err)
+	assert.Equal(app.LogError, server.LogLevel)
+	assert.Equal("zkp", server.Tokens.Issuer)
+	assert.Equal(config.Tokens.SessionTTL, server.SessionTTL)
+	assert.Equal(app.DefaultRateLimits, server.RateLimits)
+	assert.Equal(app.DefaultLockout, server.Lockout)
+	assert.Equal([]zkp.UUID{"root"}, server.Admins)
+	assert.Equal(app.DefaultConnectionLimits, server.Connections)
+
+	config.Tokens.Key = "missing.pem"
+	_, err = cmd.NewServer(config)
+	assert.ErrorContains(err, "tokens.key")
+	config.Tokens.Key = ""
+	config.TLS = cmd.TLSConfig{Cert: "missing.pem", Key: "missing-key.pem"}
+	_, err = cmd.NewServer(config)
+	assert.ErrorContains(err, "tls")
+	config.TLS = cmd.TLSConfig{}
+
+	config.FakeUserKey = "testdata/fake-user.key"
+	config.ReportUserExists = true
+	server, err = cmd.NewServer(config)
+	assert.NoError(err)
+	assert.Len(server.FakeUserKey, 32)
+	assert.True(server.ReportUserExists)
+	config.FakeUserKey = "testdata/server.toml.missing"
+	_, err = cmd.NewServer(config)
+	assert.ErrorContains(err, "fake-user-key")
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mindaugasrukas/zkp_example/capture"
+	"github.com/mindaugasrukas/zkp_example/server/app"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	rootCmd = &cobra.Command{
+		Use:   "server",
+		Short: "ZKP authentication server",
+		Long: `ZKP authentication server
+
+The configuration is read from the config file (--config, YAML or TOML),
+the ZKP_ environment variables (e.g. ZKP_PORT, ZKP_TLS_CERT for tls.cert) and the flags,
+the flags have the highest priority. The configuration is validated before listening.`,
+		Args: cobra.NoArgs,
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := LoadConfig(viper.GetViper(), cmd.Flag("config").Value.String())
+			if err != nil {
+				return err
+			}
+			return run(cmd.Context(), config)
+		},
+	}
+
+	// flagKeys maps the flags to the config keys
+	flagKeys = map[string]string{
+		"listen":                  "listen",
+		"port":                    "port",
+		"grpc-port":               "grpc-port",
+		"http-port":               "http-port",
+		"ws-port":                 "ws-port",
+		"tls-cert":                "tls.cert",
+		"tls-key":                 "tls.key",
+		"tls-client-ca":           "tls.client-ca",
+		"tls-require-client-cert": "tls.require-client-cert",
+		"groups":                  "groups",
+		"groups-file":             "groups-file",
+		"storage":                 "storage.backend",
+		"storage-dsn":             "storage.dsn",
+		"request-timeout":         "timeouts.request",
+		"answer-timeout":          "timeouts.answer",
+		"write-timeout":           "timeouts.write",
+		"log-level":               "log.level",
+		"token-key":               "tokens.key",
+		"token-ttl":               "tokens.ttl",
+		"token-issuer":            "tokens.issuer",
+		"session-ttl":             "tokens.session-ttl",
+		"max-connections":         "connections.max",
+		"connection-queue":        "connections.queue",
+		"queue-timeout":           "connections.queue-timeout",
+		"ip-connections":          "connections.per-ip",
+		"ip-rate":                 "rate-limits.per-ip.rate",
+		"ip-burst":                "rate-limits.per-ip.burst",
+		"user-rate":               "rate-limits.per-user.rate",
+		"user-burst":              "rate-limits.per-user.burst",
+		"global-rate":             "rate-limits.global.rate",
+		"global-burst":            "rate-limits.global.burst",
+		"lockout-free-attempts":   "lockout.free-attempts",
+		"lockout-delay":           "lockout.delay",
+		"lockout-max-delay":       "lockout.max-delay",
+		"lockout-attempts":        "lockout.lock-attempts",
+		"lockout-duration":        "lockout.lock-duration",
+		"admins":                  "admins",
+		"fake-user-key":           "fake-user-key",
+		"report-user-exists":      "report-user-exists",
+		"record":                  "record",
+		"shutdown-timeout":        "shutdown-timeout",
+	}
+)
+
+func init() {
+	d := DefaultConfig()
+	flags := rootCmd.Flags()
+	flags.StringP("config", "c", os.Getenv(EnvPrefix+"_CONFIG"), "config file, YAML or TOML (env: ZKP_CONFIG)")
+
+	flags.StringArray("listen", d.Listen, "listen address, repeatable: host:port, [::1]:port, unix:///path or fd://N")
+	flags.String("port", d.Port, "listen port, used without --listen addresses and inherited listeners")
+	flags.String("grpc-port", d.GRPCPort, "gRPC listen port, disabled if empty")
+	flags.String("http-port", d.HTTPPort, "HTTP/JSON API listen port, disabled if empty")
+	flags.String("ws-port", d.WSPort, "WebSocket listen port, disabled if empty")
+
+	flags.String("tls-cert", d.TLS.Cert, "TLS certificate file, enables TLS")
+	flags.String("tls-key", d.TLS.Key, "TLS private key file")
+	flags.String("tls-client-ca", d.TLS.ClientCA, "CA file to verify client certificates")
+	flags.Bool("tls-require-client-cert", d.TLS.RequireClientCert, "reject clients without a valid certificate")
+
+	flags.StringSlice("groups", d.Groups, "groups offered in the protocol negotiation in the order of preference")
+	flags.String("groups-file", d.GroupsFile, "custom group parameters file, not supported yet")
+	flags.String("storage", d.Storage.Backend, "user storage backend: memory")
+	flags.String("storage-dsn", d.Storage.DSN, "data source name of the database storage backends, none supported yet")
+
+	flags.Duration("request-timeout", d.Timeouts.Request, "time to receive the next request, 0 - no timeout")
+	flags.Duration("answer-timeout", d.Timeouts.Answer, "time to answer the challenge, 0 - no timeout")
+	flags.Duration("write-timeout", d.Timeouts.Write, "time to send a response, 0 - no timeout")
+	flags.String("log-level", d.Log.Level, "log level: debug, info or error")
+
+	flags.String("token-key", d.Tokens.Key, "Ed25519 private key file signing the session tokens, no tokens if empty")
+	flags.Duration("token-ttl", d.Tokens.TTL, "session token lifetime")
+	flags.String("token-issuer", d.Tokens.Issuer, "issuer set in the session tokens")
+	flags.Duration("session-ttl", d.Tokens.SessionTTL, "session lifetime, the token is refreshed until the session ends")
+	flags.Int("max-connections", d.Connections.Max, "connections of all transports served at once, 0 - no limit")
+	flags.Int("connection-queue", d.Connections.Queue, "connections waiting for a free worker, the next ones are rejected")
+	flags.Duration("queue-timeout", d.Connections.QueueTimeout, "time a connection waits for a free worker, 0 - no timeout")
+	flags.Int("ip-connections", d.Connections.PerIP, "connections served and queued from a client address, 0 - no limit")
+	flags.Float64("ip-rate", d.RateLimits.PerIP.Rate, "registrations and authentications per second from a client address, 0 - no limit")
+	flags.Int("ip-burst", d.RateLimits.PerIP.Burst, "requests allowed at once from a client address")
+	flags.Float64("user-rate", d.RateLimits.PerUser.Rate, "registrations and authentications per second for a user, 0 - no limit")
+	flags.Int("user-burst", d.RateLimits.PerUser.Burst, "requests allowed at once for a user")
+	flags.Float64("global-rate", d.RateLimits.Global.Rate, "registrations and authentications per second in total, 0 - no limit")
+	flags.Int("global-burst", d.RateLimits.Global.Burst, "requests allowed at once in total")
+	flags.Int("lockout-free-attempts", d.Lockout.FreeAttempts, "failed logins of a user allowed without the delay")
+	flags.Duration("lockout-delay", d.Lockout.Delay, "delay after the free attempts, doubled by each failed login, 0 - no delay")
+	flags.Duration("lockout-max-delay", d.Lockout.MaxDelay, "longest delay after the failed logins")
+	flags.Int("lockout-attempts", d.Lockout.LockAttempts, "failed logins locking the user, 0 - never locked")
+	flags.Duration("lockout-duration", d.Lockout.LockDuration, "time the user is locked for")
+	flags.StringSlice("admins", d.Admins, "users allowed to run the admin commands: unlock and stats")
+	flags.String("fake-user-key", d.FakeUserKey, "secret file deriving the commits of the unknown users, random if empty")
+	flags.Bool("report-user-exists", d.ReportUserExists, "tell the registration the user name is taken, revealing the users")
+	flags.String("record", d.Record, "record the TCP and WebSocket protocol frames to the file")
+	flags.Duration("shutdown-timeout", d.ShutdownTimeout, "time to finish the exchanges in progress on SIGINT or SIGTERM, 0 - no timeout")
+
+	for flag, key := range flagKeys {
+		viper.BindPFlag(key, flags.Lookup(flag))
+	}
+}
+
+// run serves the configured listeners until the context is cancelled
+func run(ctx context.Context, config *Config) error {
+	server, err := NewServer(config)
+	if err != nil {
+		return err
+	}
+	if server.LogLevel > app.LogDebug {
+		// the protocol values are logged at the debug level only
+		zkp.SetLogger(log.New(ioutil.Discard, "", 0))
+	}
+	if config.Record != "" {
+		f, err := os.Create(config.Record)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		server.Recorder = capture.NewRecorder(f)
+	}
+
+	// systemd socket activation
+	listeners, err := app.SystemdListeners()
+	if err != nil {
+		return err
+	}
+	for _, address := range config.Listen {
+		l, err := app.Listen(address)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		l, err := app.Listen(config.Port)
+		if err != nil {
+			return err
+		}
+		listeners = []net.Listener{l}
+	}
+
+	// serve until the context is done or any transport fails, then drain the connections
+	serveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 4)
+	serving := 0
+	serve := func(run func() error) {
+		serving++
+		go func() {
+			errs <- run()
+		}()
+	}
+	serve(func() error {
+		return server.ServeListeners(serveCtx, listeners...)
+	})
+	transports := []struct {
+		port string
+		run  func(context.Context, string) error
+	}{
+		{config.GRPCPort, server.RunGRPCContext},
+		{config.HTTPPort, server.RunRESTContext},
+		{config.WSPort, server.RunWebSocketContext},
+	}
+	for _, transport := range transports {
+		if transport.port == "" {
+			continue
+		}
+		port, runTransport := transport.port, transport.run
+		serve(func() error {
+			return runTransport(serveCtx, port)
+		})
+	}
+
+	var firstErr error
+	select {
+	case <-ctx.Done():
+	case firstErr = <-errs:
+		serving--
+	}
+	shutdownCtx, cancelShutdown := app.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("shutdown: %w", err)
+	}
+	// close what is left
+	cancel()
+	for ; serving > 0; serving-- {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func Execute() {
+	// shut the server down on interrupt, the next interrupt kills it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
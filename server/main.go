@@ -1,9 +1,7 @@
 package main
 
-import "github.com/mindaugasrukas/zkp_example/server/app"
+import "github.com/mindaugasrukas/zkp_example/server/cmd"
 
 func main() {
-	server := app.NewServer()
-	// todo: get server port from ENV
-	server.Run("8080")
+	cmd.Execute()
 }
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/mindaugasrukas/zkp_example/zkp"
@@ -8,7 +9,10 @@ import (
 )
 
 // GetAuthentication translates request commits to internal types
-func GetAuthentication(authRequest *zkp_pb.AuthRequest) (user zkp.UUID, commits *zkp.Commits) {
+func GetAuthentication(authRequest *zkp_pb.AuthRequest) (user zkp.UUID, commits *zkp.Commits, err error) {
+	if len(authRequest.GetCommits()) == 0 {
+		return "", nil, fmt.Errorf("%w %q", MissingFieldError, "commits")
+	}
 	var r1, r2 big.Int
 	c := authRequest.GetCommits()[0]
 
@@ -19,7 +23,7 @@ func GetAuthentication(authRequest *zkp_pb.AuthRequest) (user zkp.UUID, commits
 	return user, &zkp.Commits{
 		C1: &r1,
 		C2: &r2,
-	}
+	}, nil
 }
 
 // GetAnswer translates request to internal type
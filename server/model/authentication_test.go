@@ -1,7 +1,9 @@
 package model_test
 
 import (
+	"io/ioutil"
 	"math/big"
+	"path/filepath"
 	"testing"
 
 	"github.com/mindaugasrukas/zkp_example/server/model"
@@ -21,7 +23,8 @@ func TestGetAuthentication(t *testing.T) {
 			},
 		},
 	}
-	user, commits := model.GetAuthentication(authRequest)
+	user, commits, err := model.GetAuthentication(authRequest)
+	assert.NoError(err)
 	assert.Equal(zkp.UUID("test-user"), user)
 	expectedCommits := &zkp.Commits{
 		C1: big.NewInt(12),
@@ -30,6 +33,13 @@ func TestGetAuthentication(t *testing.T) {
 	assert.Equal(expectedCommits, commits)
 }
 
+func TestGetAuthentication_MissingCommits(t *testing.T) {
+	assert := assert.New(t)
+	_, commits, err := model.GetAuthentication(&zkp_pb.AuthRequest{User: "test-user"})
+	assert.ErrorIs(err, model.MissingFieldError)
+	assert.Nil(commits)
+}
+
 func TestGetAnswer(t *testing.T) {
 	assert := assert.New(t)
 	answerRequest := &zkp_pb.AnswerRequest{
@@ -38,3 +48,40 @@ func TestGetAnswer(t *testing.T) {
 	answer := model.GetAnswer(answerRequest)
 	assert.Equal(big.NewInt(13), answer)
 }
+
+// addTestPackets seeds the fuzz target with the envelopes of the zkp test packets
+func addTestPackets(f *testing.F) {
+	files, err := filepath.Glob("../../zkp/testdata/*.bin")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data[zkp.FrameHeaderSize:])
+	}
+}
+
+func FuzzGetAuthentication(f *testing.F) {
+	addTestPackets(f)
+
+	f.Fuzz(func(t *testing.T, envelope []byte) {
+		msg, err := zkp.DefaultCodec.Decode(envelope)
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *zkp_pb.AuthRequest:
+			_, commits, err := model.GetAuthentication(msg)
+			if err == nil && (commits == nil || commits.C1 == nil || commits.C2 == nil) {
+				t.Fatalf("incomplete commits %v", commits)
+			}
+		case *zkp_pb.AnswerRequest:
+			if answer := model.GetAnswer(msg); answer == nil || answer.Sign() < 0 {
+				t.Fatalf("invalid answer %v", answer)
+			}
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/mindaugasrukas/zkp_example/zkp"
@@ -8,16 +9,33 @@ import (
 )
 
 // GetRegistration translates request commits to internal types
-func GetRegistration(registerRequest *zkp_pb.RegisterRequest) (user zkp.UUID, commits *zkp.Commits) {
+func GetRegistration(registerRequest *zkp_pb.RegisterRequest) (user zkp.UUID, commits *zkp.Commits, err error) {
+	commits, err = getRegisterCommits(registerRequest.GetCommits())
+	if err != nil {
+		return "", nil, err
+	}
+	user = zkp.UUID(registerRequest.GetUser())
+	return user, commits, nil
+}
+
+// GetChangePassword translates the new password commits to internal types
+func GetChangePassword(changePasswordRequest *zkp_pb.ChangePasswordRequest) (*zkp.Commits, error) {
+	return getRegisterCommits(changePasswordRequest.GetCommits())
+}
+
+// getRegisterCommits translates the first registration commits
+func getRegisterCommits(commits []*zkp_pb.RegisterRequest_Commits) (*zkp.Commits, error) {
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("%w %q", MissingFieldError, "commits")
+	}
 	var y1, y2 big.Int
-	c := registerRequest.GetCommits()[0]
+	c := commits[0]
 
 	y1.SetBytes(c.GetY1())
 	y2.SetBytes(c.GetY2())
 
-	user = zkp.UUID(registerRequest.GetUser())
-	return user, &zkp.Commits{
+	return &zkp.Commits{
 		C1: &y1,
 		C2: &y2,
-	}
+	}, nil
 }
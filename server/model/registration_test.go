@@ -21,7 +21,8 @@ func TestGetRegistration(t *testing.T) {
 			},
 		},
 	}
-	user, commits := model.GetRegistration(registerRequest)
+	user, commits, err := model.GetRegistration(registerRequest)
+	assert.NoError(err)
 	assert.Equal(zkp.UUID("test-user"), user)
 	expectedCommits := &zkp.Commits{
 		C1: big.NewInt(12),
@@ -29,3 +30,48 @@ func TestGetRegistration(t *testing.T) {
 	}
 	assert.Equal(expectedCommits, commits)
 }
+
+func TestGetRegistration_MissingCommits(t *testing.T) {
+	assert := assert.New(t)
+	_, commits, err := model.GetRegistration(&zkp_pb.RegisterRequest{User: "test-user"})
+	assert.ErrorIs(err, model.MissingFieldError)
+	assert.Nil(commits)
+}
+
+func TestGetChangePassword(t *testing.T) {
+	assert := assert.New(t)
+	commits, err := model.GetChangePassword(&zkp_pb.ChangePasswordRequest{
+		Commits: []*zkp_pb.RegisterRequest_Commits{
+			{
+				Y1: []byte{0xc},
+				Y2: []byte{0xd},
+			},
+		},
+	})
+	assert.NoError(err)
+	expectedCommits := &zkp.Commits{
+		C1: big.NewInt(12),
+		C2: big.NewInt(13),
+	}
+	assert.Equal(expectedCommits, commits)
+
+	_, err = model.GetChangePassword(&zkp_pb.ChangePasswordRequest{})
+	assert.ErrorIs(err, model.MissingFieldError)
+}
+
+func FuzzGetRegistration(f *testing.F) {
+	addTestPackets(f)
+
+	f.Fuzz(func(t *testing.T, envelope []byte) {
+		msg, err := zkp.DefaultCodec.Decode(envelope)
+		if err != nil {
+			return
+		}
+		if registerRequest, ok := msg.(*zkp_pb.RegisterRequest); ok {
+			_, commits, err := model.GetRegistration(registerRequest)
+			if err == nil && (commits == nil || commits.C1 == nil || commits.C2 == nil) {
+				t.Fatalf("incomplete commits %v", commits)
+			}
+		}
+	})
+}
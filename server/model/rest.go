@@ -0,0 +1,120 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+)
+
+var (
+	InvalidNumberError = errors.New("invalid number")
+	MissingFieldError  = errors.New("missing field")
+)
+
+type (
+	// RESTRegisterRequest is the JSON registration request
+	RESTRegisterRequest struct {
+		User string `json:"user"`
+		Y1   string `json:"y1"`
+		Y2   string `json:"y2"`
+	}
+
+	// RESTAuthStartRequest is the JSON request starting the authentication
+	RESTAuthStartRequest struct {
+		User string `json:"user"`
+		R1   string `json:"r1"`
+		R2   string `json:"r2"`
+	}
+
+	// RESTAuthStartResponse returns the challenge for the started authentication
+	RESTAuthStartResponse struct {
+		AuthID    string `json:"auth_id"`
+		Challenge string `json:"challenge"`
+	}
+
+	// RESTAuthFinishRequest is the JSON request answering the challenge
+	RESTAuthFinishRequest struct {
+		AuthID string `json:"auth_id"`
+		Answer string `json:"answer"`
+	}
+
+	// RESTResult is the JSON result of the registration or authentication
+	// Code is the zkp_pb.ErrorCode name, RetryAfter is in seconds.
+	// The successful authentication carries the session token if the server issues tokens.
+	RESTResult struct {
+		Result     bool   `json:"result"`
+		Error      string `json:"error,omitempty"`
+		Code       string `json:"code,omitempty"`
+		RetryAfter uint32 `json:"retry_after,omitempty"`
+		Detail     string `json:"detail,omitempty"`
+		Token      string `json:"token,omitempty"`
+		ExpiresAt  int64  `json:"expires_at,omitempty"`
+		SessionID  string `json:"session_id,omitempty"`
+		// RefreshToken is exchanged for a new token over the TCP or WebSocket protocol
+		RefreshToken string `json:"refresh_token,omitempty"`
+	}
+)
+
+// EncodeNumber encodes the big integer as a hex string
+func EncodeNumber(n *big.Int) string {
+	return n.Text(16)
+}
+
+// DecodeNumber decodes the non-negative hex string into the big integer
+// field names the JSON field for the error message.
+func DecodeNumber(field, s string) (*big.Int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("%w %q", MissingFieldError, field)
+	}
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("%w %q", InvalidNumberError, field)
+	}
+	return n, nil
+}
+
+// GetRESTRegistration translates JSON registration request to internal types
+func GetRESTRegistration(request *RESTRegisterRequest) (user zkp.UUID, commits *zkp.Commits, err error) {
+	if request.User == "" {
+		return "", nil, fmt.Errorf("%w %q", MissingFieldError, "user")
+	}
+	y1, err := DecodeNumber("y1", request.Y1)
+	if err != nil {
+		return "", nil, err
+	}
+	y2, err := DecodeNumber("y2", request.Y2)
+	if err != nil {
+		return "", nil, err
+	}
+	return zkp.UUID(request.User), &zkp.Commits{C1: y1, C2: y2}, nil
+}
+
+// GetRESTAuthentication translates JSON authentication request to internal types
+func GetRESTAuthentication(request *RESTAuthStartRequest) (user zkp.UUID, commits *zkp.Commits, err error) {
+	if request.User == "" {
+		return "", nil, fmt.Errorf("%w %q", MissingFieldError, "user")
+	}
+	r1, err := DecodeNumber("r1", request.R1)
+	if err != nil {
+		return "", nil, err
+	}
+	r2, err := DecodeNumber("r2", request.R2)
+	if err != nil {
+		return "", nil, err
+	}
+	return zkp.UUID(request.User), &zkp.Commits{C1: r1, C2: r2}, nil
+}
+
+// GetRESTAnswer translates JSON answer request to internal type
+func GetRESTAnswer(request *RESTAuthFinishRequest) (authID string, answer *big.Int, err error) {
+	if request.AuthID == "" {
+		return "", nil, fmt.Errorf("%w %q", MissingFieldError, "auth_id")
+	}
+	answer, err = DecodeNumber("answer", request.Answer)
+	if err != nil {
+		return "", nil, err
+	}
+	return request.AuthID, answer, nil
+}
@@ -0,0 +1,124 @@
+package model_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/server/model"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]struct {
+		input         string
+		expected      *big.Int
+		expectedError error
+	}{
+		"hex": {
+			input:    "1f",
+			expected: big.NewInt(31),
+		},
+		"zero": {
+			input:    "0",
+			expected: big.NewInt(0),
+		},
+		"empty": {
+			input:         "",
+			expectedError: model.MissingFieldError,
+		},
+		"negative": {
+			input:         "-1",
+			expectedError: model.InvalidNumberError,
+		},
+		"not hex": {
+			input:         "xyz",
+			expectedError: model.InvalidNumberError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			n, err := model.DecodeNumber("test", test.input)
+			if test.expectedError != nil {
+				assert.ErrorIs(err, test.expectedError)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(0, test.expected.Cmp(n))
+		})
+	}
+}
+
+func TestEncodeNumber(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("1f", model.EncodeNumber(big.NewInt(31)))
+	assert.Equal("0", model.EncodeNumber(big.NewInt(0)))
+}
+
+func TestGetRESTRegistration(t *testing.T) {
+	assert := assert.New(t)
+	user, commits, err := model.GetRESTRegistration(&model.RESTRegisterRequest{
+		User: "test-user",
+		Y1:   "c",
+		Y2:   "d",
+	})
+	assert.NoError(err)
+	assert.Equal(zkp.UUID("test-user"), user)
+	assert.Equal(&zkp.Commits{C1: big.NewInt(12), C2: big.NewInt(13)}, commits)
+
+	_, _, err = model.GetRESTRegistration(&model.RESTRegisterRequest{Y1: "c", Y2: "d"})
+	assert.ErrorIs(err, model.MissingFieldError)
+}
+
+func TestGetRESTAuthentication(t *testing.T) {
+	assert := assert.New(t)
+	user, commits, err := model.GetRESTAuthentication(&model.RESTAuthStartRequest{
+		User: "test-user",
+		R1:   "c",
+		R2:   "d",
+	})
+	assert.NoError(err)
+	assert.Equal(zkp.UUID("test-user"), user)
+	assert.Equal(&zkp.Commits{C1: big.NewInt(12), C2: big.NewInt(13)}, commits)
+
+	_, _, err = model.GetRESTAuthentication(&model.RESTAuthStartRequest{User: "test-user", R1: "c"})
+	assert.ErrorIs(err, model.MissingFieldError)
+}
+
+func TestGetRESTAnswer(t *testing.T) {
+	assert := assert.New(t)
+	authID, answer, err := model.GetRESTAnswer(&model.RESTAuthFinishRequest{
+		AuthID: "abc",
+		Answer: "d",
+	})
+	assert.NoError(err)
+	assert.Equal("abc", authID)
+	assert.Equal(big.NewInt(13), answer)
+
+	_, _, err = model.GetRESTAnswer(&model.RESTAuthFinishRequest{Answer: "d"})
+	assert.ErrorIs(err, model.MissingFieldError)
+}
+
+func FuzzDecodeNumber(f *testing.F) {
+	f.Add("10")
+	f.Add("-1")
+	f.Add("0x1f")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		n, err := model.DecodeNumber("field", s)
+		if err != nil {
+			return
+		}
+		if n.Sign() < 0 {
+			t.Fatalf("decoded negative number %v", n)
+		}
+		decoded, err := model.DecodeNumber("field", model.EncodeNumber(n))
+		if err != nil || decoded.Cmp(n) != 0 {
+			t.Fatalf("round trip of %v: got %v, %v", n, decoded, err)
+		}
+	})
+}
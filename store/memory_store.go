@@ -1,32 +1,91 @@
 package store
 
 import (
+	"crypto/subtle"
 	"errors"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/mindaugasrukas/zkp_example/zkp"
 )
 
+// pruneInterval is the period dropping the expired failures and revocations
+const pruneInterval = time.Minute
+
+// MaxFailures caps the failure records, the failures of the unknown user names can't grow the store without bound
+// When the store is full, the expired records are dropped to make room, AddFailure refuses the new user names if none is.
+// No record is evicted, so the lockout of the user can't be flushed by failing the logins of other names.
+const MaxFailures = 100000
+
 var (
-	UserExistsError       = errors.New("user already exists")
-	UserDoesNotExistError = errors.New("user doesn't exist")
+	UserExistsError          = errors.New("user already exists")
+	UserDoesNotExistError    = errors.New("user doesn't exist")
+	SessionExistsError       = errors.New("session already exists")
+	SessionDoesNotExistError = errors.New("session doesn't exist")
+	SessionChangedError      = errors.New("session changed")
+	FailuresFullError        = errors.New("too many users with failed logins")
 )
 
 type (
+	// InMemoryStore is safe for the concurrent use
 	InMemoryStore struct {
-		store map[zkp.UUID]*zkp.Commits
+		mu       *sync.RWMutex
+		store    map[zkp.UUID]*zkp.Commits
+		sessions map[string]*Session
+		// revoked session ids and the time their tokens expire at
+		revoked map[string]time.Time
+		// failed logins by user name, including the unknown ones
+		failures map[zkp.UUID]*Failures
+		// the times the expired records were dropped at
+		pruned *pruneTimes
+	}
+
+	// pruneTimes are the times the expired records were last dropped at
+	pruneTimes struct {
+		failures time.Time
+		revoked  time.Time
+	}
+
+	// Session is the record of the session issued to the authenticated user
+	Session struct {
+		ID          string
+		User        zkp.UUID
+		AuthMethods []string
+		IssuedAt    time.Time
+		// ExpiresAt ends the session, the refresh token is rejected after
+		ExpiresAt time.Time
+		// RefreshHash is the hash of the refresh token secret, replaced on each refresh
+		RefreshHash []byte
+	}
+
+	// Failures are the consecutive failed logins of the user
+	Failures struct {
+		Count int
+		// Last is the time of the last failure
+		Last time.Time
+		// Expires is the time the failures are forgotten at
+		Expires time.Time
 	}
 )
 
 // NewInMemoryStore returns a new store instance
 func NewInMemoryStore() InMemoryStore {
 	return InMemoryStore{
-		store: make(map[zkp.UUID]*zkp.Commits),
+		mu:       &sync.RWMutex{},
+		store:    make(map[zkp.UUID]*zkp.Commits),
+		sessions: make(map[string]*Session),
+		revoked:  make(map[string]time.Time),
+		failures: make(map[zkp.UUID]*Failures),
+		pruned:   &pruneTimes{},
 	}
 }
 
 // Add user to the store
 // returns UserExistsError if user already exists
 func (m InMemoryStore) Add(user zkp.UUID, commits *zkp.Commits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if _, ok := m.store[user]; ok {
 		return UserExistsError
 	}
@@ -37,9 +96,195 @@ func (m InMemoryStore) Add(user zkp.UUID, commits *zkp.Commits) error {
 // Get user data from the store
 // returns UserDoesNotExistError if user doesn't exist
 func (m InMemoryStore) Get(user zkp.UUID) (*zkp.Commits, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	data, ok := m.store[user]
 	if !ok {
 		return nil, UserDoesNotExistError
 	}
 	return data, nil
 }
+
+// Update replaces the user data in the store
+// returns UserDoesNotExistError if user doesn't exist
+func (m InMemoryStore) Update(user zkp.UUID, commits *zkp.Commits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.store[user]; !ok {
+		return UserDoesNotExistError
+	}
+	m.store[user] = commits
+	return nil
+}
+
+// AddSession adds the new session to the store
+// returns SessionExistsError if the session id is taken
+func (m InMemoryStore) AddSession(session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[session.ID]; ok {
+		return SessionExistsError
+	}
+	stored := *session
+	m.sessions[session.ID] = &stored
+	return nil
+}
+
+// GetSession returns the session by id
+// returns SessionDoesNotExistError if the session doesn't exist, has expired or was revoked
+func (m InMemoryStore) GetSession(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return nil, SessionDoesNotExistError
+	}
+	found := *session
+	return &found, nil
+}
+
+// UpdateSession replaces the session in the store
+// returns SessionDoesNotExistError if the session doesn't exist
+func (m InMemoryStore) UpdateSession(session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[session.ID]; !ok {
+		return SessionDoesNotExistError
+	}
+	stored := *session
+	m.sessions[session.ID] = &stored
+	return nil
+}
+
+// RotateSession replaces the session if its refresh hash is still oldHash
+// returns SessionDoesNotExistError if the session doesn't exist or has expired
+// and SessionChangedError if the refresh hash was replaced since it was read.
+func (m InMemoryStore) RotateSession(id string, oldHash []byte, session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.sessions[id]
+	if !ok || !time.Now().Before(stored.ExpiresAt) {
+		return SessionDoesNotExistError
+	}
+	if subtle.ConstantTimeCompare(stored.RefreshHash, oldHash) != 1 {
+		return SessionChangedError
+	}
+	rotated := *session
+	m.sessions[id] = &rotated
+	return nil
+}
+
+// Sessions returns the active sessions of the user, the oldest first
+func (m InMemoryStore) Sessions(user zkp.UUID) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var sessions []*Session
+	for id, session := range m.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(m.sessions, id)
+			continue
+		}
+		if session.User == user {
+			found := *session
+			sessions = append(sessions, &found)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].IssuedAt.Before(sessions[j].IssuedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession removes the session and lists it revoked until the time its tokens expire at
+func (m InMemoryStore) RevokeSession(id string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	m.pruneRevoked(time.Now())
+	m.revoked[id] = until
+	return nil
+}
+
+// pruneRevoked drops the expired revocations, the tokens are rejected as expired
+func (m InMemoryStore) pruneRevoked(now time.Time) {
+	if now.Sub(m.pruned.revoked) < pruneInterval {
+		return
+	}
+	m.pruned.revoked = now
+	for id, until := range m.revoked {
+		if !now.Before(until) {
+			delete(m.revoked, id)
+		}
+	}
+}
+
+// Revoked returns true if the session was revoked and its tokens haven't expired yet
+// It implements token.RevocationList.
+func (m InMemoryStore) Revoked(id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	until, ok := m.revoked[id]
+	return ok && time.Now().Before(until), nil
+}
+
+// Failures returns the failed logins of the user, zero if there are none
+// The user doesn't have to exist.
+func (m InMemoryStore) Failures(user zkp.UUID) (*Failures, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	failures, ok := m.failures[user]
+	if !ok || !time.Now().Before(failures.Expires) {
+		return &Failures{}, nil
+	}
+	found := *failures
+	return &found, nil
+}
+
+// AddFailure counts the failed login of the user at the time, the failures are forgotten at expires
+// Returns the failures including this one, FailuresFullError for a new user name if MaxFailures are counted already.
+func (m InMemoryStore) AddFailure(user zkp.UUID, at, expires time.Time) (*Failures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.pruneFailures(now)
+	failures, ok := m.failures[user]
+	if !ok || !now.Before(failures.Expires) {
+		if !ok && len(m.failures) >= MaxFailures {
+			// drop the expired records now to make room
+			m.pruned.failures = time.Time{}
+			m.pruneFailures(now)
+			if len(m.failures) >= MaxFailures {
+				return nil, FailuresFullError
+			}
+		}
+		failures = &Failures{}
+		m.failures[user] = failures
+	}
+	failures.Count++
+	failures.Last = at
+	failures.Expires = expires
+	found := *failures
+	return &found, nil
+}
+
+// pruneFailures drops the expired failures
+func (m InMemoryStore) pruneFailures(now time.Time) {
+	if now.Sub(m.pruned.failures) < pruneInterval {
+		return
+	}
+	m.pruned.failures = now
+	for name, failures := range m.failures {
+		if !now.Before(failures.Expires) {
+			delete(m.failures, name)
+		}
+	}
+}
+
+// ResetFailures forgets the failed logins of the user
+func (m InMemoryStore) ResetFailures(user zkp.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failures, user)
+	return nil
+}
@@ -1,8 +1,10 @@
 package store_test
 
 import (
+	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/mindaugasrukas/zkp_example/store"
 	"github.com/mindaugasrukas/zkp_example/zkp"
@@ -59,3 +61,175 @@ func TestInMemoryStore_Get(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(commits, data)
 }
+
+func TestInMemoryStore_Update(t *testing.T) {
+	assert := assert.New(t)
+	registry := store.NewInMemoryStore()
+
+	// Fail to update non existing user
+	user := zkp.UUID("userid-123")
+	err := registry.Update(user, &zkp.Commits{
+		C1: big.NewInt(int64(123)),
+		C2: big.NewInt(int64(345)),
+	})
+	assert.ErrorIs(err, store.UserDoesNotExistError)
+
+	// Add a dummy user
+	err = registry.Add(user, &zkp.Commits{
+		C1: big.NewInt(int64(123)),
+		C2: big.NewInt(int64(345)),
+	})
+	assert.NoError(err)
+
+	// Successfully replace the user data
+	commits := &zkp.Commits{
+		C1: big.NewInt(int64(789)),
+		C2: big.NewInt(int64(567)),
+	}
+	err = registry.Update(user, commits)
+	assert.NoError(err)
+	data, err := registry.Get(user)
+	assert.NoError(err)
+	assert.Equal(commits, data)
+}
+
+func TestInMemoryStore_Sessions(t *testing.T) {
+	assert := assert.New(t)
+	registry := store.NewInMemoryStore()
+	now := time.Now()
+	first := &store.Session{ID: "1", User: "alice", IssuedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)}
+	second := &store.Session{ID: "2", User: "alice", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := &store.Session{ID: "3", User: "alice", IssuedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	other := &store.Session{ID: "4", User: "bob", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+	for _, session := range []*store.Session{second, first, expired, other} {
+		assert.NoError(registry.AddSession(session))
+	}
+	assert.ErrorIs(registry.AddSession(first), store.SessionExistsError)
+
+	sessions, err := registry.Sessions("alice")
+	assert.NoError(err)
+	assert.Equal([]*store.Session{first, second}, sessions)
+
+	session, err := registry.GetSession("1")
+	assert.NoError(err)
+	assert.Equal(first, session)
+	_, err = registry.GetSession("3")
+	assert.ErrorIs(err, store.SessionDoesNotExistError)
+
+	// the returned session is a copy
+	session.RefreshHash = []byte{1}
+	found, err := registry.GetSession("1")
+	assert.NoError(err)
+	assert.Nil(found.RefreshHash)
+	assert.NoError(registry.UpdateSession(session))
+	found, err = registry.GetSession("1")
+	assert.NoError(err)
+	assert.Equal([]byte{1}, found.RefreshHash)
+	assert.ErrorIs(registry.UpdateSession(&store.Session{ID: "5"}), store.SessionDoesNotExistError)
+
+	// the rotation replaces the expected refresh hash only
+	rotated := *found
+	rotated.RefreshHash = []byte{2}
+	assert.ErrorIs(registry.RotateSession("1", []byte{3}, &rotated), store.SessionChangedError)
+	assert.NoError(registry.RotateSession("1", []byte{1}, &rotated))
+	assert.ErrorIs(registry.RotateSession("1", []byte{1}, &rotated), store.SessionChangedError)
+	found, err = registry.GetSession("1")
+	assert.NoError(err)
+	assert.Equal([]byte{2}, found.RefreshHash)
+	assert.ErrorIs(registry.RotateSession("3", nil, expired), store.SessionDoesNotExistError)
+}
+
+func TestInMemoryStore_RevokeSession(t *testing.T) {
+	assert := assert.New(t)
+	registry := store.NewInMemoryStore()
+	now := time.Now()
+	assert.NoError(registry.AddSession(&store.Session{ID: "1", User: "alice", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+	revoked, err := registry.Revoked("1")
+	assert.NoError(err)
+	assert.False(revoked)
+
+	assert.NoError(registry.RevokeSession("1", now.Add(time.Hour)))
+	revoked, err = registry.Revoked("1")
+	assert.NoError(err)
+	assert.True(revoked)
+	_, err = registry.GetSession("1")
+	assert.ErrorIs(err, store.SessionDoesNotExistError)
+
+	// the expired revocations are dropped
+	assert.NoError(registry.RevokeSession("2", now.Add(-time.Second)))
+	assert.NoError(registry.RevokeSession("3", now.Add(time.Hour)))
+	revoked, err = registry.Revoked("2")
+	assert.NoError(err)
+	assert.False(revoked)
+}
+
+func TestInMemoryStore_Failures(t *testing.T) {
+	assert := assert.New(t)
+	registry := store.NewInMemoryStore()
+	now := time.Now()
+
+	failures, err := registry.Failures("unknown")
+	assert.NoError(err)
+	assert.Equal(&store.Failures{}, failures)
+
+	// the failures are counted for any user name
+	_, err = registry.AddFailure("unknown", now, now.Add(time.Hour))
+	assert.NoError(err)
+	failures, err = registry.AddFailure("unknown", now.Add(time.Second), now.Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(2, failures.Count)
+	assert.Equal(now.Add(time.Second), failures.Last)
+	failures, err = registry.Failures("unknown")
+	assert.NoError(err)
+	assert.Equal(2, failures.Count)
+
+	assert.NoError(registry.ResetFailures("unknown"))
+	failures, err = registry.Failures("unknown")
+	assert.NoError(err)
+	assert.Zero(failures.Count)
+
+	// the expired failures are forgotten
+	_, err = registry.AddFailure("expired", now, now.Add(-time.Second))
+	assert.NoError(err)
+	failures, err = registry.Failures("expired")
+	assert.NoError(err)
+	assert.Zero(failures.Count)
+	failures, err = registry.AddFailure("expired", now, now.Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(1, failures.Count)
+}
+
+func TestInMemoryStore_MaxFailures(t *testing.T) {
+	assert := assert.New(t)
+	registry := store.NewInMemoryStore()
+	now := time.Now()
+
+	for i := 0; i < store.MaxFailures; i++ {
+		_, err := registry.AddFailure(zkp.UUID(fmt.Sprintf("unknown-%d", i)), now, now.Add(time.Hour))
+		assert.NoError(err)
+	}
+	// the new user names are refused, the counted ones are kept
+	_, err := registry.AddFailure("victim", now, now.Add(time.Hour))
+	assert.ErrorIs(err, store.FailuresFullError)
+	failures, err := registry.AddFailure("unknown-0", now, now.Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(2, failures.Count)
+	counted := 0
+	for i := 0; i < store.MaxFailures; i++ {
+		failures, err := registry.Failures(zkp.UUID(fmt.Sprintf("unknown-%d", i)))
+		assert.NoError(err)
+		counted += failures.Count
+	}
+	assert.Equal(store.MaxFailures+1, counted)
+
+	// the expired records make room
+	expired := store.NewInMemoryStore()
+	for i := 0; i < store.MaxFailures; i++ {
+		_, err := expired.AddFailure(zkp.UUID(fmt.Sprintf("unknown-%d", i)), now, now.Add(-time.Second))
+		assert.NoError(err)
+	}
+	failures, err = expired.AddFailure("victim", now, now.Add(time.Hour))
+	assert.NoError(err)
+	assert.Equal(1, failures.Count)
+}
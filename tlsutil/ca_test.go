@@ -0,0 +1,45 @@
+package tlsutil_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/tlsutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCA(t *testing.T) {
+	assert := assert.New(t)
+	ca, err := tlsutil.NewCA("test CA", time.Hour)
+	assert.NoError(err)
+	assert.True(ca.Certificate.IsCA)
+	assert.Equal("test CA", ca.Certificate.Subject.CommonName)
+	assert.NotEmpty(ca.CertPEM)
+}
+
+func TestCA_Issue(t *testing.T) {
+	assert := assert.New(t)
+	ca, err := tlsutil.NewCA("test CA", time.Hour)
+	assert.NoError(err)
+
+	certPEM, keyPEM, err := ca.Issue("server", []string{"localhost", "127.0.0.1"}, time.Hour)
+	assert.NoError(err)
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	assert.NoError(err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	assert.NoError(err)
+	assert.Equal([]string{"localhost"}, cert.DNSNames)
+	assert.Len(cert.IPAddresses, 1)
+
+	// the certificate is signed by the CA
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+	_, err = cert.Verify(x509.VerifyOptions{
+		DNSName:   "localhost",
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(err)
+}
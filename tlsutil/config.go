@@ -0,0 +1,142 @@
+package tlsutil
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var (
+	NoCertificatesError    = errors.New("no certificates found")
+	MissingClientCAError   = errors.New("client certificate requirement needs a client CA")
+	MissingKeyPairError    = errors.New("both certificate and key files are required")
+	PinMismatchError       = errors.New("server certificate doesn't match the pin")
+	MissingServerCertError = errors.New("server didn't present a certificate")
+)
+
+type (
+	// ServerOptions configures the server TLS
+	ServerOptions struct {
+		// CertFile and KeyFile is the PEM encoded server certificate and key
+		CertFile, KeyFile string
+		// ClientCAFile is the PEM encoded CA used to verify client certificates
+		ClientCAFile string
+		// RequireClientCert rejects clients without a valid certificate
+		RequireClientCert bool
+	}
+
+	// ClientOptions configures the client TLS
+	ClientOptions struct {
+		// CAFile is the PEM encoded CA used to verify the server, system roots if empty
+		CAFile string
+		// CertFile and KeyFile is the PEM encoded client certificate and key for the mutual authentication
+		CertFile, KeyFile string
+		// ServerName overrides the name used to verify the server certificate
+		ServerName string
+		// Pin is the hex encoded SHA-256 fingerprint of the server certificate public key, see Fingerprint.
+		// If set without CAFile, the pin replaces the certificate chain verification.
+		Pin string
+	}
+)
+
+// ServerConfig returns the server TLS configuration
+func ServerConfig(o ServerOptions) (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, MissingKeyPairError
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if o.ClientCAFile != "" {
+		pool, err := LoadCertPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if o.RequireClientCert {
+		return nil, MissingClientCAError
+	}
+
+	return config, nil
+}
+
+// ClientConfig returns the client TLS configuration
+func ClientConfig(o ClientOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: o.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, MissingKeyPairError
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if o.CAFile != "" {
+		pool, err := LoadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if o.Pin != "" {
+		pin := strings.ToLower(strings.ReplaceAll(o.Pin, ":", ""))
+		if o.CAFile == "" {
+			// the pin is the trust anchor, skip the chain verification
+			config.InsecureSkipVerify = true
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return MissingServerCertError
+			}
+			if Fingerprint(state.PeerCertificates[0]) != pin {
+				return PinMismatchError
+			}
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+// LoadCertPool loads PEM encoded certificates from the file
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w in %q", NoCertificatesError, file)
+	}
+	return pool, nil
+}
+
+// Fingerprint returns the hex encoded SHA-256 of the certificate public key
+// The fingerprint survives the certificate renewal as long as the key is kept.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
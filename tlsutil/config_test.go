@@ -0,0 +1,211 @@
+package tlsutil_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/tlsutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCerts struct {
+	caFile, serverCert, serverKey, clientCert, clientKey string
+	serverPin                                            string
+}
+
+// newTestCerts writes a development CA, server and client certificates to a temporary directory
+func newTestCerts(t *testing.T) testCerts {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		file := path.Join(dir, name)
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	ca, err := tlsutil.NewCA("test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey, err := ca.Issue("server", []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, clientKey, err := ca.Issue("client", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(serverCert)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCerts{
+		caFile:     write("ca.pem", ca.CertPEM),
+		serverCert: write("server.pem", serverCert),
+		serverKey:  write("server-key.pem", serverKey),
+		clientCert: write("client.pem", clientCert),
+		clientKey:  write("client-key.pem", clientKey),
+		serverPin:  tlsutil.Fingerprint(cert),
+	}
+}
+
+// handshake runs the TLS handshake over in-memory connection and returns client and server errors
+func handshake(serverConfig, clientConfig *tls.Config) (clientErr, serverErr error) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		server := tls.Server(serverConn, serverConfig)
+		err := server.Handshake()
+		if err != nil {
+			server.Close()
+		}
+		done <- err
+	}()
+	client := tls.Client(clientConn, clientConfig)
+	clientErr = client.Handshake()
+	if clientErr == nil {
+		// TLS 1.3 server verifies the client certificate after the client handshake is complete
+		client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, readErr := client.Read(make([]byte, 1))
+		if ne, ok := readErr.(net.Error); !ok || !ne.Timeout() {
+			clientErr = readErr
+		}
+	} else {
+		client.Close()
+	}
+	serverErr = <-done
+	return clientErr, serverErr
+}
+
+func TestConfig_Handshake(t *testing.T) {
+	assert := assert.New(t)
+	certs := newTestCerts(t)
+
+	tests := map[string]struct {
+		server    tlsutil.ServerOptions
+		client    tlsutil.ClientOptions
+		expectErr bool
+	}{
+		"server certificate verified by CA": {
+			server: tlsutil.ServerOptions{CertFile: certs.serverCert, KeyFile: certs.serverKey},
+			client: tlsutil.ClientOptions{CAFile: certs.caFile, ServerName: "localhost"},
+		},
+		"unknown server CA": {
+			server:    tlsutil.ServerOptions{CertFile: certs.serverCert, KeyFile: certs.serverKey},
+			client:    tlsutil.ClientOptions{ServerName: "localhost"},
+			expectErr: true,
+		},
+		"wrong server name": {
+			server:    tlsutil.ServerOptions{CertFile: certs.serverCert, KeyFile: certs.serverKey},
+			client:    tlsutil.ClientOptions{CAFile: certs.caFile, ServerName: "example.com"},
+			expectErr: true,
+		},
+		"pinned server without CA": {
+			server: tlsutil.ServerOptions{CertFile: certs.serverCert, KeyFile: certs.serverKey},
+			client: tlsutil.ClientOptions{Pin: certs.serverPin},
+		},
+		"pinned server with CA": {
+			server: tlsutil.ServerOptions{CertFile: certs.serverCert, KeyFile: certs.serverKey},
+			client: tlsutil.ClientOptions{CAFile: certs.caFile, ServerName: "localhost", Pin: certs.serverPin},
+		},
+		"pin mismatch": {
+			server:    tlsutil.ServerOptions{CertFile: certs.serverCert, KeyFile: certs.serverKey},
+			client:    tlsutil.ClientOptions{Pin: "00" + certs.serverPin[2:]},
+			expectErr: true,
+		},
+		"mutual authentication": {
+			server: tlsutil.ServerOptions{
+				CertFile:          certs.serverCert,
+				KeyFile:           certs.serverKey,
+				ClientCAFile:      certs.caFile,
+				RequireClientCert: true,
+			},
+			client: tlsutil.ClientOptions{
+				CAFile:     certs.caFile,
+				ServerName: "localhost",
+				CertFile:   certs.clientCert,
+				KeyFile:    certs.clientKey,
+			},
+		},
+		"missing client certificate": {
+			server: tlsutil.ServerOptions{
+				CertFile:          certs.serverCert,
+				KeyFile:           certs.serverKey,
+				ClientCAFile:      certs.caFile,
+				RequireClientCert: true,
+			},
+			client:    tlsutil.ClientOptions{CAFile: certs.caFile, ServerName: "localhost"},
+			expectErr: true,
+		},
+		"optional client certificate": {
+			server: tlsutil.ServerOptions{
+				CertFile:     certs.serverCert,
+				KeyFile:      certs.serverKey,
+				ClientCAFile: certs.caFile,
+			},
+			client: tlsutil.ClientOptions{CAFile: certs.caFile, ServerName: "localhost"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			serverConfig, err := tlsutil.ServerConfig(test.server)
+			assert.NoError(err)
+			clientConfig, err := tlsutil.ClientConfig(test.client)
+			assert.NoError(err)
+
+			clientErr, serverErr := handshake(serverConfig, clientConfig)
+			if test.expectErr {
+				assert.True(clientErr != nil || serverErr != nil)
+			} else {
+				assert.NoError(clientErr)
+				assert.NoError(serverErr)
+			}
+		})
+	}
+}
+
+func TestServerConfig_Errors(t *testing.T) {
+	assert := assert.New(t)
+	certs := newTestCerts(t)
+
+	_, err := tlsutil.ServerConfig(tlsutil.ServerOptions{CertFile: certs.serverCert})
+	assert.ErrorIs(err, tlsutil.MissingKeyPairError)
+
+	_, err = tlsutil.ServerConfig(tlsutil.ServerOptions{
+		CertFile:          certs.serverCert,
+		KeyFile:           certs.serverKey,
+		RequireClientCert: true,
+	})
+	assert.ErrorIs(err, tlsutil.MissingClientCAError)
+
+	_, err = tlsutil.ServerConfig(tlsutil.ServerOptions{
+		CertFile:     certs.serverCert,
+		KeyFile:      certs.serverKey,
+		ClientCAFile: certs.serverKey,
+	})
+	assert.ErrorIs(err, tlsutil.NoCertificatesError)
+}
+
+func TestClientConfig_Errors(t *testing.T) {
+	assert := assert.New(t)
+	certs := newTestCerts(t)
+
+	_, err := tlsutil.ClientConfig(tlsutil.ClientOptions{KeyFile: certs.clientKey})
+	assert.ErrorIs(err, tlsutil.MissingKeyPairError)
+
+	_, err = tlsutil.ClientConfig(tlsutil.ClientOptions{CAFile: path.Join(t.TempDir(), "missing.pem")})
+	assert.Error(err)
+}
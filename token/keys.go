@@ -0,0 +1,84 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	NoKeyError         = errors.New("no PEM key found")
+	NotEd25519KeyError = errors.New("not an Ed25519 key")
+)
+
+// LoadPrivateKey loads the PEM encoded PKCS #8 Ed25519 private key signing the tokens
+// e.g. generated by `openssl genpkey -algorithm ed25519`
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := loadPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, NotEd25519KeyError)
+	}
+	return privateKey, nil
+}
+
+// LoadPublicKey loads the PEM encoded PKIX Ed25519 public key verifying the tokens
+// e.g. extracted by `openssl pkey -pubout`. The private key file is accepted as well.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := loadPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		key, err := LoadPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, NotEd25519KeyError)
+	}
+	return publicKey, nil
+}
+
+// LoadPublicKeys loads the public keys from the files
+func LoadPublicKeys(paths ...string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := LoadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// loadPEM returns the first PEM block of the file
+func loadPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: %w", path, NoKeyError)
+	}
+	return block, nil
+}
@@ -0,0 +1,46 @@
+package token_test
+
+import (
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/stretchr/testify/assert"
+)
+
+// the test keys are generated by openssl:
+//
+//	openssl genpkey -algorithm ed25519 -out ed25519.pem
+//	openssl pkey -in ed25519.pem -pubout -out ed25519.pub
+//	openssl genpkey -algorithm ec -pkeyopt ec_paramgen_curve:P-256 -out p256.pem
+
+func TestLoadKeys(t *testing.T) {
+	assert := assert.New(t)
+	privateKey, err := token.LoadPrivateKey("testdata/ed25519.pem")
+	assert.NoError(err)
+	publicKey, err := token.LoadPublicKey("testdata/ed25519.pub")
+	assert.NoError(err)
+	assert.Equal(privateKey.Public(), publicKey)
+
+	// the public key of the private key file
+	keys, err := token.LoadPublicKeys("testdata/ed25519.pem", "testdata/ed25519.pub")
+	assert.NoError(err)
+	assert.Equal(publicKey, keys[0])
+	assert.Equal(publicKey, keys[1])
+
+	tokenString, _, err := token.NewSigner(privateKey).Issue("alice", token.AuthMethodZKP)
+	assert.NoError(err)
+	_, err = token.Verify(tokenString, publicKey)
+	assert.NoError(err)
+}
+
+func TestLoadKeys_Errors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := token.LoadPrivateKey("testdata/p256.pem")
+	assert.ErrorIs(err, token.NotEd25519KeyError)
+	_, err = token.LoadPublicKey("testdata/p256.pem")
+	assert.ErrorIs(err, token.NotEd25519KeyError)
+	_, err = token.LoadPrivateKey("keys_test.go")
+	assert.ErrorIs(err, token.NoKeyError)
+	_, err = token.LoadPublicKeys("testdata/ed25519.pub", "testdata/missing.pub")
+	assert.Error(err)
+}
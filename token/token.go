@@ -0,0 +1,263 @@
+// Package token issues and verifies the session tokens of the authenticated users
+//
+// A token is a JWT signed with Ed25519 (alg EdDSA). Other services import Verify
+// to trust the user authenticated by the ZKP server without rerunning the protocol.
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Algorithm is the JWT signing algorithm, the only one accepted by Verify
+const Algorithm = "EdDSA"
+
+// AuthMethodZKP is the authentication method of the users proving the password knowledge
+const AuthMethodZKP = "zkp"
+
+// DefaultTTL is the token lifetime used by NewSigner
+const DefaultTTL = time.Hour
+
+// DefaultLeeway is the clock difference tolerated by NewVerifier
+const DefaultLeeway = time.Minute
+
+var (
+	MalformedTokenError       = errors.New("malformed token")
+	UnsupportedAlgorithmError = errors.New("unsupported token algorithm")
+	UnknownKeyError           = errors.New("unknown token key")
+	InvalidSignatureError     = errors.New("invalid token signature")
+	ExpiredTokenError         = errors.New("token expired")
+	FutureTokenError          = errors.New("token issued in the future")
+	WrongIssuerError          = errors.New("wrong token issuer")
+	RevokedTokenError         = errors.New("token revoked")
+)
+
+type (
+	// Claims are the token contents
+	Claims struct {
+		// Issuer names the server issuing the token, optional
+		Issuer string `json:"iss,omitempty"`
+		// Subject is the user id
+		Subject string `json:"sub"`
+		// IssuedAt and ExpiresAt are the unix times in seconds
+		IssuedAt  int64 `json:"iat"`
+		ExpiresAt int64 `json:"exp"`
+		// ID is the session id
+		ID string `json:"jti"`
+		// AuthMethods lists how the user was authenticated
+		AuthMethods []string `json:"amr"`
+	}
+
+	// header is the JWT header
+	header struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ,omitempty"`
+		KeyID     string `json:"kid,omitempty"`
+	}
+
+	// Signer issues the tokens
+	Signer struct {
+		key   ed25519.PrivateKey
+		keyID string
+		// Issuer is set in the issued tokens if not empty
+		Issuer string
+		// TTL is the lifetime of the issued tokens
+		TTL time.Duration
+	}
+
+	// RevocationList tells the revoked sessions
+	RevocationList interface {
+		// Revoked returns true if the session is revoked
+		Revoked(id string) (bool, error)
+	}
+
+	// Verifier verifies the tokens signed by any of its keys
+	Verifier struct {
+		// keys by id
+		keys map[string]ed25519.PublicKey
+		// Issuer is required in the tokens if not empty
+		Issuer string
+		// Leeway is the clock difference tolerated checking the token times
+		Leeway time.Duration
+		// Revocations rejects the tokens of the revoked sessions if set
+		Revocations RevocationList
+	}
+)
+
+// NewSigner returns the signer issuing tokens with the key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{
+		key:   key,
+		keyID: KeyID(key.Public().(ed25519.PublicKey)),
+		TTL:   DefaultTTL,
+	}
+}
+
+// PublicKey returns the key verifying the issued tokens
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Issue returns the token of the new session of the authenticated user
+func (s *Signer) Issue(user string, authMethods ...string) (string, *Claims, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", nil, err
+	}
+	return s.IssueSession(id, user, authMethods...)
+}
+
+// IssueSession returns the new token of the existing session, e.g. refreshing the expiring one
+func (s *Signer) IssueSession(id, user string, authMethods ...string) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		Issuer:      s.Issuer,
+		Subject:     user,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(s.TTL).Unix(),
+		ID:          id,
+		AuthMethods: authMethods,
+	}
+	token, err := s.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// Sign returns the token carrying the claims
+func (s *Signer) Sign(claims *Claims) (string, error) {
+	h, err := json.Marshal(&header{Algorithm: Algorithm, Type: "JWT", KeyID: s.keyID})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encode(h) + "." + encode(c)
+	signature := ed25519.Sign(s.key, []byte(signingInput))
+	return signingInput + "." + encode(signature), nil
+}
+
+// NewVerifier returns the verifier accepting the tokens signed by any of the keys
+// Several keys allow rotating the signing key.
+func NewVerifier(keys ...ed25519.PublicKey) *Verifier {
+	v := &Verifier{
+		keys:   make(map[string]ed25519.PublicKey, len(keys)),
+		Leeway: DefaultLeeway,
+	}
+	for _, key := range keys {
+		v.keys[KeyID(key)] = key
+	}
+	return v
+}
+
+// Verify checks the token signed by any of the keys is valid now and returns its claims
+func Verify(token string, keys ...ed25519.PublicKey) (*Claims, error) {
+	return NewVerifier(keys...).Verify(token)
+}
+
+// Verify checks the token is valid now and returns its claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	return v.VerifyAt(token, time.Now())
+}
+
+// VerifyAt checks the token is valid at the time and returns its claims
+func (v *Verifier) VerifyAt(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, MalformedTokenError
+	}
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, err
+	}
+	if h.Algorithm != Algorithm {
+		return nil, fmt.Errorf("%w %q", UnsupportedAlgorithmError, h.Algorithm)
+	}
+	key, ok := v.keys[h.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", UnknownKeyError, h.KeyID)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", MalformedTokenError, err)
+	}
+	if !ed25519.Verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, InvalidSignatureError
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, fmt.Errorf("%w: missing subject or id", MalformedTokenError)
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("%w %q", WrongIssuerError, claims.Issuer)
+	}
+	if now.Add(-v.Leeway).Unix() >= claims.ExpiresAt {
+		return nil, ExpiredTokenError
+	}
+	if now.Add(v.Leeway).Unix() < claims.IssuedAt {
+		return nil, FutureTokenError
+	}
+	if v.Revocations != nil {
+		revoked, err := v.Revocations.Revoked(claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, RevokedTokenError
+		}
+	}
+	return &claims, nil
+}
+
+// Expires returns the expiration time
+func (c *Claims) Expires() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// KeyID returns the id of the key set in the token header
+// It is the hex encoded start of the key SHA-256 hash.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// newSessionID returns a random session id
+func newSessionID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// encode returns the base64url encoded token part
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeJSON decodes the base64url encoded JSON token part
+func decodeJSON(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: %v", MalformedTokenError, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", MalformedTokenError, err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package token_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKey(t testing.TB) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSigner_Issue(t *testing.T) {
+	assert := assert.New(t)
+	signer := token.NewSigner(newKey(t))
+	signer.Issuer = "zkp"
+
+	tokenString, claims, err := signer.Issue("alice", token.AuthMethodZKP)
+	assert.NoError(err)
+	assert.Equal("zkp", claims.Issuer)
+	assert.Equal("alice", claims.Subject)
+	assert.Equal([]string{token.AuthMethodZKP}, claims.AuthMethods)
+	assert.Len(claims.ID, 32)
+	assert.Equal(int64(token.DefaultTTL/time.Second), claims.ExpiresAt-claims.IssuedAt)
+
+	verified, err := token.Verify(tokenString, signer.PublicKey())
+	assert.NoError(err)
+	assert.Equal(claims, verified)
+
+	// every session has its own id
+	_, other, err := signer.Issue("alice", token.AuthMethodZKP)
+	assert.NoError(err)
+	assert.NotEqual(claims.ID, other.ID)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	signer := token.NewSigner(newKey(t))
+	signer.Issuer = "zkp"
+	valid, claims, err := signer.Issue("alice", token.AuthMethodZKP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Unix(claims.IssuedAt, 0)
+	parts := strings.Split(valid, ".")
+	resigned := func(header string) string {
+		input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + parts[1]
+		signature := ed25519.Sign(newKey(t), []byte(input))
+		return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	noSubject, err := signer.Sign(&token.Claims{ID: "1", ExpiresAt: claims.ExpiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		token    string
+		verifier *token.Verifier
+		now      time.Time
+		expected error
+	}{
+		"valid": {
+			token:    valid,
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+		},
+		"rotated key": {
+			token:    valid,
+			verifier: token.NewVerifier(newKey(t).Public().(ed25519.PublicKey), signer.PublicKey()),
+			now:      issued,
+		},
+		"expired": {
+			token:    valid,
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued.Add(token.DefaultTTL + token.DefaultLeeway),
+			expected: token.ExpiredTokenError,
+		},
+		"expired within leeway": {
+			token:    valid,
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued.Add(token.DefaultTTL),
+		},
+		"issued in the future": {
+			token:    valid,
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued.Add(-2 * token.DefaultLeeway),
+			expected: token.FutureTokenError,
+		},
+		"unknown key": {
+			token:    valid,
+			verifier: token.NewVerifier(newKey(t).Public().(ed25519.PublicKey)),
+			now:      issued,
+			expected: token.UnknownKeyError,
+		},
+		"tampered claims": {
+			token:    parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"bob","jti":"1","exp":9999999999}`)) + "." + parts[2],
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+			expected: token.InvalidSignatureError,
+		},
+		"forged signature": {
+			token:    resigned(`{"alg":"EdDSA","kid":"` + token.KeyID(signer.PublicKey()) + `"}`),
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+			expected: token.InvalidSignatureError,
+		},
+		"none algorithm": {
+			token:    resigned(`{"alg":"none","kid":"` + token.KeyID(signer.PublicKey()) + `"}`),
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+			expected: token.UnsupportedAlgorithmError,
+		},
+		"missing subject": {
+			token:    noSubject,
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+			expected: token.MalformedTokenError,
+		},
+		"two parts": {
+			token:    parts[0] + "." + parts[1],
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+			expected: token.MalformedTokenError,
+		},
+		"bad encoding": {
+			token:    "!." + parts[1] + "." + parts[2],
+			verifier: token.NewVerifier(signer.PublicKey()),
+			now:      issued,
+			expected: token.MalformedTokenError,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			verified, err := test.verifier.VerifyAt(test.token, test.now)
+			if test.expected != nil {
+				assert.ErrorIs(err, test.expected)
+				assert.Nil(verified)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(claims, verified)
+		})
+	}
+}
+
+func TestVerifier_Issuer(t *testing.T) {
+	assert := assert.New(t)
+	signer := token.NewSigner(newKey(t))
+	signer.Issuer = "zkp"
+	tokenString, _, err := signer.Issue("alice", token.AuthMethodZKP)
+	assert.NoError(err)
+
+	verifier := token.NewVerifier(signer.PublicKey())
+	verifier.Issuer = "zkp"
+	_, err = verifier.Verify(tokenString)
+	assert.NoError(err)
+	verifier.Issuer = "other"
+	_, err = verifier.Verify(tokenString)
+	assert.ErrorIs(err, token.WrongIssuerError)
+}
+
+func FuzzVerify(f *testing.F) {
+	key := newKey(f)
+	signer := token.NewSigner(key)
+	valid, _, err := signer.Issue("alice", token.AuthMethodZKP)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid)
+	f.Add("")
+	f.Add("..")
+	f.Add("e30.e30.")
+
+	f.Fuzz(func(t *testing.T, tokenString string) {
+		claims, err := token.Verify(tokenString, signer.PublicKey())
+		if err == nil && (claims == nil || claims.Subject == "") {
+			t.Fatalf("incomplete claims %v", claims)
+		}
+	})
+}
+
+// revocations is the revocation list of the test
+type revocations map[string]bool
+
+func (r revocations) Revoked(id string) (bool, error) {
+	return r[id], nil
+}
+
+func TestVerifier_Revocations(t *testing.T) {
+	assert := assert.New(t)
+	signer := token.NewSigner(newKey(t))
+	valid, _, err := signer.Issue("alice", token.AuthMethodZKP)
+	assert.NoError(err)
+	revoked, claims, err := signer.Issue("alice", token.AuthMethodZKP)
+	assert.NoError(err)
+
+	verifier := token.NewVerifier(signer.PublicKey())
+	verifier.Revocations = revocations{claims.ID: true}
+	_, err = verifier.Verify(valid)
+	assert.NoError(err)
+	_, err = verifier.Verify(revoked)
+	assert.ErrorIs(err, token.RevokedTokenError)
+
+	// the new token of the revoked session is rejected as well
+	reissued, _, err := signer.IssueSession(claims.ID, "alice", token.AuthMethodZKP)
+	assert.NoError(err)
+	_, err = verifier.Verify(reissued)
+	assert.ErrorIs(err, token.RevokedTokenError)
+}
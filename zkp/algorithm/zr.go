@@ -13,6 +13,9 @@ import (
 
 var ZERO = big.NewInt(0)
 
+// Logger prints the proof challenges
+var Logger = log.Default()
+
 // Zr represents the group of exponents for some multiplicative group.
 // Zr is a base units of ZKP, and is associated with a random
 // value as a commitment.
@@ -65,7 +68,7 @@ func (z *Zr) Prove(c *big.Int) *big.Int {
 		c.Mod(c, z.Modulo)
 	}
 
-	log.Print("c = ", c)
+	Logger.Print("c = ", c)
 	tmp := big.NewInt(0)
 	tmp.Mul(c, z.Value)
 	tmp.Mod(tmp, z.Modulo)
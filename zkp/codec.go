@@ -0,0 +1,231 @@
+package zkp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+var (
+	UnknownMessageError   = errors.New("unknown message")
+	DuplicateMessageError = errors.New("message already registered")
+	EmptyEnvelopeError    = errors.New("empty envelope")
+)
+
+// DefaultCodec is the codec used by the client and the server.
+// A new protocol message is added to the Frame oneof and registered with RegisterMessage,
+// the other registered messages, e.g. of the application, are carried in the Frame extension.
+var DefaultCodec = NewCodec()
+
+type (
+	// Codec encodes proto messages into frames and decodes them back
+	// Only registered message types can be sent or received.
+	// Legacy envelopes are still decoded, the encoded messages are always frames.
+	Codec struct {
+		mu    sync.RWMutex
+		types map[string]protoreflect.MessageType
+	}
+)
+
+func init() {
+	if err := RegisterMessage(
+		&zkp_pb.RegisterRequest{},
+		&zkp_pb.RegisterResponse{},
+		&zkp_pb.AuthRequest{},
+		&zkp_pb.AuthResponse{},
+		&zkp_pb.AnswerRequest{},
+		&zkp_pb.ChallengeResponse{},
+		&zkp_pb.Hello{},
+		&zkp_pb.HelloResponse{},
+		&zkp_pb.WhoAmIRequest{},
+		&zkp_pb.WhoAmIResponse{},
+		&zkp_pb.ChangePasswordRequest{},
+		&zkp_pb.ChangePasswordResponse{},
+		&zkp_pb.LogoutRequest{},
+		&zkp_pb.LogoutResponse{},
+		&zkp_pb.AppRequest{},
+		&zkp_pb.AppResponse{},
+		&zkp_pb.IntrospectRequest{},
+		&zkp_pb.IntrospectResponse{},
+		&zkp_pb.RefreshRequest{},
+		&zkp_pb.RefreshResponse{},
+		&zkp_pb.RevokeRequest{},
+		&zkp_pb.RevokeResponse{},
+		&zkp_pb.SessionsRequest{},
+		&zkp_pb.SessionsResponse{},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// NewCodec returns a new codec without any registered message
+func NewCodec() *Codec {
+	return &Codec{
+		types: make(map[string]protoreflect.MessageType),
+	}
+}
+
+// RegisterMessage registers message types in the DefaultCodec
+func RegisterMessage(messages ...proto.Message) error {
+	return DefaultCodec.Register(messages...)
+}
+
+// MessageName returns the name used to identify the message in the codec and the legacy envelope
+func MessageName(message proto.Message) string {
+	return string(message.ProtoReflect().Descriptor().Name())
+}
+
+// Register registers message types
+// The messages outside the Frame oneof are sent in the Frame extension, the peer must register them as well.
+// returns DuplicateMessageError if a different type with the same name is already registered
+func (c *Codec) Register(messages ...proto.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, message := range messages {
+		mt := message.ProtoReflect().Type()
+		name := MessageName(message)
+		if registered, ok := c.types[name]; ok {
+			if registered.Descriptor().FullName() != mt.Descriptor().FullName() {
+				return fmt.Errorf("%w: %q", DuplicateMessageError, name)
+			}
+			continue
+		}
+		c.types[name] = mt
+	}
+	return nil
+}
+
+// lookup returns the registered message type by the message name
+func (c *Codec) lookup(name string) (protoreflect.MessageType, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	mt, ok := c.types[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", UnknownMessageError, name)
+	}
+	return mt, nil
+}
+
+// Encode puts the proto Message into the Frame of the connection stream
+// returns UnknownMessageError if the message type isn't registered
+func (c *Codec) Encode(message proto.Message) ([]byte, error) {
+	return c.EncodeStream(0, message)
+}
+
+// EncodeStream puts the proto Message into the Frame of the stream
+// A nil message aborts the stream.
+func (c *Codec) EncodeStream(stream uint32, message proto.Message) ([]byte, error) {
+	if message == nil {
+		return proto.Marshal(&zkp_pb.Frame{Version: FrameVersion, Stream: stream, Abort: true})
+	}
+	if _, err := c.lookup(MessageName(message)); err != nil {
+		return nil, err
+	}
+	frame, err := NewFrame(message)
+	if errors.Is(err, UnknownMessageError) {
+		// the registered message outside the oneof
+		frame, err = newExtensionFrame(message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	frame.Stream = stream
+	return proto.Marshal(frame)
+}
+
+// Decode decodes the Frame or the legacy envelope into proto Message
+// returns UnknownMessageError if it carries an unregistered message type
+// and UnsupportedFrameVersionError if the frame is newer than FrameVersion.
+// The stream id is dropped, use DecodeStream on the multiplexed connections.
+func (c *Codec) Decode(in []byte) (proto.Message, error) {
+	_, msg, err := c.DecodeStream(in)
+	return msg, err
+}
+
+// DecodeStream decodes the Frame or the legacy envelope into proto Message and its stream id
+// returns StreamAbortedError with the stream id if the frame aborts the stream.
+// The legacy envelopes belong to the connection stream 0.
+func (c *Codec) DecodeStream(in []byte) (stream uint32, msg proto.Message, err error) {
+	var frame zkp_pb.Frame
+	if err := proto.Unmarshal(in, &frame); err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case frame.Version == 0:
+		msg, err = c.decodeEnvelope(in)
+		return 0, msg, err
+	case frame.Version > FrameVersion:
+		return 0, nil, fmt.Errorf("%w: %d", UnsupportedFrameVersionError, frame.Version)
+	case frame.Abort:
+		return frame.Stream, nil, StreamAbortedError
+	}
+
+	if extension := frame.GetExtension(); extension != nil {
+		msg, err = c.decodeExtension(extension)
+		return frame.Stream, msg, err
+	}
+	msg, err = FrameMessage(&frame)
+	if err != nil {
+		return frame.Stream, nil, err
+	}
+	if _, err := c.lookup(MessageName(msg)); err != nil {
+		return frame.Stream, nil, err
+	}
+	return frame.Stream, msg, nil
+}
+
+// newExtensionFrame puts the message outside the oneof into the frame extension
+func newExtensionFrame(message proto.Message) (*zkp_pb.Frame, error) {
+	extension, err := anypb.New(message)
+	if err != nil {
+		return nil, err
+	}
+	return &zkp_pb.Frame{Version: FrameVersion, Message: &zkp_pb.Frame_Extension{Extension: extension}}, nil
+}
+
+// decodeExtension decodes the message of the frame extension
+// The Any type URL selects the registered type by its name, the full names must match.
+func (c *Codec) decodeExtension(extension *anypb.Any) (proto.Message, error) {
+	fullName := extension.MessageName()
+	mt, err := c.lookup(string(fullName.Name()))
+	if err != nil {
+		return nil, err
+	}
+	if mt.Descriptor().FullName() != fullName {
+		return nil, fmt.Errorf("%w: %q", UnknownMessageError, fullName)
+	}
+
+	msg := mt.New().Interface()
+	if err := extension.UnmarshalTo(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// decodeEnvelope decodes the legacy envelope into proto Message
+// The envelope name selects the type, the Any type URL must match it.
+func (c *Codec) decodeEnvelope(in []byte) (proto.Message, error) {
+	var envelope zkp_pb.EnvelopeMessage
+	if err := proto.Unmarshal(in, &envelope); err != nil {
+		return nil, err
+	}
+
+	mt, err := c.lookup(envelope.Name)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Message == nil {
+		return nil, EmptyEnvelopeError
+	}
+
+	msg := mt.New().Interface()
+	if err := envelope.Message.UnmarshalTo(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
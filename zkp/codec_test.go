@@ -0,0 +1,244 @@
+package zkp_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec_Register(t *testing.T) {
+	assert := assert.New(t)
+	codec := zkp.NewCodec()
+
+	// unregistered messages can't be encoded
+	_, err := codec.Encode(&zkp_pb.AuthRequest{User: "max"})
+	assert.ErrorIs(err, zkp.UnknownMessageError)
+
+	assert.NoError(codec.Register(&zkp_pb.AuthRequest{}))
+	// registering the same type twice is allowed
+	assert.NoError(codec.Register(&zkp_pb.AuthRequest{}))
+
+	out, err := codec.Encode(&zkp_pb.AuthRequest{User: "max"})
+	assert.NoError(err)
+	msg, err := codec.Decode(out)
+	assert.NoError(err)
+	assert.True(proto.Equal(&zkp_pb.AuthRequest{User: "max"}, msg))
+}
+
+func TestCodec_Register_Duplicate(t *testing.T) {
+	assert := assert.New(t)
+	codec := zkp.NewCodec()
+
+	// both nested messages are named "Commits" in the envelope
+	assert.NoError(codec.Register(&zkp_pb.AuthRequest_Commits{}))
+	err := codec.Register(&zkp_pb.RegisterRequest_Commits{})
+	assert.ErrorIs(err, zkp.DuplicateMessageError)
+}
+
+func TestCodec_Decode(t *testing.T) {
+	assert := assert.New(t)
+
+	value, err := anypb.New(&wrapperspb.StringValue{Value: "test"})
+	assert.NoError(err)
+
+	tests := map[string]struct {
+		envelope      *zkp_pb.EnvelopeMessage
+		expectedError error
+	}{
+		"unknown message": {
+			envelope: &zkp_pb.EnvelopeMessage{
+				Name:    "StringValue",
+				Message: value,
+			},
+			expectedError: zkp.UnknownMessageError,
+		},
+		"empty name": {
+			envelope:      &zkp_pb.EnvelopeMessage{},
+			expectedError: zkp.UnknownMessageError,
+		},
+		"empty content": {
+			envelope: &zkp_pb.EnvelopeMessage{
+				Name: "AuthRequest",
+			},
+			expectedError: zkp.EmptyEnvelopeError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			in, err := proto.Marshal(test.envelope)
+			assert.NoError(err)
+			_, err = zkp.DefaultCodec.Decode(in)
+			assert.ErrorIs(err, test.expectedError)
+		})
+	}
+
+	// the name and the content type have to match
+	in, err := proto.Marshal(&zkp_pb.EnvelopeMessage{
+		Name:    "AuthRequest",
+		Message: value,
+	})
+	assert.NoError(err)
+	_, err = zkp.DefaultCodec.Decode(in)
+	assert.Error(err)
+}
+
+func TestCodec_DecodeFrame(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]struct {
+		frame         *zkp_pb.Frame
+		expectedError error
+	}{
+		"empty frame": {
+			frame:         &zkp_pb.Frame{Version: zkp.FrameVersion},
+			expectedError: zkp.EmptyEnvelopeError,
+		},
+		"newer version": {
+			frame: &zkp_pb.Frame{
+				Version: zkp.FrameVersion + 1,
+				Message: &zkp_pb.Frame_AuthResponse{AuthResponse: &zkp_pb.AuthResponse{}},
+			},
+			expectedError: zkp.UnsupportedFrameVersionError,
+		},
+		"missing version": {
+			frame: &zkp_pb.Frame{
+				Message: &zkp_pb.Frame_AuthResponse{AuthResponse: &zkp_pb.AuthResponse{}},
+			},
+			// decoded as the legacy envelope
+			expectedError: zkp.UnknownMessageError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			in, err := proto.Marshal(test.frame)
+			assert.NoError(err)
+			_, err = zkp.DefaultCodec.Decode(in)
+			assert.ErrorIs(err, test.expectedError)
+		})
+	}
+}
+
+func TestCodec_Encode(t *testing.T) {
+	assert := assert.New(t)
+
+	out, err := zkp.DefaultCodec.Encode(&zkp_pb.AuthResponse{})
+	assert.NoError(err)
+	var frame zkp_pb.Frame
+	assert.NoError(proto.Unmarshal(out, &frame))
+	assert.Equal(uint32(zkp.FrameVersion), frame.GetVersion())
+	assert.NotNil(frame.GetAuthResponse())
+
+	// an empty message still tells its type
+	msg, err := zkp.DefaultCodec.Decode(out)
+	assert.NoError(err)
+	assert.IsType(&zkp_pb.AuthResponse{}, msg)
+}
+
+func TestRegisterMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := zkp.NewCodec()
+	_, err := codec.Encode(&wrapperspb.BytesValue{})
+	assert.ErrorIs(err, zkp.UnknownMessageError)
+
+	// the messages outside the Frame oneof are sent in the extension
+	assert.NoError(codec.Register(&wrapperspb.BytesValue{}))
+	out, err := codec.Encode(&wrapperspb.BytesValue{Value: []byte{1}})
+	assert.NoError(err)
+	var frame zkp_pb.Frame
+	assert.NoError(proto.Unmarshal(out, &frame))
+	assert.NotNil(frame.GetExtension())
+	msg, err := codec.Decode(out)
+	assert.NoError(err)
+	assert.True(proto.Equal(&wrapperspb.BytesValue{Value: []byte{1}}, msg))
+
+	// and received in the legacy envelopes
+	value, err := anypb.New(&wrapperspb.BytesValue{Value: []byte{1}})
+	assert.NoError(err)
+	in, err := proto.Marshal(&zkp_pb.EnvelopeMessage{Name: "BytesValue", Message: value})
+	assert.NoError(err)
+	msg, err = codec.Decode(in)
+	assert.NoError(err)
+	assert.True(proto.Equal(&wrapperspb.BytesValue{Value: []byte{1}}, msg))
+}
+
+func TestCodec_Decode_Extension(t *testing.T) {
+	assert := assert.New(t)
+	codec := zkp.NewCodec()
+	assert.NoError(codec.Register(&wrapperspb.BytesValue{}))
+
+	extension := func(typeURL string) []byte {
+		value, err := anypb.New(&wrapperspb.StringValue{Value: "value"})
+		assert.NoError(err)
+		value.TypeUrl = typeURL
+		out, err := proto.Marshal(&zkp_pb.Frame{Version: zkp.FrameVersion, Stream: 3, Message: &zkp_pb.Frame_Extension{Extension: value}})
+		assert.NoError(err)
+		return out
+	}
+	tests := map[string]struct {
+		in  []byte
+		err error
+	}{
+		"unregistered": {
+			in:  extension("type.googleapis.com/google.protobuf.StringValue"),
+			err: zkp.UnknownMessageError,
+		},
+		"same name of another package": {
+			in:  extension("type.googleapis.com/app.BytesValue"),
+			err: zkp.UnknownMessageError,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			stream, _, err := codec.DecodeStream(test.in)
+			assert.ErrorIs(err, test.err)
+			assert.Equal(uint32(3), stream)
+		})
+	}
+
+	out, err := codec.EncodeStream(5, &wrapperspb.BytesValue{})
+	assert.NoError(err)
+	stream, msg, err := codec.DecodeStream(out)
+	assert.NoError(err)
+	assert.Equal(uint32(5), stream)
+	assert.IsType(&wrapperspb.BytesValue{}, msg)
+}
+
+func FuzzCodec_Decode(f *testing.F) {
+	_, frames := readTestPackets(f)
+	for _, frame := range frames {
+		f.Add(frame)
+	}
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		codec := zkp.DefaultCodec
+		msg, err := codec.Decode(frame)
+		if err != nil {
+			return
+		}
+		// the decoded message survives the round trip
+		out, err := codec.Encode(msg)
+		if errors.Is(err, zkp.UnknownMessageError) {
+			// registered, but received only in the legacy envelopes
+			return
+		}
+		if err != nil {
+			t.Fatalf("encode %v: %v", msg, err)
+		}
+		decoded, err := codec.Decode(out)
+		if err != nil {
+			t.Fatalf("decode %x: %v", out, err)
+		}
+		if !proto.Equal(msg, decoded) {
+			t.Fatalf("got %v, expected %v", decoded, msg)
+		}
+	})
+}
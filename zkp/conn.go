@@ -0,0 +1,17 @@
+package zkp
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// MessageConn sends and receives protocol messages
+	// It's implemented by Framer and by the gRPC stream adapters,
+	// so the protocol flow doesn't depend on the transport.
+	MessageConn interface {
+		ReadMessageContext(ctx context.Context) (proto.Message, error)
+		SendMessageContext(ctx context.Context, message proto.Message) error
+	}
+)
@@ -0,0 +1,118 @@
+package zkp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// readDeadliner is implemented by connections supporting read deadlines, e.g. net.Conn
+	readDeadliner interface {
+		SetReadDeadline(t time.Time) error
+	}
+
+	// writeDeadliner is implemented by connections supporting write deadlines, e.g. net.Conn
+	writeDeadliner interface {
+		SetWriteDeadline(t time.Time) error
+	}
+)
+
+// aLongTimeAgo is a deadline in the past used to interrupt the blocked I/O
+var aLongTimeAgo = time.Unix(1, 0)
+
+// withContext runs the I/O operation applying the context deadline to the connection.
+// Cancelling the context interrupts the blocked operation and returns the context error.
+func withContext(ctx context.Context, setDeadline func(time.Time) error, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if setDeadline == nil {
+		// the connection doesn't support deadlines
+		return op()
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+	if err := setDeadline(deadline); err != nil {
+		return err
+	}
+
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				// unblock the pending operation
+				setDeadline(aLongTimeAgo)
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+	}
+
+	err := op()
+	if err != nil {
+		// report the cancellation or deadline instead of the I/O timeout
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+			// the connection deadline may expire before the context timer fires
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// ReadMessageContext reads the next message and decodes it into proto Message
+// The context deadline is applied to the connection and cancelling the context interrupts the read.
+func (f *Framer) ReadMessageContext(ctx context.Context) (msg proto.Message, err error) {
+	err = withContext(ctx, f.setReadDeadline, func() error {
+		msg, err = f.ReadMessage()
+		return err
+	})
+	return msg, err
+}
+
+// SendMessageContext encodes the proto Message and writes it as a single frame
+// The context deadline is applied to the connection and cancelling the context interrupts the write.
+func (f *Framer) SendMessageContext(ctx context.Context, message proto.Message) error {
+	return withContext(ctx, f.setWriteDeadline, func() error {
+		return f.SendMessage(message)
+	})
+}
+
+// SendStreamMessageContext encodes the proto Message of the stream and writes it as a single frame
+// The context deadline is applied to the connection and cancelling the context interrupts the write.
+func (f *Framer) SendStreamMessageContext(ctx context.Context, stream uint32, message proto.Message) error {
+	return withContext(ctx, f.setWriteDeadline, func() error {
+		return f.SendStreamMessage(stream, message)
+	})
+}
+
+// ReadMessageContext reads and parses the bytes from the connection into proto Message
+// The context deadline is applied to the connection and cancelling the context interrupts the read.
+func ReadMessageContext(ctx context.Context, conn net.Conn) (msg proto.Message, err error) {
+	err = withContext(ctx, conn.SetReadDeadline, func() error {
+		msg, err = ReadMessage(conn)
+		return err
+	})
+	return msg, err
+}
+
+// SendMessageContext writes the proto Message to the connection
+// The context deadline is applied to the connection and cancelling the context interrupts the write.
+func SendMessageContext(ctx context.Context, conn net.Conn, message proto.Message) error {
+	return withContext(ctx, conn.SetWriteDeadline, func() error {
+		return SendMessage(conn, message)
+	})
+}
@@ -0,0 +1,93 @@
+package zkp_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFramer_ReadMessageContext(t *testing.T) {
+	assert := assert.New(t)
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		zkp.SendMessage(server, &zkp_pb.AnswerRequest{Answer: []byte{7}})
+	}()
+
+	framer := zkp.NewFramer(client, client)
+	msg, err := framer.ReadMessageContext(context.Background())
+	assert.NoError(err)
+	assert.True(proto.Equal(&zkp_pb.AnswerRequest{Answer: []byte{7}}, msg))
+}
+
+func TestFramer_ReadMessageContext_Deadline(t *testing.T) {
+	assert := assert.New(t)
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	// the peer never answers
+	framer := zkp.NewFramer(client, client)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := framer.ReadMessageContext(ctx)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestFramer_ReadMessageContext_Cancel(t *testing.T) {
+	assert := assert.New(t)
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	framer := zkp.NewFramer(client, client)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := framer.ReadMessageContext(ctx)
+	assert.ErrorIs(err, context.Canceled)
+
+	// cancelled context fails immediately
+	_, err = framer.ReadMessageContext(ctx)
+	assert.ErrorIs(err, context.Canceled)
+}
+
+func TestSendMessageContext_Deadline(t *testing.T) {
+	assert := assert.New(t)
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	// the peer never reads
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := zkp.SendMessageContext(ctx, client, &zkp_pb.AnswerRequest{Answer: []byte{7}})
+	assert.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestReadMessageContext(t *testing.T) {
+	assert := assert.New(t)
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		zkp.SendMessageContext(context.Background(), server, &zkp_pb.AuthResponse{Result: true})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := zkp.ReadMessageContext(ctx, client)
+	assert.NoError(err)
+	assert.True(proto.Equal(&zkp_pb.AuthResponse{Result: true}, msg))
+}
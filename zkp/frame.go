@@ -0,0 +1,141 @@
+package zkp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// FrameVersion is the version of the frame format sent
+// Version 0 is reserved for the legacy EnvelopeMessage.
+const FrameVersion = 1
+
+var (
+	UnsupportedFrameVersionError = errors.New("unsupported frame version")
+	StreamAbortedError           = errors.New("stream aborted by peer")
+)
+
+// NewFrame puts the protocol message into the frame
+// returns UnknownMessageError if the message isn't part of the Frame oneof,
+// Codec carries the other registered messages in the extension.
+func NewFrame(message proto.Message) (*zkp_pb.Frame, error) {
+	frame := &zkp_pb.Frame{Version: FrameVersion}
+	switch m := message.(type) {
+	case *zkp_pb.Hello:
+		frame.Message = &zkp_pb.Frame_Hello{Hello: m}
+	case *zkp_pb.HelloResponse:
+		frame.Message = &zkp_pb.Frame_HelloResponse{HelloResponse: m}
+	case *zkp_pb.RegisterRequest:
+		frame.Message = &zkp_pb.Frame_RegisterRequest{RegisterRequest: m}
+	case *zkp_pb.RegisterResponse:
+		frame.Message = &zkp_pb.Frame_RegisterResponse{RegisterResponse: m}
+	case *zkp_pb.AuthRequest:
+		frame.Message = &zkp_pb.Frame_AuthRequest{AuthRequest: m}
+	case *zkp_pb.ChallengeResponse:
+		frame.Message = &zkp_pb.Frame_ChallengeResponse{ChallengeResponse: m}
+	case *zkp_pb.AnswerRequest:
+		frame.Message = &zkp_pb.Frame_AnswerRequest{AnswerRequest: m}
+	case *zkp_pb.AuthResponse:
+		frame.Message = &zkp_pb.Frame_AuthResponse{AuthResponse: m}
+	case *zkp_pb.WhoAmIRequest:
+		frame.Message = &zkp_pb.Frame_WhoAmIRequest{WhoAmIRequest: m}
+	case *zkp_pb.WhoAmIResponse:
+		frame.Message = &zkp_pb.Frame_WhoAmIResponse{WhoAmIResponse: m}
+	case *zkp_pb.ChangePasswordRequest:
+		frame.Message = &zkp_pb.Frame_ChangePasswordRequest{ChangePasswordRequest: m}
+	case *zkp_pb.ChangePasswordResponse:
+		frame.Message = &zkp_pb.Frame_ChangePasswordResponse{ChangePasswordResponse: m}
+	case *zkp_pb.LogoutRequest:
+		frame.Message = &zkp_pb.Frame_LogoutRequest{LogoutRequest: m}
+	case *zkp_pb.LogoutResponse:
+		frame.Message = &zkp_pb.Frame_LogoutResponse{LogoutResponse: m}
+	case *zkp_pb.AppRequest:
+		frame.Message = &zkp_pb.Frame_AppRequest{AppRequest: m}
+	case *zkp_pb.AppResponse:
+		frame.Message = &zkp_pb.Frame_AppResponse{AppResponse: m}
+	case *zkp_pb.IntrospectRequest:
+		frame.Message = &zkp_pb.Frame_IntrospectRequest{IntrospectRequest: m}
+	case *zkp_pb.IntrospectResponse:
+		frame.Message = &zkp_pb.Frame_IntrospectResponse{IntrospectResponse: m}
+	case *zkp_pb.RefreshRequest:
+		frame.Message = &zkp_pb.Frame_RefreshRequest{RefreshRequest: m}
+	case *zkp_pb.RefreshResponse:
+		frame.Message = &zkp_pb.Frame_RefreshResponse{RefreshResponse: m}
+	case *zkp_pb.RevokeRequest:
+		frame.Message = &zkp_pb.Frame_RevokeRequest{RevokeRequest: m}
+	case *zkp_pb.RevokeResponse:
+		frame.Message = &zkp_pb.Frame_RevokeResponse{RevokeResponse: m}
+	case *zkp_pb.SessionsRequest:
+		frame.Message = &zkp_pb.Frame_SessionsRequest{SessionsRequest: m}
+	case *zkp_pb.SessionsResponse:
+		frame.Message = &zkp_pb.Frame_SessionsResponse{SessionsResponse: m}
+	default:
+		return nil, fmt.Errorf("%w: %q", UnknownMessageError, MessageName(message))
+	}
+	return frame, nil
+}
+
+// FrameMessage returns the protocol message carried by the frame
+// returns EmptyEnvelopeError if the frame carries no message
+// and UnknownMessageError if it carries the extension, Codec resolves it by the registered types.
+func FrameMessage(frame *zkp_pb.Frame) (proto.Message, error) {
+	var message proto.Message
+	switch m := frame.GetMessage().(type) {
+	case *zkp_pb.Frame_Extension:
+		return nil, fmt.Errorf("%w: extension %q", UnknownMessageError, m.Extension.GetTypeUrl())
+	case *zkp_pb.Frame_Hello:
+		message = m.Hello
+	case *zkp_pb.Frame_HelloResponse:
+		message = m.HelloResponse
+	case *zkp_pb.Frame_RegisterRequest:
+		message = m.RegisterRequest
+	case *zkp_pb.Frame_RegisterResponse:
+		message = m.RegisterResponse
+	case *zkp_pb.Frame_AuthRequest:
+		message = m.AuthRequest
+	case *zkp_pb.Frame_ChallengeResponse:
+		message = m.ChallengeResponse
+	case *zkp_pb.Frame_AnswerRequest:
+		message = m.AnswerRequest
+	case *zkp_pb.Frame_AuthResponse:
+		message = m.AuthResponse
+	case *zkp_pb.Frame_WhoAmIRequest:
+		message = m.WhoAmIRequest
+	case *zkp_pb.Frame_WhoAmIResponse:
+		message = m.WhoAmIResponse
+	case *zkp_pb.Frame_ChangePasswordRequest:
+		message = m.ChangePasswordRequest
+	case *zkp_pb.Frame_ChangePasswordResponse:
+		message = m.ChangePasswordResponse
+	case *zkp_pb.Frame_LogoutRequest:
+		message = m.LogoutRequest
+	case *zkp_pb.Frame_LogoutResponse:
+		message = m.LogoutResponse
+	case *zkp_pb.Frame_AppRequest:
+		message = m.AppRequest
+	case *zkp_pb.Frame_AppResponse:
+		message = m.AppResponse
+	case *zkp_pb.Frame_IntrospectRequest:
+		message = m.IntrospectRequest
+	case *zkp_pb.Frame_IntrospectResponse:
+		message = m.IntrospectResponse
+	case *zkp_pb.Frame_RefreshRequest:
+		message = m.RefreshRequest
+	case *zkp_pb.Frame_RefreshResponse:
+		message = m.RefreshResponse
+	case *zkp_pb.Frame_RevokeRequest:
+		message = m.RevokeRequest
+	case *zkp_pb.Frame_RevokeResponse:
+		message = m.RevokeResponse
+	case *zkp_pb.Frame_SessionsRequest:
+		message = m.SessionsRequest
+	case *zkp_pb.Frame_SessionsResponse:
+		message = m.SessionsResponse
+	}
+	if message == nil || !message.ProtoReflect().IsValid() {
+		return nil, EmptyEnvelopeError
+	}
+	return message, nil
+}
@@ -0,0 +1,174 @@
+package zkp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// FrameHeaderSize is the size of the frame length prefix
+	FrameHeaderSize = 4
+	// DefaultMaxFrameSize is the largest frame accepted unless configured otherwise
+	DefaultMaxFrameSize = 64 * 1024
+)
+
+var (
+	FrameTooLargeError = errors.New("frame exceeds the maximum size")
+)
+
+type (
+	// Framer reads and writes length-prefixed frames
+	//
+	// Frame structure:
+	// 4 bytes    | N bytes
+	// -----------+--------------------------------
+	// the size N | message content of the length N
+	//
+	// The size is encoded as little endian uint32.
+	// Reads are buffered, so a single Framer must be used for the whole connection:
+	// bytes belonging to the following frames are kept for the next ReadFrame call.
+	// After a failed read the stream position is undefined and the connection should be closed.
+	Framer struct {
+		r *bufio.Reader
+		w io.Writer
+		// connection deadlines, nil if not supported
+		setReadDeadline  func(time.Time) error
+		setWriteDeadline func(time.Time) error
+		// MaxFrameSize limits the size of the frame accepted from the peer
+		MaxFrameSize uint32
+		// Codec encodes and decodes the messages
+		Codec *Codec
+		// RequireHello makes ReadMessage reject any message before Hello or HelloResponse
+		// and any hello after the first one
+		RequireHello bool
+		// the hello was received
+		hello bool
+	}
+)
+
+// NewFramer returns a new framer reading from r and writing to w
+// Either r or w can be nil if the framer is used only in one direction.
+func NewFramer(r io.Reader, w io.Writer) *Framer {
+	f := &Framer{
+		w:            w,
+		MaxFrameSize: DefaultMaxFrameSize,
+		Codec:        DefaultCodec,
+	}
+	if r != nil {
+		f.r = bufio.NewReader(r)
+	}
+	if d, ok := r.(readDeadliner); ok {
+		f.setReadDeadline = d.SetReadDeadline
+	}
+	if d, ok := w.(writeDeadliner); ok {
+		f.setWriteDeadline = d.SetWriteDeadline
+	}
+	return f
+}
+
+// ReadFrame reads the next frame content
+// Returns io.EOF if the stream ends cleanly between frames,
+// io.ErrUnexpectedEOF if it ends in the middle of a frame
+// and FrameTooLargeError if the peer announces a frame larger than MaxFrameSize.
+func (f *Framer) ReadFrame() ([]byte, error) {
+	return readFrame(f.r, f.MaxFrameSize)
+}
+
+// WriteFrame writes the content as a single frame
+func (f *Framer) WriteFrame(content []byte) error {
+	if uint64(len(content)) > uint64(f.MaxFrameSize) {
+		return FrameTooLargeError
+	}
+	return writeFrame(f.w, content)
+}
+
+// ReadMessage reads the next frame and decodes it into proto Message
+// With RequireHello returns HelloRequiredError if the first message isn't Hello or HelloResponse
+// and UnexpectedHelloError if the hello is repeated.
+func (f *Framer) ReadMessage() (proto.Message, error) {
+	_, msg, err := f.ReadStreamMessage()
+	return msg, err
+}
+
+// ReadStreamMessage reads the next frame and decodes it into proto Message and its stream id
+// returns StreamAbortedError with the stream id if the peer aborted the stream,
+// the hello is checked as in ReadMessage.
+func (f *Framer) ReadStreamMessage() (stream uint32, msg proto.Message, err error) {
+	in, err := f.ReadFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+	stream, msg, err = f.Codec.DecodeStream(in)
+	if !f.RequireHello || (err != nil && !errors.Is(err, StreamAbortedError)) {
+		return stream, msg, err
+	}
+
+	switch msg.(type) {
+	case *zkp_pb.Hello, *zkp_pb.HelloResponse:
+		if f.hello {
+			return 0, nil, UnexpectedHelloError
+		}
+		f.hello = true
+	default:
+		if !f.hello {
+			return 0, nil, HelloRequiredError
+		}
+	}
+	return stream, msg, err
+}
+
+// SendMessage encodes the proto Message and writes it as a single frame
+func (f *Framer) SendMessage(message proto.Message) error {
+	return f.SendStreamMessage(0, message)
+}
+
+// SendStreamMessage encodes the proto Message of the stream and writes it as a single frame
+// A nil message aborts the stream.
+func (f *Framer) SendStreamMessage(stream uint32, message proto.Message) error {
+	out, err := f.Codec.EncodeStream(stream, message)
+	if err != nil {
+		return err
+	}
+	return f.WriteFrame(out)
+}
+
+// readFrame reads exactly one frame from r without reading ahead
+func readFrame(r io.Reader, maxSize uint32) ([]byte, error) {
+	var header [FrameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		// io.ReadFull returns io.EOF only if no bytes were read
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[:])
+	if size > maxSize {
+		return nil, fmt.Errorf("%w: %d > %d", FrameTooLargeError, size, maxSize)
+	}
+
+	content := make([]byte, size)
+	if _, err := io.ReadFull(r, content); err != nil {
+		if err == io.EOF {
+			// the header was already received
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+// writeFrame writes the header and the content with a single write
+// so the frame is never interleaved with concurrent writers
+func writeFrame(w io.Writer, content []byte) error {
+	out := make([]byte, FrameHeaderSize+len(content))
+	binary.LittleEndian.PutUint32(out, uint32(len(content)))
+	copy(out[FrameHeaderSize:], content)
+	_, err := w.Write(out)
+	return err
+}
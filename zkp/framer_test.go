@@ -0,0 +1,276 @@
+package zkp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// testPackets are the legacy envelopes followed by the frames
+var testPackets = []string{
+	"register_request_packet.bin",
+	"register_response_packet.bin",
+	"register_response_packet-user_exists_error.bin",
+	"auth_request_packet.bin",
+	"challenge_response_packet.bin",
+	"answer_request_packet.bin",
+	"auth_response_packet.bin",
+	"hello_frame.bin",
+	"register_request_frame.bin",
+	"register_response_frame.bin",
+	"register_response_frame-user_exists_error.bin",
+	"auth_request_frame.bin",
+	"challenge_response_frame.bin",
+	"answer_request_frame.bin",
+	"auth_response_frame.bin",
+}
+
+// chunkReader returns the data in chunks of the given sizes
+type chunkReader struct {
+	data   []byte
+	chunks []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := len(r.data)
+	if len(r.chunks) > 0 {
+		// chunk of size 0 is read as 1 byte
+		n = int(r.chunks[0]) + 1
+		r.chunks = r.chunks[1:]
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// readTestPackets returns all testdata packets as a single stream and the expected frame contents
+func readTestPackets(tb testing.TB) (stream []byte, frames [][]byte) {
+	for _, name := range testPackets {
+		data, err := ioutil.ReadFile(path.Join("testdata/", name))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		stream = append(stream, data...)
+		frames = append(frames, data[zkp.FrameHeaderSize:])
+	}
+	return stream, frames
+}
+
+func TestFramer_ReadFrame(t *testing.T) {
+	assert := assert.New(t)
+	stream, frames := readTestPackets(t)
+
+	tests := map[string]struct {
+		chunks []byte
+	}{
+		"coalesced messages": {
+			chunks: nil,
+		},
+		"byte by byte": {
+			chunks: bytes.Repeat([]byte{0}, len(stream)),
+		},
+		"partial headers": {
+			chunks: []byte{1, 2, 0, 100, 2, 250},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			framer := zkp.NewFramer(&chunkReader{data: stream, chunks: test.chunks}, nil)
+			for _, expected := range frames {
+				frame, err := framer.ReadFrame()
+				assert.NoError(err)
+				assert.Equal(expected, frame)
+			}
+			_, err := framer.ReadFrame()
+			assert.ErrorIs(err, io.EOF)
+		})
+	}
+}
+
+func TestFramer_ReadFrame_Errors(t *testing.T) {
+	assert := assert.New(t)
+	stream, _ := readTestPackets(t)
+
+	tests := map[string]struct {
+		input         []byte
+		maxFrameSize  uint32
+		expectedError error
+	}{
+		"truncated header": {
+			input:         stream[:2],
+			maxFrameSize:  zkp.DefaultMaxFrameSize,
+			expectedError: io.ErrUnexpectedEOF,
+		},
+		"truncated content": {
+			input:         stream[:10],
+			maxFrameSize:  zkp.DefaultMaxFrameSize,
+			expectedError: io.ErrUnexpectedEOF,
+		},
+		"header only": {
+			input:         stream[:zkp.FrameHeaderSize],
+			maxFrameSize:  zkp.DefaultMaxFrameSize,
+			expectedError: io.ErrUnexpectedEOF,
+		},
+		"frame too large": {
+			input:         stream,
+			maxFrameSize:  10,
+			expectedError: zkp.FrameTooLargeError,
+		},
+		"huge announced size": {
+			input:         []byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3},
+			maxFrameSize:  zkp.DefaultMaxFrameSize,
+			expectedError: zkp.FrameTooLargeError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			framer := zkp.NewFramer(bytes.NewReader(test.input), nil)
+			framer.MaxFrameSize = test.maxFrameSize
+			_, err := framer.ReadFrame()
+			assert.ErrorIs(err, test.expectedError)
+		})
+	}
+}
+
+func TestFramer_WriteFrame(t *testing.T) {
+	assert := assert.New(t)
+	stream, frames := readTestPackets(t)
+
+	var out bytes.Buffer
+	framer := zkp.NewFramer(nil, &out)
+	for _, frame := range frames {
+		assert.NoError(framer.WriteFrame(frame))
+	}
+	assert.Equal(stream, out.Bytes())
+
+	framer.MaxFrameSize = 1
+	assert.ErrorIs(framer.WriteFrame([]byte{1, 2}), zkp.FrameTooLargeError)
+}
+
+// newTestFramer returns the framer reading the sent messages
+func newTestFramer(t *testing.T, messages ...proto.Message) *zkp.Framer {
+	var buffer bytes.Buffer
+	for _, message := range messages {
+		if err := zkp.SendMessage(&buffer, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return zkp.NewFramer(&buffer, nil)
+}
+
+func TestFramer_RequireHello(t *testing.T) {
+	hello := &zkp_pb.Hello{Versions: []uint32{zkp.ProtocolVersion}}
+	request := &zkp_pb.AuthRequest{User: "max"}
+
+	t.Run("hello first", func(t *testing.T) {
+		assert := assert.New(t)
+		framer := newTestFramer(t, hello, request, hello)
+		framer.RequireHello = true
+		_, err := framer.ReadMessage()
+		assert.NoError(err)
+		_, err = framer.ReadMessage()
+		assert.NoError(err)
+		_, err = framer.ReadMessage()
+		assert.ErrorIs(err, zkp.UnexpectedHelloError)
+	})
+
+	t.Run("request first", func(t *testing.T) {
+		assert := assert.New(t)
+		framer := newTestFramer(t, request)
+		framer.RequireHello = true
+		_, err := framer.ReadMessage()
+		assert.ErrorIs(err, zkp.HelloRequiredError)
+	})
+
+	t.Run("hello response first", func(t *testing.T) {
+		assert := assert.New(t)
+		framer := newTestFramer(t, &zkp_pb.HelloResponse{Result: true}, &zkp_pb.AuthResponse{})
+		framer.RequireHello = true
+		_, err := framer.ReadMessage()
+		assert.NoError(err)
+		_, err = framer.ReadMessage()
+		assert.NoError(err)
+	})
+
+	t.Run("not required", func(t *testing.T) {
+		assert := assert.New(t)
+		framer := newTestFramer(t, request)
+		_, err := framer.ReadMessage()
+		assert.NoError(err)
+	})
+}
+
+func FuzzFramer_Chunking(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{3, 80, 1, 255, 7})
+	stream, frames := readTestPackets(f)
+
+	f.Fuzz(func(t *testing.T, chunks []byte) {
+		framer := zkp.NewFramer(&chunkReader{data: stream, chunks: chunks}, nil)
+		for i, expected := range frames {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				t.Fatalf("frame %d: %v", i, err)
+			}
+			if !bytes.Equal(expected, frame) {
+				t.Fatalf("frame %d: got %x, expected %x", i, frame, expected)
+			}
+		}
+		if _, err := framer.ReadFrame(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+	})
+}
+
+func FuzzFramer_Stream(f *testing.F) {
+	for _, name := range testPackets {
+		data, err := ioutil.ReadFile(path.Join("testdata/", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data, []byte{})
+		f.Add(data[:len(data)/2], []byte{1, 2})
+	}
+
+	f.Fuzz(func(t *testing.T, stream []byte, chunks []byte) {
+		framer := zkp.NewFramer(&chunkReader{data: stream, chunks: chunks}, nil)
+		framer.MaxFrameSize = 1024
+		consumed := 0
+		for {
+			frame, err := framer.ReadFrame()
+			if err == io.EOF {
+				if consumed != len(stream) {
+					t.Fatalf("io.EOF after %d of %d bytes", consumed, len(stream))
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+			if size := binary.LittleEndian.Uint32(stream[consumed:]); int(size) != len(frame) {
+				t.Fatalf("frame size %d, header %d", len(frame), size)
+			}
+			consumed += zkp.FrameHeaderSize + len(frame)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package zkp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// grpcServerConn adapts the server side of the authentication stream to MessageConn
+	grpcServerConn struct {
+		stream zkp_pb.ZKPAuth_AuthenticateServer
+	}
+
+	// grpcClientConn adapts the client side of the authentication stream to MessageConn
+	grpcClientConn struct {
+		stream zkp_pb.ZKPAuth_AuthenticateClient
+	}
+)
+
+// NewGRPCServerConn returns MessageConn on top of the server authentication stream
+func NewGRPCServerConn(stream zkp_pb.ZKPAuth_AuthenticateServer) MessageConn {
+	return &grpcServerConn{stream: stream}
+}
+
+// NewGRPCClientConn returns MessageConn on top of the client authentication stream
+func NewGRPCClientConn(stream zkp_pb.ZKPAuth_AuthenticateClient) MessageConn {
+	return &grpcClientConn{stream: stream}
+}
+
+// ReadMessageContext receives AuthRequest or AnswerRequest from the stream
+func (c *grpcServerConn) ReadMessageContext(ctx context.Context) (proto.Message, error) {
+	return streamContext(ctx, func() (proto.Message, error) {
+		request, err := c.stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		switch m := request.GetMessage().(type) {
+		case *zkp_pb.AuthStreamRequest_Auth:
+			return m.Auth, nil
+		case *zkp_pb.AuthStreamRequest_Answer:
+			return m.Answer, nil
+		}
+		return nil, EmptyEnvelopeError
+	})
+}
+
+// SendMessageContext sends ChallengeResponse or AuthResponse to the stream
+func (c *grpcServerConn) SendMessageContext(ctx context.Context, message proto.Message) error {
+	response := &zkp_pb.AuthStreamResponse{}
+	switch m := message.(type) {
+	case *zkp_pb.ChallengeResponse:
+		response.Message = &zkp_pb.AuthStreamResponse_Challenge{Challenge: m}
+	case *zkp_pb.AuthResponse:
+		response.Message = &zkp_pb.AuthStreamResponse_Result{Result: m}
+	default:
+		return fmt.Errorf("%w: %q", UnknownMessageError, MessageName(message))
+	}
+	_, err := streamContext(ctx, func() (proto.Message, error) {
+		return nil, c.stream.Send(response)
+	})
+	return err
+}
+
+// ReadMessageContext receives ChallengeResponse or AuthResponse from the stream
+func (c *grpcClientConn) ReadMessageContext(ctx context.Context) (proto.Message, error) {
+	return streamContext(ctx, func() (proto.Message, error) {
+		response, err := c.stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		switch m := response.GetMessage().(type) {
+		case *zkp_pb.AuthStreamResponse_Challenge:
+			return m.Challenge, nil
+		case *zkp_pb.AuthStreamResponse_Result:
+			return m.Result, nil
+		}
+		return nil, EmptyEnvelopeError
+	})
+}
+
+// SendMessageContext sends AuthRequest or AnswerRequest to the stream
+func (c *grpcClientConn) SendMessageContext(ctx context.Context, message proto.Message) error {
+	request := &zkp_pb.AuthStreamRequest{}
+	switch m := message.(type) {
+	case *zkp_pb.AuthRequest:
+		request.Message = &zkp_pb.AuthStreamRequest_Auth{Auth: m}
+	case *zkp_pb.AnswerRequest:
+		request.Message = &zkp_pb.AuthStreamRequest_Answer{Answer: m}
+	default:
+		return fmt.Errorf("%w: %q", UnknownMessageError, MessageName(message))
+	}
+	_, err := streamContext(ctx, func() (proto.Message, error) {
+		return nil, c.stream.Send(request)
+	})
+	return err
+}
+
+// streamContext runs the blocking stream operation until it completes or the context is done
+// The abandoned operation completes once the stream is closed by the caller.
+func streamContext(ctx context.Context, op func() (proto.Message, error)) (proto.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		msg proto.Message
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := op()
+		done <- result{msg: msg, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.msg, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,186 @@
+package zkp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+)
+
+// ProtocolVersion is the current version of the envelope protocol
+const ProtocolVersion = 1
+
+// Group names identify the public group parameters
+const (
+	// GroupToy is the group defined by P, G, H and Q constants
+	GroupToy = "toy-p23-q11"
+)
+
+// Proof modes
+const (
+	// ProofInteractive is the challenge-response authentication
+	ProofInteractive = "interactive"
+)
+
+// Key derivation functions turning the password into the secret
+const (
+	// KDFNone uses the password number as the secret
+	KDFNone = "none"
+)
+
+var (
+	HelloRequiredError   = errors.New("hello required")
+	UnexpectedHelloError = errors.New("unexpected hello")
+	NegotiationError     = errors.New("protocol negotiation failed")
+)
+
+type (
+	// Capabilities lists the supported protocol parameters in the order of preference
+	Capabilities struct {
+		Versions   []uint32
+		Groups     []string
+		ProofModes []string
+		KDFs       []string
+	}
+)
+
+// DefaultCapabilities are the protocol parameters implemented by this package
+// The peers offer no other values, the authentication runs with these only.
+var DefaultCapabilities = Capabilities{
+	Versions:   []uint32{ProtocolVersion},
+	Groups:     []string{GroupToy},
+	ProofModes: []string{ProofInteractive},
+	KDFs:       []string{KDFNone},
+}
+
+// Hello returns the message opening the connection with the capabilities
+func (c Capabilities) Hello() *zkp_pb.Hello {
+	return &zkp_pb.Hello{
+		Versions:   c.Versions,
+		Groups:     c.Groups,
+		ProofModes: c.ProofModes,
+		Kdfs:       c.KDFs,
+	}
+}
+
+// Implemented returns the capabilities without the values missing in DefaultCapabilities, in the same order
+func (c Capabilities) Implemented() Capabilities {
+	implemented := Capabilities{
+		Groups:     filter(c.Groups, DefaultCapabilities.Groups),
+		ProofModes: filter(c.ProofModes, DefaultCapabilities.ProofModes),
+		KDFs:       filter(c.KDFs, DefaultCapabilities.KDFs),
+	}
+	for _, v := range c.Versions {
+		if containsVersion(DefaultCapabilities.Versions, v) {
+			implemented.Versions = append(implemented.Versions, v)
+		}
+	}
+	return implemented
+}
+
+// Negotiate chooses the parameters supported by both sides
+// The highest common version is chosen, other parameters follow the server preference.
+// On mismatch returns the failed response to send to the client and NegotiationError.
+func (c Capabilities) Negotiate(hello *zkp_pb.Hello) (*zkp_pb.HelloResponse, error) {
+	response := &zkp_pb.HelloResponse{}
+	var err error
+	if response.Version, err = chooseVersion(c.Versions, hello.GetVersions()); err != nil {
+		return failedHello(err)
+	}
+	if response.Group, err = choose("group", c.Groups, hello.GetGroups()); err != nil {
+		return failedHello(err)
+	}
+	if response.ProofMode, err = choose("proof mode", c.ProofModes, hello.GetProofModes()); err != nil {
+		return failedHello(err)
+	}
+	if response.Kdf, err = choose("kdf", c.KDFs, hello.GetKdfs()); err != nil {
+		return failedHello(err)
+	}
+	response.Result = true
+	return response, nil
+}
+
+// Check verifies the server accepted the hello and chose the offered parameters
+func (c Capabilities) Check(response *zkp_pb.HelloResponse) error {
+	if !response.GetResult() {
+		return fmt.Errorf("%w: %s", NegotiationError, response.GetError())
+	}
+	if !containsVersion(c.Versions, response.GetVersion()) {
+		return fmt.Errorf("%w: server chose unsupported version %d", NegotiationError, response.GetVersion())
+	}
+	for _, chosen := range []struct {
+		name      string
+		supported []string
+		value     string
+	}{
+		{"group", c.Groups, response.GetGroup()},
+		{"proof mode", c.ProofModes, response.GetProofMode()},
+		{"kdf", c.KDFs, response.GetKdf()},
+	} {
+		if !contains(chosen.supported, chosen.value) {
+			return fmt.Errorf("%w: server chose unsupported %s %q", NegotiationError, chosen.name, chosen.value)
+		}
+	}
+	return nil
+}
+
+// chooseVersion returns the highest version supported by both sides
+func chooseVersion(supported, offered []uint32) (uint32, error) {
+	var version uint32
+	for _, v := range offered {
+		if v > version && containsVersion(supported, v) {
+			version = v
+		}
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("%w: no common version, supported %v", NegotiationError, supported)
+	}
+	return version, nil
+}
+
+// choose returns the first supported value offered by the peer
+func choose(name string, supported, offered []string) (string, error) {
+	for _, value := range supported {
+		if contains(offered, value) {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no common %s, supported %q", NegotiationError, name, supported)
+}
+
+func failedHello(err error) (*zkp_pb.HelloResponse, error) {
+	return &zkp_pb.HelloResponse{
+		Result: false,
+		Error:  err.Error(),
+		Code:   zkp_pb.ErrorCode_UNSUPPORTED_VERSION,
+	}, err
+}
+
+func containsVersion(versions []uint32, version uint32) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the values found in allowed
+func filter(values, allowed []string) []string {
+	var found []string
+	for _, v := range values {
+		if contains(allowed, v) {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
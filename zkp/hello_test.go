@@ -0,0 +1,119 @@
+package zkp_test
+
+import (
+	"testing"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities_Negotiate(t *testing.T) {
+	server := zkp.Capabilities{
+		Versions:   []uint32{1, 2},
+		Groups:     []string{"b", "a"},
+		ProofModes: []string{"non-interactive", zkp.ProofInteractive},
+		KDFs:       []string{zkp.KDFNone},
+	}
+
+	tests := []struct {
+		name     string
+		hello    *zkp_pb.Hello
+		expected *zkp_pb.HelloResponse
+	}{
+		{
+			name: "server preference",
+			hello: &zkp_pb.Hello{
+				Versions:   []uint32{1, 2, 3},
+				Groups:     []string{"a", "b"},
+				ProofModes: []string{zkp.ProofInteractive, "non-interactive"},
+				Kdfs:       []string{zkp.KDFNone},
+			},
+			expected: &zkp_pb.HelloResponse{
+				Result:    true,
+				Version:   2,
+				Group:     "b",
+				ProofMode: "non-interactive",
+				Kdf:       zkp.KDFNone,
+			},
+		},
+		{
+			name: "single option",
+			hello: &zkp_pb.Hello{
+				Versions:   []uint32{1},
+				Groups:     []string{"a"},
+				ProofModes: []string{zkp.ProofInteractive},
+				Kdfs:       []string{zkp.KDFNone},
+			},
+			expected: &zkp_pb.HelloResponse{
+				Result:    true,
+				Version:   1,
+				Group:     "a",
+				ProofMode: zkp.ProofInteractive,
+				Kdf:       zkp.KDFNone,
+			},
+		},
+		{name: "no common version", hello: &zkp_pb.Hello{
+			Versions: []uint32{3}, Groups: []string{"a"}, ProofModes: []string{zkp.ProofInteractive}, Kdfs: []string{zkp.KDFNone},
+		}},
+		{name: "no common group", hello: &zkp_pb.Hello{
+			Versions: []uint32{1}, Groups: []string{"c"}, ProofModes: []string{zkp.ProofInteractive}, Kdfs: []string{zkp.KDFNone},
+		}},
+		{name: "no common proof mode", hello: &zkp_pb.Hello{
+			Versions: []uint32{1}, Groups: []string{"a"}, ProofModes: []string{"other"}, Kdfs: []string{zkp.KDFNone},
+		}},
+		{name: "no common kdf", hello: &zkp_pb.Hello{
+			Versions: []uint32{1}, Groups: []string{"a"}, ProofModes: []string{zkp.ProofInteractive},
+		}},
+		{name: "empty hello", hello: &zkp_pb.Hello{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			response, err := server.Negotiate(test.hello)
+			if test.expected == nil {
+				assert.ErrorIs(err, zkp.NegotiationError)
+				assert.False(response.Result)
+				assert.Equal(err.Error(), response.Error)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(test.expected.String(), response.String())
+		})
+	}
+}
+
+func TestCapabilities_Check(t *testing.T) {
+	assert := assert.New(t)
+	client := zkp.DefaultCapabilities
+
+	response, err := zkp.DefaultCapabilities.Negotiate(client.Hello())
+	assert.NoError(err)
+	assert.NoError(client.Check(response))
+
+	// rejected by the server
+	err = client.Check(&zkp_pb.HelloResponse{Error: "no common version"})
+	assert.ErrorIs(err, zkp.NegotiationError)
+
+	// the server chose parameters the client didn't offer
+	unsupported := []*zkp_pb.HelloResponse{
+		{Result: true, Version: 2, Group: zkp.GroupToy, ProofMode: zkp.ProofInteractive, Kdf: zkp.KDFNone},
+		{Result: true, Version: 1, Group: "other", ProofMode: zkp.ProofInteractive, Kdf: zkp.KDFNone},
+		{Result: true, Version: 1, Group: zkp.GroupToy, ProofMode: "non-interactive", Kdf: zkp.KDFNone},
+		{Result: true, Version: 1, Group: zkp.GroupToy, ProofMode: zkp.ProofInteractive},
+	}
+	for _, response := range unsupported {
+		assert.ErrorIs(client.Check(response), zkp.NegotiationError, response.String())
+	}
+}
+
+func TestCapabilities_Implemented(t *testing.T) {
+	offered := zkp.Capabilities{
+		Versions:   []uint32{zkp.ProtocolVersion + 1, zkp.ProtocolVersion},
+		Groups:     []string{"other", zkp.GroupToy},
+		ProofModes: []string{"non-interactive", zkp.ProofInteractive},
+		KDFs:       []string{"argon2", zkp.KDFNone},
+	}
+	assert.Equal(t, zkp.DefaultCapabilities, offered.Implemented())
+}
@@ -0,0 +1,18 @@
+package zkp
+
+import (
+	"log"
+
+	"github.com/mindaugasrukas/zkp_example/zkp/algorithm"
+	"github.com/mindaugasrukas/zkp_example/zkp/pedersen"
+)
+
+// Logger prints the protocol values computed by the package, the standard logger by default
+var Logger = log.Default()
+
+// SetLogger replaces the logger of the package and of the proof packages it uses
+func SetLogger(logger *log.Logger) {
+	Logger = logger
+	pedersen.Logger = logger
+	algorithm.Logger = logger
+}
@@ -0,0 +1,340 @@
+package zkp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxStreams is the number of streams open at once allowed by NewClientMux and NewServerMux
+const DefaultMaxStreams = 64
+
+// streamQueue is the number of received messages waiting to be read from the stream
+// A protocol exchange has at most one message in flight in each direction,
+// the stream receiving more is aborted with StreamOverflowError.
+const streamQueue = 4
+
+var (
+	TooManyStreamsError = errors.New("too many streams")
+	MuxClosedError      = errors.New("multiplexed connection closed")
+	StreamOverflowError = errors.New("stream queue full")
+)
+
+type (
+	// Mux multiplexes concurrent exchanges over one connection
+	//
+	// Each frame carries the id of the stream it belongs to.
+	// The client opens a stream by sending its first message with a new id,
+	// the server accepts it and both sides exchange the messages of the stream in order.
+	// A stream is closed locally when the exchange is done, or aborted telling the peer to give up.
+	// Any connection error fails all streams.
+	Mux struct {
+		framer *Framer
+		closer io.Closer
+		// MaxStreams limits the streams open at once
+		// The peer exceeding it fails the connection, Open returns TooManyStreamsError.
+		// Set it before the first stream is opened.
+		MaxStreams int
+		// serializes the frame writes
+		writeMu sync.Mutex
+
+		mu      sync.Mutex
+		streams map[uint32]*Stream
+		// last stream id opened by the client
+		lastID uint32
+		// accepted streams, nil on the client side
+		accept chan *Stream
+
+		// closed when the connection fails, err tells why
+		done     chan struct{}
+		err      error
+		failOnce sync.Once
+	}
+
+	// Stream is a single exchange of the multiplexed connection
+	// It implements MessageConn, so the protocol flow is the same as over a dedicated connection.
+	Stream struct {
+		ID  uint32
+		mux *Mux
+		in  chan proto.Message
+		// closed when the stream is closed locally
+		closed    chan struct{}
+		closeOnce sync.Once
+		// closed when the peer aborts the stream
+		aborted   chan struct{}
+		abortOnce sync.Once
+		// closed when the stream queue overflows
+		overflowed   chan struct{}
+		overflowOnce sync.Once
+	}
+)
+
+// NewClientMux starts reading the connection, the streams are opened with Open
+// The hello must be exchanged before, closer closes the connection.
+func NewClientMux(framer *Framer, closer io.Closer) *Mux {
+	return newMux(framer, closer, nil)
+}
+
+// NewServerMux starts reading the connection, the streams opened by the peer are returned by Accept
+// The hello must be exchanged before, closer closes the connection.
+func NewServerMux(framer *Framer, closer io.Closer) *Mux {
+	return newMux(framer, closer, make(chan *Stream))
+}
+
+func newMux(framer *Framer, closer io.Closer, accept chan *Stream) *Mux {
+	if framer.setReadDeadline != nil {
+		// the streams apply their own deadlines
+		framer.setReadDeadline(time.Time{})
+	}
+	m := &Mux{
+		framer:     framer,
+		closer:     closer,
+		MaxStreams: DefaultMaxStreams,
+		streams:    make(map[uint32]*Stream),
+		accept:     accept,
+		done:       make(chan struct{}),
+	}
+	go m.readLoop()
+	return m
+}
+
+// Open opens a new stream
+// returns the connection error if the connection failed.
+func (m *Mux) Open() (*Stream, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.streams) >= m.MaxStreams {
+		return nil, TooManyStreamsError
+	}
+	m.lastID++
+	return m.newStream(m.lastID), nil
+}
+
+// Accept waits for the next stream opened by the peer
+// Its first message is ready to be read. Returns io.EOF if the peer closed the connection.
+func (m *Mux) Accept(ctx context.Context) (*Stream, error) {
+	select {
+	case stream := <-m.accept:
+		return stream, nil
+	case <-m.done:
+		return nil, m.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Streams returns the number of open streams
+func (m *Mux) Streams() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.streams)
+}
+
+// Err returns the error failing the connection, nil while it works
+func (m *Mux) Err() error {
+	select {
+	case <-m.done:
+		return m.err
+	default:
+		return nil
+	}
+}
+
+// Close closes the connection failing all open streams
+func (m *Mux) Close() error {
+	m.fail(MuxClosedError)
+	return nil
+}
+
+// fail records the first error and closes the connection
+func (m *Mux) fail(err error) {
+	m.failOnce.Do(func() {
+		m.err = err
+		close(m.done)
+		m.closer.Close()
+	})
+}
+
+// newStream registers the stream, the caller holds the lock
+func (m *Mux) newStream(id uint32) *Stream {
+	stream := &Stream{
+		ID:         id,
+		mux:        m,
+		in:         make(chan proto.Message, streamQueue),
+		closed:     make(chan struct{}),
+		aborted:    make(chan struct{}),
+		overflowed: make(chan struct{}),
+	}
+	m.streams[id] = stream
+	return stream
+}
+
+// readLoop delivers the received messages to their streams until the connection fails
+func (m *Mux) readLoop() {
+	for {
+		id, msg, err := m.framer.ReadStreamMessage()
+		aborted := errors.Is(err, StreamAbortedError)
+		if err != nil && !aborted {
+			m.fail(err)
+			return
+		}
+
+		stream, err := m.stream(id, aborted)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		if stream == nil {
+			// the stream is already closed locally
+			continue
+		}
+		if aborted {
+			stream.abort()
+			continue
+		}
+		select {
+		case <-stream.overflowed:
+			// the messages of the aborted stream are dropped
+			continue
+		default:
+		}
+		select {
+		case stream.in <- msg:
+		case <-stream.closed:
+		default:
+			// the stream not reading its messages doesn't stall the other streams
+			stream.overflow()
+		}
+	}
+}
+
+// stream returns the open stream by id, accepting the new one on the server side
+// returns nil if the message doesn't belong to any stream.
+func (m *Mux) stream(id uint32, aborted bool) (*Stream, error) {
+	m.mu.Lock()
+	stream, ok := m.streams[id]
+	if ok || m.accept == nil || aborted {
+		m.mu.Unlock()
+		return stream, nil
+	}
+	if len(m.streams) >= m.MaxStreams {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %d", TooManyStreamsError, m.MaxStreams)
+	}
+	stream = m.newStream(id)
+	m.mu.Unlock()
+
+	select {
+	case m.accept <- stream:
+		return stream, nil
+	case <-m.done:
+		return nil, m.err
+	}
+}
+
+// ReadMessageContext waits for the next message of the stream
+// returns StreamAbortedError if the peer aborted the stream
+// and StreamOverflowError if the peer sent more messages than the stream queue holds.
+func (s *Stream) ReadMessageContext(ctx context.Context) (proto.Message, error) {
+	select {
+	case <-s.overflowed:
+		return nil, StreamOverflowError
+	default:
+	}
+	select {
+	case <-s.overflowed:
+		return nil, StreamOverflowError
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.aborted:
+		// the messages received before the abort are still delivered
+		select {
+		case msg := <-s.in:
+			return msg, nil
+		default:
+			return nil, StreamAbortedError
+		}
+	case <-s.closed:
+		return nil, MuxClosedError
+	case <-s.mux.done:
+		// the messages received before the connection closed are still delivered,
+		// e.g. the last response of the server shutting down
+		select {
+		case msg := <-s.in:
+			return msg, nil
+		default:
+			return nil, s.mux.err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SendMessageContext sends the message of the stream
+// A failed write fails the connection, as the peer can't find the next frame.
+func (s *Stream) SendMessageContext(ctx context.Context, message proto.Message) error {
+	return s.mux.send(ctx, s.ID, message)
+}
+
+// Close closes the stream locally, the messages received later are dropped
+func (s *Stream) Close() {
+	s.closeOnce.Do(func() {
+		s.mux.mu.Lock()
+		if s.mux.streams[s.ID] == s {
+			delete(s.mux.streams, s.ID)
+		}
+		s.mux.mu.Unlock()
+		close(s.closed)
+	})
+}
+
+// Abort tells the peer to give up the stream and closes it
+func (s *Stream) Abort(ctx context.Context) error {
+	defer s.Close()
+	return s.mux.send(ctx, s.ID, nil)
+}
+
+// abort marks the stream aborted by the peer
+func (s *Stream) abort() {
+	s.abortOnce.Do(func() {
+		close(s.aborted)
+	})
+}
+
+// overflow fails the stream with the full queue and tells the peer to give it up
+// The abort is written in the background, the read loop doesn't wait for the write.
+func (s *Stream) overflow() {
+	s.overflowOnce.Do(func() {
+		close(s.overflowed)
+		go s.mux.send(context.Background(), s.ID, nil)
+	})
+}
+
+// send writes the stream message, nil aborts the stream
+func (m *Mux) send(ctx context.Context, id uint32, message proto.Message) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	if err := m.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := m.framer.SendStreamMessageContext(ctx, id, message)
+	if errors.Is(err, UnknownMessageError) || errors.Is(err, FrameTooLargeError) {
+		// nothing was written
+		return err
+	}
+	if err != nil {
+		m.fail(err)
+	}
+	return err
+}
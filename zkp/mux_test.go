@@ -0,0 +1,215 @@
+package zkp_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMuxes returns the client and the server ends of the multiplexed pipe
+func newTestMuxes(t *testing.T) (client, server *zkp.Mux) {
+	clientConn, serverConn := net.Pipe()
+	client = zkp.NewClientMux(zkp.NewFramer(clientConn, clientConn), clientConn)
+	server = zkp.NewServerMux(zkp.NewFramer(serverConn, serverConn), serverConn)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestMux_ConcurrentStreams(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	client, server := newTestMuxes(t)
+	const count = 10
+
+	// the server answers in the reverse order
+	go func() {
+		var streams []*zkp.Stream
+		for i := 0; i < count; i++ {
+			stream, err := server.Accept(ctx)
+			if err != nil {
+				return
+			}
+			streams = append(streams, stream)
+		}
+		for i := len(streams) - 1; i >= 0; i-- {
+			msg, err := streams[i].ReadMessageContext(ctx)
+			if err != nil {
+				return
+			}
+			user := msg.(*zkp_pb.AuthRequest).User
+			streams[i].SendMessageContext(ctx, &zkp_pb.AuthResponse{Detail: user})
+			streams[i].Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			stream, err := client.Open()
+			assert.NoError(err)
+			defer stream.Close()
+			assert.NoError(stream.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: user}))
+			msg, err := stream.ReadMessageContext(ctx)
+			assert.NoError(err)
+			assert.Equal(user, msg.(*zkp_pb.AuthResponse).GetDetail())
+		}(fmt.Sprintf("user-%d", i))
+	}
+	wg.Wait()
+	assert.Equal(0, client.Streams())
+}
+
+func TestMux_Abort(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	client, server := newTestMuxes(t)
+
+	stream, err := client.Open()
+	assert.NoError(err)
+	assert.NoError(stream.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"}))
+
+	accepted, err := server.Accept(ctx)
+	assert.NoError(err)
+	assert.Equal(stream.ID, accepted.ID)
+	assert.NoError(accepted.Abort(ctx))
+
+	_, err = stream.ReadMessageContext(ctx)
+	assert.ErrorIs(err, zkp.StreamAbortedError)
+	// the other streams still work
+	other, err := client.Open()
+	assert.NoError(err)
+	assert.NoError(other.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"}))
+	_, err = server.Accept(ctx)
+	assert.NoError(err)
+}
+
+func TestMux_TooManyStreams(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	client, server := newTestMuxes(t)
+	server.MaxStreams = 1
+
+	first, err := client.Open()
+	assert.NoError(err)
+	assert.NoError(first.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"}))
+	_, err = server.Accept(ctx)
+	assert.NoError(err)
+
+	second, err := client.Open()
+	assert.NoError(err)
+	assert.NoError(second.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"}))
+	_, err = server.Accept(ctx)
+	assert.ErrorIs(err, zkp.TooManyStreamsError)
+	// the connection is closed
+	_, err = first.ReadMessageContext(ctx)
+	assert.Error(err)
+
+	client, _ = newTestMuxes(t)
+	client.MaxStreams = 1
+	_, err = client.Open()
+	assert.NoError(err)
+	_, err = client.Open()
+	assert.ErrorIs(err, zkp.TooManyStreamsError)
+}
+
+func TestMux_Close(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	client, server := newTestMuxes(t)
+
+	stream, err := client.Open()
+	assert.NoError(err)
+	client.Close()
+	_, err = stream.ReadMessageContext(ctx)
+	assert.ErrorIs(err, zkp.MuxClosedError)
+	_, err = client.Open()
+	assert.ErrorIs(err, zkp.MuxClosedError)
+	assert.ErrorIs(stream.SendMessageContext(ctx, &zkp_pb.AuthRequest{}), zkp.MuxClosedError)
+
+	// the peer sees the connection closed
+	_, err = server.Accept(ctx)
+	assert.Error(err)
+}
+
+func TestMux_CloseAfterResponse(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		client, server := newTestMuxes(t)
+		go func() {
+			stream, err := server.Accept(ctx)
+			if err != nil {
+				return
+			}
+			stream.SendMessageContext(ctx, &zkp_pb.AuthResponse{Result: true})
+			server.Close()
+		}()
+
+		// the response sent before closing the connection is delivered
+		stream, err := client.Open()
+		assert.NoError(err)
+		assert.NoError(stream.SendMessageContext(ctx, &zkp_pb.AuthRequest{}))
+		<-waitClosed(client)
+		msg, err := stream.ReadMessageContext(ctx)
+		if assert.NoError(err) {
+			assert.True(msg.(*zkp_pb.AuthResponse).GetResult())
+		}
+	}
+}
+
+// waitClosed returns the channel closed when the connection fails
+func waitClosed(mux *zkp.Mux) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for mux.Err() == nil {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	return closed
+}
+
+func TestMux_Overflow(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, server := newTestMuxes(t)
+
+	// the stream not reading its messages
+	stalled, err := client.Open()
+	assert.NoError(err)
+	assert.NoError(stalled.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"}))
+	accepted, err := server.Accept(ctx)
+	assert.NoError(err)
+	for i := 0; i < 10; i++ {
+		assert.NoError(stalled.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "max"}))
+	}
+
+	// doesn't stall the other streams
+	other, err := client.Open()
+	assert.NoError(err)
+	assert.NoError(other.SendMessageContext(ctx, &zkp_pb.AuthRequest{User: "alice"}))
+	next, err := server.Accept(ctx)
+	assert.NoError(err)
+	msg, err := next.ReadMessageContext(ctx)
+	assert.NoError(err)
+	assert.Equal("alice", msg.(*zkp_pb.AuthRequest).GetUser())
+
+	// the overflowed stream fails on both sides
+	_, err = accepted.ReadMessageContext(ctx)
+	assert.ErrorIs(err, zkp.StreamOverflowError)
+	_, err = stalled.ReadMessageContext(ctx)
+	assert.ErrorIs(err, zkp.StreamAbortedError)
+	assert.NoError(server.Err())
+}
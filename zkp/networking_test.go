@@ -1,6 +1,7 @@
 package zkp_test
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net"
 	"os"
@@ -134,6 +135,26 @@ func TestReadMessage(t *testing.T) {
 				Challenge: []byte{1},
 			},
 		},
+		"RegisterRequest frame": {
+			input: "register_request_frame.bin",
+			expectedType: &zkp_pb.RegisterRequest{
+				User: "max",
+				Commits: []*zkp_pb.RegisterRequest_Commits{
+					{
+						Y1: []byte{0x10},
+						Y2: []byte{0xc},
+					},
+				},
+			},
+		},
+		"RegisterResponse-error frame": {
+			input: "register_response_frame-user_exists_error.bin",
+			expectedType: &zkp_pb.RegisterResponse{
+				Result: false,
+				Error:  "user already exists",
+				Code:   zkp_pb.ErrorCode_USER_EXISTS,
+			},
+		},
 		"AnswerRequest packet": {
 			input: "answer_request_packet.bin",
 			expectedType: &zkp_pb.AnswerRequest{
@@ -178,7 +199,7 @@ func TestSendMessage(t *testing.T) {
 		expectedBin string
 	}{
 		"RegisterRequest packet": {
-			expectedBin: "register_request_packet.bin",
+			expectedBin: "register_request_frame.bin",
 			message: &zkp_pb.RegisterRequest{
 				User: "max",
 				Commits: []*zkp_pb.RegisterRequest_Commits{
@@ -190,20 +211,21 @@ func TestSendMessage(t *testing.T) {
 			},
 		},
 		"RegisterResponse packet": {
-			expectedBin: "register_response_packet.bin",
+			expectedBin: "register_response_frame.bin",
 			message: &zkp_pb.RegisterResponse{
 				Result: true,
 			},
 		},
 		"RegisterResponse-error packet": {
-			expectedBin: "register_response_packet-user_exists_error.bin",
+			expectedBin: "register_response_frame-user_exists_error.bin",
 			message: &zkp_pb.RegisterResponse{
 				Result: false,
 				Error:  "user already exists",
+				Code:   zkp_pb.ErrorCode_USER_EXISTS,
 			},
 		},
 		"AuthRequest packet": {
-			expectedBin: "auth_request_packet.bin",
+			expectedBin: "auth_request_frame.bin",
 			message: &zkp_pb.AuthRequest{
 				User: "max",
 				Commits: []*zkp_pb.AuthRequest_Commits{
@@ -215,19 +237,19 @@ func TestSendMessage(t *testing.T) {
 			},
 		},
 		"ChallengeResponse packet": {
-			expectedBin: "challenge_response_packet.bin",
+			expectedBin: "challenge_response_frame.bin",
 			message: &zkp_pb.ChallengeResponse{
 				Challenge: []byte{1},
 			},
 		},
 		"AnswerRequest packet": {
-			expectedBin: "answer_request_packet.bin",
+			expectedBin: "answer_request_frame.bin",
 			message: &zkp_pb.AnswerRequest{
 				Answer: []byte{7},
 			},
 		},
 		"AuthResponse packet": {
-			expectedBin: "auth_response_packet.bin",
+			expectedBin: "auth_response_frame.bin",
 			message: &zkp_pb.AuthResponse{
 				Result: true,
 			},
@@ -257,3 +279,26 @@ func TestSendMessage(t *testing.T) {
 		})
 	}
 }
+
+func FuzzReadMessage(f *testing.F) {
+	for _, name := range testPackets {
+		data, err := ioutil.ReadFile(path.Join("testdata/", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := zkp.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			if msg != nil {
+				t.Fatalf("got message %v with error %v", msg, err)
+			}
+			return
+		}
+		if msg == nil {
+			t.Fatal("got nil message without error")
+		}
+	})
+}
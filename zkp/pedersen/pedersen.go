@@ -12,6 +12,9 @@ import (
 	"github.com/mindaugasrukas/zkp_example/zkp/algorithm"
 )
 
+// Logger prints the intermediate proof values
+var Logger = log.Default()
+
 // Prover proves the knowledge of (x, r) such that z = (g**x) * (h**r).
 type Prover struct {
 	P *big.Int      // Zp as Group
@@ -57,13 +60,13 @@ func (p *Prover) Commits() (y1 *big.Int, y2 *big.Int, err error) {
 
 	g := big.NewInt(0)
 	g.Exp(p.G, rx, p.P)
-	log.Print("g = ", p.G.Int64())
-	log.Print("g^rx = ", g.Int64())
+	Logger.Print("g = ", p.G.Int64())
+	Logger.Print("g^rx = ", g.Int64())
 
 	h := big.NewInt(0)
 	h.Exp(p.H, rr, p.P)
-	log.Print("h = ", p.H.Int64())
-	log.Print("h^rr = ", h.Int64())
+	Logger.Print("h = ", p.H.Int64())
+	Logger.Print("h^rr = ", h.Int64())
 
 	return g, h, nil
 }
@@ -126,7 +129,7 @@ func (v *Verifier) ConsumeVerify(comm []*big.Int, c *big.Int, resp []*big.Int) (
 	rc := comm[0]
 	remComm = comm[1:]
 
-	if rv.Cmp(rc) != 0 {
+	if rv == nil || rc == nil || rv.Cmp(rc) != 0 {
 		return
 	}
 	valid = true
@@ -145,7 +148,11 @@ func (v *Verifier) Verify(comm []*big.Int, c *big.Int, resp []*big.Int) bool {
 	return true
 }
 
+// RecoverCommitment returns nil if the response or the challenge is missing.
 func (v *Verifier) RecoverCommitment(c *big.Int, resp []*big.Int) (rc *big.Int, remResp []*big.Int) {
+	if c == nil || len(resp) < 2 || resp[0] == nil || resp[1] == nil {
+		return nil, resp
+	}
 	sx := resp[0]
 	sr := resp[1]
 	remResp = resp[2:]
@@ -177,7 +184,7 @@ func (v *Verifier) VerifySig(m *big.Int, resp []*big.Int) bool {
 
 	rv, remResp := v.RecoverCommitment(chlg, remResp)
 
-	if len(remResp) != 0 {
+	if rv == nil || len(remResp) != 0 {
 		return false
 	}
 
@@ -58,3 +58,55 @@ func TestZKPSanity(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifierMalformedResponse(t *testing.T) {
+	verifier := &Verifier{P: big.NewInt(127), G: big.NewInt(2), Q: big.NewInt(7), H: big.NewInt(4), Z: big.NewInt(16)}
+	comm := []*big.Int{big.NewInt(1)}
+	c := big.NewInt(1)
+
+	for _, resp := range [][]*big.Int{nil, {big.NewInt(1)}, {big.NewInt(1), nil}, {nil, big.NewInt(1), big.NewInt(1)}} {
+		if rc, _ := verifier.RecoverCommitment(c, resp); rc != nil {
+			t.Fatalf("recovered commitment %v from %v", rc, resp)
+		}
+		if verifier.Verify(comm, c, resp) {
+			t.Fatalf("verified %v", resp)
+		}
+		if verifier.VerifySig(c, resp) {
+			t.Fatalf("verified signature %v", resp)
+		}
+	}
+	if verifier.Verify([]*big.Int{nil}, c, []*big.Int{big.NewInt(1), big.NewInt(1)}) {
+		t.Fatal("verified missing commitment")
+	}
+	if verifier.Verify(comm, nil, []*big.Int{big.NewInt(1), big.NewInt(1)}) {
+		t.Fatal("verified missing challenge")
+	}
+}
+
+func FuzzVerifier(f *testing.F) {
+	f.Add([]byte{1}, []byte{1}, []byte{1, 2, 3}, uint8(2))
+	f.Add([]byte{}, []byte{}, []byte{}, uint8(0))
+	f.Add([]byte{1, 2}, []byte{3}, []byte{4, 5, 6, 7}, uint8(3))
+
+	f.Fuzz(func(t *testing.T, comm, c, resp []byte, n uint8) {
+		verifier := &Verifier{P: big.NewInt(127), G: big.NewInt(2), Q: big.NewInt(7), H: big.NewInt(4), Z: big.NewInt(16)}
+		commitments := splitNumbers(comm, 2)
+		challenge := new(big.Int).SetBytes(c)
+		responses := splitNumbers(resp, int(n%5))
+
+		verifier.Verify(commitments, challenge, responses)
+		verifier.VerifySig(challenge, responses)
+		if rc, rem := verifier.RecoverCommitment(challenge, responses); rc != nil && len(rem) != len(responses)-2 {
+			t.Fatalf("consumed %d of %d responses", len(responses)-len(rem), len(responses))
+		}
+	})
+}
+
+// splitNumbers splits data into n numbers of about the same size
+func splitNumbers(data []byte, n int) []*big.Int {
+	numbers := make([]*big.Int, n)
+	for i := range numbers {
+		numbers[i] = new(big.Int).SetBytes(data[len(data)*i/n : len(data)*(i+1)/n])
+	}
+	return numbers
+}
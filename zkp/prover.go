@@ -1,7 +1,6 @@
 package zkp
 
 import (
-	"log"
 	"math/big"
 
 	"github.com/mindaugasrukas/zkp_example/zkp/algorithm"
@@ -39,13 +38,13 @@ func NewProver(password int64) *PedersenProver {
 func (p *PedersenProver) CreateRegisterCommits() (*Commits, error) {
 	y1 := big.NewInt(0)
 	y1.Exp(p.G, p.X.Value, p.P)
-	log.Print("g = ", p.G)
-	log.Print("g^rx = ", y1)
+	Logger.Print("g = ", p.G)
+	Logger.Print("g^rx = ", y1)
 
 	y2 := big.NewInt(0)
 	y2.Exp(p.H, p.X.Value, p.P)
-	log.Print("h = ", p.H)
-	log.Print("h^rr = ", y2)
+	Logger.Print("h = ", p.H)
+	Logger.Print("h^rr = ", y2)
 
 	return &Commits{
 		C1: y1,
@@ -1,6 +1,8 @@
 package zkp_test
 
 import (
+	"bytes"
+	"log"
 	"math/big"
 	"testing"
 
@@ -17,6 +19,21 @@ func TestCreateRegisterCommits(t *testing.T) {
 	assert.Equal(int64(12), commits.C2.Int64())
 }
 
+func TestSetLogger(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	zkp.SetLogger(log.New(&buf, "", 0))
+	defer zkp.SetLogger(log.Default())
+	prover := zkp.NewProver(123)
+	_, err := prover.CreateRegisterCommits()
+	assert.NoError(err)
+	_, err = prover.CreateAuthenticationCommits()
+	assert.NoError(err)
+	prover.ProveAuthentication(big.NewInt(5))
+	assert.Contains(buf.String(), "g^rx = 16")
+	assert.Contains(buf.String(), "c = 5")
+}
+
 func TestCreateAuthenticationCommits(t *testing.T) {
 	assert := assert.New(t)
 	prover := zkp.NewProver(123)
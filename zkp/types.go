@@ -20,3 +20,8 @@ type (
 	// UUID is Unique User ID
 	UUID string
 )
+
+// valid tells whether both commits are present
+func (c *Commits) valid() bool {
+	return c != nil && c.C1 != nil && c.C2 != nil
+}
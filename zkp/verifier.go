@@ -3,7 +3,6 @@ package zkp
 import (
 	"crypto/rand"
 	"errors"
-	"log"
 	"math/big"
 
 	"github.com/mindaugasrukas/zkp_example/zkp/pedersen"
@@ -51,32 +50,37 @@ func (v *PedersenVerifier) CreateAuthenticationChallenge() (challenge *big.Int,
 // y1, y2 is client registered commits
 // r1, r2 is client authentication commits
 // r1 = g^s * y1^c  AND  r2 = h^s * y2^c
+// Missing commits or numbers fail the verification.
 func (v *PedersenVerifier) VerifyAuthentication(commits *Commits, authRequest *Commits, challenge, answer *big.Int) bool {
+	if !commits.valid() || !authRequest.valid() || challenge == nil || answer == nil {
+		return false
+	}
 	var y1, y2 big.Int
 
 	p := big.NewInt(P)
 	g := big.NewInt(G)
 	h := big.NewInt(H)
-	log.Printf("y1=%v, y2=%v, g=%v, h=%v, answer=%v, challenge=%v", commits.C1, commits.C2, g, h, answer, challenge)
+	Logger.Printf("y1=%v, y2=%v, g=%v, h=%v, answer=%v, challenge=%v", commits.C1, commits.C2, g, h, answer, challenge)
 
-	g.Exp(g, answer, nil)
-	y1.Exp(commits.C1, challenge, nil)
-	log.Printf("g^answer=%v, y1^challenge=%v", g, &y1)
+	// reduce mod p while exponentiating, the client controls the answer size
+	g.Exp(g, answer, p)
+	y1.Exp(commits.C1, challenge, p)
+	Logger.Printf("g^answer=%v, y1^challenge=%v", g, &y1)
 	var result1 big.Int
 	result1.Mul(g, &y1)
 	result1.Mod(&result1, p)
-	log.Print("result1: (g^answer)*(y1^challenge) = ", &result1)
+	Logger.Print("result1: (g^answer)*(y1^challenge) = ", &result1)
 
-	h.Exp(h, answer, nil)
-	y2.Exp(commits.C2, challenge, nil)
-	log.Printf("h^answer=%v, y2^challenge=%v", h, &y2)
+	h.Exp(h, answer, p)
+	y2.Exp(commits.C2, challenge, p)
+	Logger.Printf("h^answer=%v, y2^challenge=%v", h, &y2)
 	var result2 big.Int
 	result2.Mul(h, &y2)
 	result2.Mod(&result2, p)
-	log.Print("result2: (h^answer)*(y2^challenge) = ", &result2)
+	Logger.Print("result2: (h^answer)*(y2^challenge) = ", &result2)
 
-	log.Printf("r1=%v, r2=%v", authRequest.C1, authRequest.C2)
-	log.Printf("(result1==r1)=%v, (result2==r2)=%v", result1.Cmp(authRequest.C1) == 0, result2.Cmp(authRequest.C2) == 0)
+	Logger.Printf("r1=%v, r2=%v", authRequest.C1, authRequest.C2)
+	Logger.Printf("(result1==r1)=%v, (result2==r2)=%v", result1.Cmp(authRequest.C1) == 0, result2.Cmp(authRequest.C2) == 0)
 
 	return result1.Cmp(authRequest.C1) == 0 && result2.Cmp(authRequest.C2) == 0
 }
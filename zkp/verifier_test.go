@@ -50,3 +50,46 @@ func TestVerifyAuthentication_Fail(t *testing.T) {
 	result := verifier.VerifyAuthentication(commits, authRequest, challenge, answer)
 	assert.False(result)
 }
+
+func TestVerifyAuthentication_MissingCommits(t *testing.T) {
+	assert := assert.New(t)
+	verifier := zkp.NewVerifier()
+	commits := &zkp.Commits{
+		C1: big.NewInt(2),
+		C2: big.NewInt(3),
+	}
+	challenge := big.NewInt(4)
+	answer := big.NewInt(5)
+	assert.False(verifier.VerifyAuthentication(nil, commits, challenge, answer))
+	assert.False(verifier.VerifyAuthentication(commits, nil, challenge, answer))
+	assert.False(verifier.VerifyAuthentication(commits, &zkp.Commits{C1: big.NewInt(8)}, challenge, answer))
+	assert.False(verifier.VerifyAuthentication(commits, commits, nil, answer))
+	assert.False(verifier.VerifyAuthentication(commits, commits, challenge, nil))
+}
+
+func FuzzVerifyAuthentication(f *testing.F) {
+	f.Add([]byte{2}, []byte{3}, []byte{8}, []byte{4}, []byte{4}, []byte{5})
+	f.Add([]byte{0x10}, []byte{0xc}, []byte{0xd}, []byte{2}, []byte{1}, []byte{7})
+	f.Add([]byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{})
+
+	f.Fuzz(func(t *testing.T, y1, y2, r1, r2, challenge, answer []byte) {
+		verifier := zkp.NewVerifier()
+		commits := &zkp.Commits{
+			C1: new(big.Int).SetBytes(y1),
+			C2: new(big.Int).SetBytes(y2),
+		}
+		authRequest := &zkp.Commits{
+			C1: new(big.Int).SetBytes(r1),
+			C2: new(big.Int).SetBytes(r2),
+		}
+		c := new(big.Int).SetBytes(challenge)
+		s := new(big.Int).SetBytes(answer)
+		result := verifier.VerifyAuthentication(commits, authRequest, c, s)
+
+		// g and h are of order q, the answer matters mod q only
+		reduced := new(big.Int).Mod(s, big.NewInt(zkp.Q))
+		if expected := verifier.VerifyAuthentication(commits, authRequest, c, reduced); result != expected {
+			t.Fatalf("answer %v: got %v, answer mod q: got %v", s, result, expected)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package zkp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	NonBinaryMessageError = errors.New("websocket message isn't binary")
+)
+
+type (
+	// webSocketConn adapts WebSocket connection to the length-prefixed packet stream
+	//
+	// Each binary WebSocket message carries exactly one frame without the size header:
+	// Read prepends the header to the received message
+	// and Write sends every complete packet as a single message.
+	webSocketConn struct {
+		ws *websocket.Conn
+
+		readMu sync.Mutex
+		reader bytes.Reader
+
+		writeMu sync.Mutex
+		pending []byte
+	}
+)
+
+// NewWebSocketConn returns net.Conn carrying the envelope protocol over the WebSocket connection
+// so Framer, ReadMessage and SendMessage can be used unchanged.
+func NewWebSocketConn(ws *websocket.Conn) net.Conn {
+	ws.SetReadLimit(DefaultMaxFrameSize)
+	return &webSocketConn{ws: ws}
+}
+
+// Read reads the packet stream, receiving the next message when the previous one is consumed
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.reader.Len() == 0 {
+		messageType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if messageType != websocket.BinaryMessage {
+			return 0, NonBinaryMessageError
+		}
+		packet := make([]byte, FrameHeaderSize+len(data))
+		binary.LittleEndian.PutUint32(packet, uint32(len(data)))
+		copy(packet[FrameHeaderSize:], data)
+		c.reader.Reset(packet)
+	}
+	return c.reader.Read(p)
+}
+
+// Write writes the packet stream, sending each complete packet as a binary message
+func (c *webSocketConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.pending = append(c.pending, p...)
+	for len(c.pending) >= FrameHeaderSize {
+		size := binary.LittleEndian.Uint32(c.pending)
+		if size > DefaultMaxFrameSize {
+			return 0, fmt.Errorf("%w: %d > %d", FrameTooLargeError, size, DefaultMaxFrameSize)
+		}
+		end := FrameHeaderSize + int(size)
+		if len(c.pending) < end {
+			// wait for the rest of the packet
+			break
+		}
+		if err := c.ws.WriteMessage(websocket.BinaryMessage, c.pending[FrameHeaderSize:end]); err != nil {
+			return 0, err
+		}
+		c.pending = c.pending[end:]
+	}
+	return len(p), nil
+}
+
+// Close sends the close message and closes the connection
+func (c *webSocketConn) Close() error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	// best effort, the peer may be gone already
+	c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	return c.ws.Close()
+}
+
+func (c *webSocketConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *webSocketConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *webSocketConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
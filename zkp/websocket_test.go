@@ -0,0 +1,109 @@
+package zkp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mindaugasrukas/zkp_example/zkp"
+	"github.com/mindaugasrukas/zkp_example/zkp/gen/zkp_pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// newWebSocketPair returns the client and server side of the WebSocket connection
+func newWebSocketPair(t *testing.T) (client, server *websocket.Conn) {
+	serverConn := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		serverConn <- ws
+	}))
+	t.Cleanup(httpServer.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-serverConn
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestWebSocketConn(t *testing.T) {
+	assert := assert.New(t)
+	client, server := newWebSocketPair(t)
+	clientConn := zkp.NewWebSocketConn(client)
+	serverConn := zkp.NewWebSocketConn(server)
+
+	request := &zkp_pb.AuthRequest{
+		User: "max",
+		Commits: []*zkp_pb.AuthRequest_Commits{
+			{R1: []byte{0xd}, R2: []byte{2}},
+		},
+	}
+	go func() {
+		zkp.SendMessage(clientConn, request)
+		zkp.SendMessage(clientConn, &zkp_pb.AnswerRequest{Answer: []byte{7}})
+	}()
+
+	framer := zkp.NewFramer(serverConn, serverConn)
+	msg, err := framer.ReadMessage()
+	assert.NoError(err)
+	assert.True(proto.Equal(request, msg))
+	msg, err = framer.ReadMessage()
+	assert.NoError(err)
+	assert.True(proto.Equal(&zkp_pb.AnswerRequest{Answer: []byte{7}}, msg))
+
+	// each message is a single binary frame without the size header
+	go zkp.SendMessage(serverConn, &zkp_pb.AuthResponse{Result: true})
+	messageType, data, err := client.ReadMessage()
+	assert.NoError(err)
+	assert.Equal(websocket.BinaryMessage, messageType)
+	expected, err := zkp.DefaultCodec.Encode(&zkp_pb.AuthResponse{Result: true})
+	assert.NoError(err)
+	assert.Equal(expected, data)
+
+	// closing the connection ends the stream
+	assert.NoError(clientConn.Close())
+	_, err = framer.ReadMessage()
+	assert.ErrorIs(err, io.EOF)
+}
+
+func TestWebSocketConn_PartialWrites(t *testing.T) {
+	assert := assert.New(t)
+	client, server := newWebSocketPair(t)
+	clientConn := zkp.NewWebSocketConn(client)
+
+	packet := []byte{3, 0, 0, 0, 1, 2, 3, 1, 0}
+	// the packet is sent once complete
+	n, err := clientConn.Write(packet[:2])
+	assert.NoError(err)
+	assert.Equal(2, n)
+	_, err = clientConn.Write(packet[2:])
+	assert.NoError(err)
+
+	_, data, err := server.ReadMessage()
+	assert.NoError(err)
+	assert.Equal([]byte{1, 2, 3}, data)
+}
+
+func TestWebSocketConn_NonBinary(t *testing.T) {
+	assert := assert.New(t)
+	client, server := newWebSocketPair(t)
+	serverConn := zkp.NewWebSocketConn(server)
+
+	assert.NoError(client.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, err := zkp.ReadMessage(serverConn)
+	assert.ErrorIs(err, zkp.NonBinaryMessageError)
+}